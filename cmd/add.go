@@ -0,0 +1,398 @@
+package cmd
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"yggdrasil/sim-words/internal/base"
+	"yggdrasil/sim-words/internal/cluster"
+	"yggdrasil/sim-words/internal/embedding"
+	"yggdrasil/sim-words/internal/kmeans"
+	"yggdrasil/sim-words/internal/pq"
+	"yggdrasil/sim-words/internal/quant"
+	"yggdrasil/sim-words/internal/search"
+	"yggdrasil/sim-words/internal/word"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// wordChange 增加或删除的单词及其所属的叶子簇
+type wordChange struct {
+	Word      string
+	ClusterID uint
+}
+
+// driftReport 上次聚类以来单词增删带来的漂移
+type driftReport struct {
+	// Changed 叶子簇中增删的单词数之和，Ratio 为其与当前单词数之比
+	Changed int
+	Words   int
+	Ratio   float64
+	// MaxClusterID 增删比例最高的叶子簇，MaxRatio 为其比例
+	MaxClusterID uint
+	MaxRatio     float64
+	// Recluster Ratio 超过阈值，建议执行 recluster
+	Recluster bool
+}
+
+func RunAdd(args []string) {
+	addCmd := flag.NewFlagSet("add", flag.ExitOnError)
+
+	dbFilePath := addCmd.String("db", "data.sqlite", "path to storage data")
+	frequency := addCmd.Int("frequency", 0, "frequency of the added words")
+	nudge := addCmd.Bool("nudge", false, "move each cluster center towards its added words like online k-means")
+	threshold := addCmd.Float64("drift-threshold", 0.2, "advise recluster when the words added or removed since clustering exceed this ratio")
+	embdFlags := registerEmbedderFlags(addCmd, false)
+
+	addCmd.Parse(args)
+	if addCmd.NArg() == 0 {
+		log.Fatalln("expected words to add")
+	}
+
+	db, err := gorm.Open(sqlite.Open(*dbFilePath), &gorm.Config{})
+	if err != nil {
+		log.Fatalf("unable to open db connection: %s", err.Error())
+	}
+	log.Printf("database inited")
+
+	embedder, err := embdFlags.build(db)
+	if err != nil {
+		log.Fatalf("unable to create embedder: %s", err)
+	}
+	clusters, err := cluster.GetClusters(db, nil)
+	if err != nil {
+		log.Fatalf("unable to get clusters: %s", err)
+	}
+
+	clusters, added, err := addWords(db, embedder, embdFlags.modelID(embedder), addCmd.Args(), *frequency, clusters, *nudge)
+	if err != nil {
+		log.Fatalf("unable to add words: %s", err)
+	}
+	for _, c := range changesOf(added) {
+		log.Printf("added %s to cluster %d", c.Word, c.ClusterID)
+	}
+	logDrift(measureDrift(clusters, *threshold))
+}
+
+func RunRemove(args []string) {
+	removeCmd := flag.NewFlagSet("remove", flag.ExitOnError)
+
+	dbFilePath := removeCmd.String("db", "data.sqlite", "path to storage data")
+	nudge := removeCmd.Bool("nudge", false, "move each cluster center away from its removed words like online k-means")
+	threshold := removeCmd.Float64("drift-threshold", 0.2, "advise recluster when the words added or removed since clustering exceed this ratio")
+
+	removeCmd.Parse(args)
+	if removeCmd.NArg() == 0 {
+		log.Fatalln("expected words to remove")
+	}
+
+	db, err := gorm.Open(sqlite.Open(*dbFilePath), &gorm.Config{})
+	if err != nil {
+		log.Fatalf("unable to open db connection: %s", err.Error())
+	}
+	log.Printf("database inited")
+
+	clusters, err := cluster.GetClusters(db, nil)
+	if err != nil {
+		log.Fatalf("unable to get clusters: %s", err)
+	}
+
+	clusters, removed, err := removeWords(db, removeCmd.Args(), clusters, *nudge)
+	if err != nil {
+		log.Fatalf("unable to remove words: %s", err)
+	}
+	for _, c := range changesOf(removed) {
+		log.Printf("removed %s from cluster %d", c.Word, c.ClusterID)
+	}
+	logDrift(measureDrift(clusters, *threshold))
+}
+
+// addWords 嵌入化新单词并分配到最近的叶子簇，已存在的单词跳过。已量化或训练了 PQ 码本时同时编码。
+// nudge 时按在线 k-means 把叶子簇及其上层簇的中心移向新单词，并重新编码移动过的叶子簇内全部单词的 PQ 残差。
+// 返回更新后的簇与保存的单词，clusters 本身不变
+func addWords(
+	db *gorm.DB,
+	embedder embedding.Embedder,
+	model string,
+	texts []string,
+	frequency int,
+	clusters []cluster.Cluster,
+	nudge bool,
+) ([]cluster.Cluster, []word.WordEmbedding, error) {
+	// 单词与 load 一样清洗，不同模型的向量不能分到同一组簇
+	texts = cleanWords(texts)
+	total, err := word.Count(db, "")
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to count words: %w", err)
+	}
+	count, err := word.Count(db, model)
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to count words: %w", err)
+	}
+	if count < total {
+		return nil, nil, fmt.Errorf("words in the database were embedded with another model than %s", model)
+	}
+	existing, err := word.SelectByWords(db, model, texts)
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to read words: %w", err)
+	}
+	existingSet := make(map[string]bool, len(existing))
+	for _, w := range existing {
+		existingSet[w.Word] = true
+	}
+	texts = slices.DeleteFunc(texts, func(text string) bool {
+		return existingSet[text]
+	})
+	if len(texts) == 0 {
+		return clusters, nil, nil
+	}
+
+	leaves := search.LeafIndexes(clusters)
+	if len(leaves) == 0 {
+		return nil, nil, fmt.Errorf("no clusters, run load first")
+	}
+	embeddings, err := embedder.Embed(texts)
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to embed: %w", err)
+	}
+	params, err := quant.GetParams(db)
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to read quantization params: %w", err)
+	}
+	codebook, err := pq.GetCodebook(db)
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to read PQ codebook: %w", err)
+	}
+
+	updated := slices.Clone(clusters)
+	moved := map[int]bool{}
+	words := make([]word.WordEmbedding, len(texts))
+	for i, embd := range embeddings {
+		normalized := word.L2Normalize(embd)
+		closest := leaves[0]
+		for _, ci := range leaves {
+			if len(updated[ci].NormalizedEmbedding) != len(normalized) {
+				return nil, nil, fmt.Errorf("embedding of dimension %d does not match clusters of dimension %d",
+					len(normalized), len(updated[ci].NormalizedEmbedding))
+			}
+			if base.Distance(normalized, updated[ci].NormalizedEmbedding) < base.Distance(normalized, updated[closest].NormalizedEmbedding) {
+				closest = ci
+			}
+		}
+
+		c := &updated[closest]
+		c.Changed++
+		resize(updated, closest, 1, normalized, nudge)
+		if nudge {
+			moved[closest] = true
+		}
+
+		words[i] = word.WordEmbedding{
+			ClusterID: c.ID,
+			Word:      texts[i],
+			Frequency: frequency,
+			Model:     model,
+			Embedding: base.Embedding{
+				RawEmbedding:        embd,
+				NormalizedEmbedding: normalized,
+			},
+		}
+		if params != nil {
+			words[i].Quantized = params.Encode(normalized)
+		}
+		if codebook != nil {
+			words[i].PQCode = codebook.Encode(residual(normalized, c.NormalizedEmbedding))
+		}
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := word.SaveWords(tx, words); err != nil {
+			return fmt.Errorf("unable to save words: %w", err)
+		}
+		if err := reencodeClusters(tx, codebook, updated, moved); err != nil {
+			return err
+		}
+		return cluster.UpdateClusters(tx, updated)
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return updated, words, nil
+}
+
+// removeWords 删除单词并更新所属簇的单词数，不存在的单词跳过。nudge 时把叶子簇及其上层簇的中心移离被删除的单词，
+// 并重新编码移动过的叶子簇内剩余单词的 PQ 残差。删除了簇的代表词或标签时用簇内剩余单词重新计算。
+// 返回更新后的簇与删除的单词，clusters 本身不变
+func removeWords(db *gorm.DB, texts []string, clusters []cluster.Cluster, nudge bool) ([]cluster.Cluster, []word.WordEmbedding, error) {
+	words, err := word.SelectByWords(db, "", cleanWords(texts))
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to read words: %w", err)
+	}
+	if len(words) == 0 {
+		return clusters, nil, nil
+	}
+	codebook, err := pq.GetCodebook(db)
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to read PQ codebook: %w", err)
+	}
+
+	updated := slices.Clone(clusters)
+	moved := map[int]bool{}
+	positions := map[uint]int{}
+	for i, c := range updated {
+		positions[c.ID] = i
+	}
+	relabel := map[int]bool{}
+	ids := make([]uint, len(words))
+	for i, w := range words {
+		ids[i] = w.ID
+		ci, ok := positions[w.ClusterID]
+		if !ok {
+			continue
+		}
+		c := &updated[ci]
+		if c.AnchorWord == w.Word || c.Label == w.Word || slices.Contains(c.Anchors, w.Word) || slices.Contains(c.FrequentWords, w.Word) {
+			relabel[ci] = true
+		}
+		c.Changed++
+		resize(updated, ci, -1, w.NormalizedEmbedding, nudge)
+		if nudge {
+			moved[ci] = true
+		}
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := word.DeleteByIDs(tx, ids); err != nil {
+			return fmt.Errorf("unable to delete words: %w", err)
+		}
+		if err := reencodeClusters(tx, codebook, updated, moved); err != nil {
+			return err
+		}
+		for ci := range relabel {
+			rest, err := word.SelectByClusterID(tx, updated[ci].ID)
+			if err != nil {
+				return fmt.Errorf("unable to read words of cluster %d: %w", updated[ci].ID, err)
+			}
+			// 保持代表词个数不变，簇已空时保留原来的代表词
+			labelCluster(&updated[ci], rest, max(len(updated[ci].Anchors), 1))
+		}
+		return cluster.UpdateClusters(tx, updated)
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return updated, words, nil
+}
+
+// measureDrift 统计叶子簇上次聚类以来增删的单词，增删比例超过 threshold 时建议重新聚类
+func measureDrift(clusters []cluster.Cluster, threshold float64) driftReport {
+	var report driftReport
+	for _, ci := range search.LeafIndexes(clusters) {
+		c := clusters[ci]
+		report.Changed += c.Changed
+		report.Words += c.Size
+		if ratio := float64(c.Changed) / float64(max(c.Size, 1)); ratio > report.MaxRatio {
+			report.MaxClusterID = c.ID
+			report.MaxRatio = ratio
+		}
+	}
+	report.Ratio = float64(report.Changed) / float64(max(report.Words, 1))
+	report.Recluster = report.Ratio > threshold
+	return report
+}
+
+func logDrift(report driftReport) {
+	log.Printf("drift: %d of %d words changed since clustering (%.1f%%), at most %.1f%% in cluster %d",
+		report.Changed, report.Words, report.Ratio*100, report.MaxRatio*100, report.MaxClusterID)
+	if report.Recluster {
+		log.Printf("drift exceeds the threshold, run recluster")
+	}
+}
+
+// resize 把第 ci 个簇及其全部上层簇的单词数加上 delta（增加为 1，删除为 -1）。
+// nudge 时按在线 k-means 把这些簇的中心移向或移离 v，使中心仍是簇内单词的均值；簇中只剩 v 时中心不动
+func resize(clusters []cluster.Cluster, ci int, delta int, v base.Float64Slice, nudge bool) {
+	for {
+		c := &clusters[ci]
+		if nudge && c.Size+delta > 0 {
+			c.NormalizedEmbedding = moveCenter(*c, v, float64(delta)/float64(c.Size+delta))
+		}
+		c.Size += delta
+		parent := c.ParentID
+		if parent == nil {
+			return
+		}
+		ci = slices.IndexFunc(clusters, func(c cluster.Cluster) bool {
+			return c.ID == *parent
+		})
+		if ci < 0 {
+			return
+		}
+	}
+}
+
+// moveCenter 在线 k-means 更新：中心向 v 移动 rate 的比例，rate 为负时移离 v。球面 k-means 的中心重新归一化
+func moveCenter(c cluster.Cluster, v base.Float64Slice, rate float64) base.Float64Slice {
+	center := make(base.Float64Slice, len(c.NormalizedEmbedding))
+	for d, f := range c.NormalizedEmbedding {
+		center[d] = f + rate*(v[d]-f)
+	}
+	if c.Algorithm == string(kmeans.Spherical) {
+		return word.L2Normalize(center)
+	}
+	return center
+}
+
+// reencodeClusters 叶子簇中心移动后按新中心重新编码簇内全部单词的 PQ 残差，
+// 否则 ADC 用新中心加上按旧中心编码的残差打分。没有码本时不做修改
+func reencodeClusters(tx *gorm.DB, codebook *pq.Codebook, clusters []cluster.Cluster, moved map[int]bool) error {
+	if codebook == nil {
+		return nil
+	}
+	for ci := range moved {
+		c := clusters[ci]
+		words, err := word.SelectByClusterID(tx, c.ID)
+		if err != nil {
+			return fmt.Errorf("unable to read words of cluster %d: %w", c.ID, err)
+		}
+		for i := range words {
+			words[i].PQCode = codebook.Encode(residual(words[i].NormalizedEmbedding, c.NormalizedEmbedding))
+		}
+		if err := word.UpdatePQCodes(tx, words); err != nil {
+			return fmt.Errorf("unable to save PQ codes of cluster %d: %w", c.ID, err)
+		}
+	}
+	return nil
+}
+
+// residual 单词向量与簇中心之差，即 PQ 编码的对象
+func residual(v base.Float64Slice, center base.Float64Slice) []float64 {
+	r := make([]float64, len(v))
+	for d, f := range v {
+		r[d] = f - center[d]
+	}
+	return r
+}
+
+// cleanWords 与 load 一样转为小写并去掉非字母，丢弃清洗后为空或重复的单词
+func cleanWords(texts []string) []string {
+	var words []string
+	for _, text := range texts {
+		w := cleanWord(strings.ToLower(text))
+		if w != "" && !slices.Contains(words, w) {
+			words = append(words, w)
+		}
+	}
+	return words
+}
+
+func changesOf(words []word.WordEmbedding) []wordChange {
+	changes := make([]wordChange, len(words))
+	for i, w := range words {
+		changes[i] = wordChange{Word: w.Word, ClusterID: w.ClusterID}
+	}
+	return changes
+}
@@ -0,0 +1,222 @@
+package cmd
+
+import (
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"yggdrasil/sim-words/internal/base"
+	"yggdrasil/sim-words/internal/cluster"
+	"yggdrasil/sim-words/internal/embedding"
+	"yggdrasil/sim-words/internal/pq"
+	"yggdrasil/sim-words/internal/search"
+	"yggdrasil/sim-words/internal/word"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+func TestAddAndRemoveWords(t *testing.T) {
+	db := openTestDB(t, loadTestDB(t, "-quantize", "int8", "-pq-m", "16", "-pq-ks", "16"))
+	embedder := embedding.NewHashEmbedder(0)
+	clusters, _ := cluster.GetClusters(db, nil)
+	total, _ := word.Count(db, "")
+	if drift := measureDrift(clusters, 0.2); drift.Changed != 0 || drift.Words != int(total) || drift.Recluster {
+		t.Fatalf("expected no drift over %d words, got %+v", total, drift)
+	}
+
+	// apples 已存在，重复与清洗后为空的单词也会跳过
+	updated, added, err := addWords(db, embedder, embedder.Model(), []string{"Applez!", "apples", "kumquat", "applez", "42"}, 5, clusters, true)
+	if err != nil {
+		t.Fatalf("unable to add words: %s", err)
+	}
+	if len(added) != 2 || added[0].Word != "applez" || added[1].Word != "kumquat" {
+		t.Fatalf("expected applez and kumquat, got %+v", changesOf(added))
+	}
+	for _, w := range added {
+		if w.Frequency != 5 || len(w.Quantized) == 0 || len(w.PQCode) != 16 {
+			t.Errorf("word %s is not encoded: frequency %d, %d quantized bytes, %d PQ bytes", w.Word, w.Frequency, len(w.Quantized), len(w.PQCode))
+		}
+	}
+
+	// applez 分到最近的簇，簇中心移向 applez，传入的簇不变
+	ci := slices.IndexFunc(updated, func(c cluster.Cluster) bool { return c.ID == added[0].ClusterID })
+	for _, c := range clusters {
+		if base.Distance(c.NormalizedEmbedding, added[0].NormalizedEmbedding) < base.Distance(clusters[ci].NormalizedEmbedding, added[0].NormalizedEmbedding) {
+			t.Errorf("cluster %d is closer to applez than cluster %d", c.ID, clusters[ci].ID)
+		}
+	}
+	if updated[ci].Changed == 0 || updated[ci].Size != clusters[ci].Size+updated[ci].Changed {
+		t.Errorf("expected the size of cluster %d to grow, got %+v", updated[ci].ID, updated[ci])
+	}
+	before := base.Distance(clusters[ci].NormalizedEmbedding, added[0].NormalizedEmbedding)
+	after := base.Distance(updated[ci].NormalizedEmbedding, added[0].NormalizedEmbedding)
+	if after >= before {
+		t.Errorf("expected the center to move towards applez, distance %f -> %f", before, after)
+	}
+	saved, _ := cluster.GetClusters(db, []uint{updated[ci].ID})
+	if saved[0].Size != updated[ci].Size || saved[0].Changed != updated[ci].Changed {
+		t.Errorf("cluster is not saved: %+v", saved[0])
+	}
+	if drift := measureDrift(updated, 0.01); drift.Changed != 2 || drift.Words != int(total)+2 || !drift.Recluster {
+		t.Errorf("expected 2 of %d words changed, got %+v", total+2, drift)
+	}
+
+	// 新单词可以查询到
+	results, err := queryWords(db, embedder, updated, "applez", "", len(updated), 3)
+	if err != nil || len(results) == 0 || !strings.HasPrefix(results[0].Word, "apple") {
+		t.Errorf("expected an apple first, got %+v, %v", results, err)
+	}
+
+	// 删除锚点词时换成簇内剩余的单词
+	anchor := updated[ci].AnchorWord
+	updated, removed, err := removeWords(db, []string{"APPLEZ", anchor, "missing"}, updated, true)
+	if err != nil {
+		t.Fatalf("unable to remove words: %s", err)
+	}
+	if len(removed) != 2 {
+		t.Fatalf("expected 2 removed words, got %+v", changesOf(removed))
+	}
+	if left, _ := word.SelectByWords(db, "", []string{"applez", anchor}); len(left) != 0 {
+		t.Errorf("expected the words to be deleted, got %+v", changesOf(left))
+	}
+	if updated[ci].AnchorWord == anchor || updated[ci].AnchorWord == "applez" || updated[ci].AnchorWord == "" {
+		t.Errorf("expected a new anchor word, got %s", updated[ci].AnchorWord)
+	}
+	if drift := measureDrift(updated, 0.2); drift.Changed != 4 || drift.Words != int(total) {
+		t.Errorf("expected 4 of %d words changed, got %+v", total, drift)
+	}
+
+	if _, _, err := addWords(db, embedder, "other", []string{"fig"}, 0, updated, false); err == nil {
+		t.Error("expected an error for words of another model")
+	}
+}
+
+// checkReencoded 不重新排序时，簇内单词的 ADC 相似度与按簇的当前中心重新编码得到的一致
+func checkReencoded(t *testing.T, db *gorm.DB, clusters []cluster.Cluster, c cluster.Cluster, codebook *pq.Codebook) {
+	t.Helper()
+
+	defer func(rerank int) { search.PQRerank = rerank }(search.PQRerank)
+	search.PQRerank = 0
+	embedder := embedding.NewHashEmbedder(0)
+	query, _ := embedWord(embedder, "apple")
+	results, err := queryWords(db, embedder, clusters, "apple", "", len(clusters), 1000)
+	if err != nil {
+		t.Fatalf("query failed: %s", err)
+	}
+	similarities := map[string]float64{}
+	for _, r := range results {
+		similarities[r.Word] = r.Similarity
+	}
+
+	normalized := word.L2Normalize(query)
+	table := codebook.NewTable(normalized)
+	var centerSim float64
+	for d, f := range c.NormalizedEmbedding {
+		centerSim += normalized[d] * f
+	}
+	members, _ := word.SelectByClusterID(db, c.ID)
+	if len(members) < 2 {
+		t.Fatalf("expected words in cluster %d, got %d", c.ID, len(members))
+	}
+	for _, w := range members {
+		code := codebook.Encode(residual(w.NormalizedEmbedding, c.NormalizedEmbedding))
+		if !slices.Equal(w.PQCode, code) {
+			t.Errorf("word %s is encoded against an old center of cluster %d", w.Word, c.ID)
+		}
+		sim, ok := similarities[w.Word]
+		if expected := centerSim + table.Score(code); !ok || math.Abs(sim-expected) > 1e-9 {
+			t.Errorf("word %s has ADC similarity %f, expected %f", w.Word, sim, expected)
+		}
+	}
+}
+
+func TestNudgeReencodesPQ(t *testing.T) {
+	db := openTestDB(t, loadTestDB(t, "-levels", "2", "-sub-k", "3", "-pq-m", "16", "-pq-ks", "16"))
+	embedder := embedding.NewHashEmbedder(0)
+	clusters, _ := cluster.GetClusters(db, nil)
+	codebook, err := pq.GetCodebook(db)
+	if err != nil || codebook == nil {
+		t.Fatalf("expected a codebook, got %v, %v", codebook, err)
+	}
+
+	updated, added, err := addWords(db, embedder, embedder.Model(), []string{"applez"}, 1, clusters, true)
+	if err != nil || len(added) != 1 {
+		t.Fatalf("unable to add words: %+v, %v", added, err)
+	}
+	ci := slices.IndexFunc(updated, func(c cluster.Cluster) bool { return c.ID == added[0].ClusterID })
+	checkReencoded(t, db, updated, updated[ci], codebook)
+
+	// 上层簇同样移向新单词
+	if updated[ci].ParentID == nil {
+		t.Fatalf("expected cluster %d to have a parent", updated[ci].ID)
+	}
+	pi := slices.IndexFunc(updated, func(c cluster.Cluster) bool { return c.ID == *updated[ci].ParentID })
+	before := base.Distance(clusters[pi].NormalizedEmbedding, added[0].NormalizedEmbedding)
+	after := base.Distance(updated[pi].NormalizedEmbedding, added[0].NormalizedEmbedding)
+	if after >= before || updated[pi].Size != clusters[pi].Size+1 {
+		t.Errorf("expected parent %d to grow and move towards applez, distance %f -> %f, size %d -> %d",
+			updated[pi].ID, before, after, clusters[pi].Size, updated[pi].Size)
+	}
+	if saved, _ := cluster.GetClusters(db, []uint{updated[pi].ID}); !slices.Equal(saved[0].NormalizedEmbedding, updated[pi].NormalizedEmbedding) {
+		t.Errorf("center of parent %d is not saved", updated[pi].ID)
+	}
+
+	// 删除后中心与上层簇回到原处，剩余单词按新中心重新编码
+	updated, _, err = removeWords(db, []string{"applez"}, updated, true)
+	if err != nil {
+		t.Fatalf("unable to remove words: %s", err)
+	}
+	checkReencoded(t, db, updated, updated[ci], codebook)
+	for _, i := range []int{ci, pi} {
+		if d := base.Distance(updated[i].NormalizedEmbedding, clusters[i].NormalizedEmbedding); d > 1e-12 {
+			t.Errorf("expected cluster %d to move back, distance %g", updated[i].ID, d)
+		}
+	}
+}
+
+func TestServeAddAndRemoveWords(t *testing.T) {
+	db = openTestDB(t, loadTestDB(t))
+	embedder = embedding.NewHashEmbedder(0)
+	modelID = embedder.Model()
+	clusters, _ = cluster.GetClusters(db, nil)
+	var err error
+	matrix, err = search.LoadMatrix(db, 0)
+	if err != nil {
+		t.Fatalf("unable to load matrix: %s", err)
+	}
+	defer func() { matrix = nil }()
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(ErrorHandler())
+	r.POST("/words", handleAddWords)
+	r.DELETE("/words", handleRemoveWords)
+	send := func(method string, body string) int {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(method, "/words", strings.NewReader(body)))
+		return w.Code
+	}
+
+	if code := send(http.MethodPost, `{"words": ["kumquat"], "frequency": 7}`); code != http.StatusOK {
+		t.Fatalf("unable to add words: %d", code)
+	}
+	response := serveQuery(t, "/query?q=kumquats&l=1&search=exact")
+	if !response.Success || len(response.Data) != 1 || response.Data[0].Word != "kumquat" || response.Data[0].Frequency != 7 {
+		t.Fatalf("expected kumquat, got %+v", response)
+	}
+
+	if code := send(http.MethodDelete, `{"words": ["kumquat"]}`); code != http.StatusOK {
+		t.Fatalf("unable to remove words: %d", code)
+	}
+	response = serveQuery(t, "/query?q=kumquats&l=1&search=exact")
+	if !response.Success || len(response.Data) != 1 || response.Data[0].Word == "kumquat" {
+		t.Fatalf("expected kumquat to be removed, got %+v", response)
+	}
+
+	if code := send(http.MethodPost, `{"words": "kumquat"}`); code == http.StatusOK {
+		t.Error("expected an error for an invalid body")
+	}
+}
@@ -0,0 +1,240 @@
+package cmd
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+	"yggdrasil/sim-words/internal/cluster"
+	"yggdrasil/sim-words/internal/hnsw"
+	"yggdrasil/sim-words/internal/search"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func RunBench(args []string) {
+	if len(args) < 1 {
+		log.Fatalln("expected bench subcommand: recall")
+	}
+
+	switch args[0] {
+	case "recall":
+		runBenchRecall(args[1:])
+	default:
+		log.Fatalf("unknown bench subcommand %s", args[0])
+	}
+}
+
+// recallRow 一种查询方式与参数的召回率和平均耗时
+type recallRow struct {
+	Method  string
+	Param   string
+	Recall  float64
+	Latency time.Duration
+}
+
+func runBenchRecall(args []string) {
+	benchCmd := flag.NewFlagSet("bench recall", flag.ExitOnError)
+
+	dbFilePath := benchCmd.String("db", "data.sqlite", "path to storage data")
+	numQueries := benchCmd.Int("queries", 100, "number of words sampled as queries")
+	n := benchCmd.Int("n", 10, "measure recall@n against exact search")
+	ksStr := benchCmd.String("k", "1,2,4,8", "comma separated k values of cluster search")
+	l := benchCmd.Int("l", 0, "words per cluster of cluster search, default n")
+	efsStr := benchCmd.String("ef", "16,64,256", "comma separated ef values of hnsw search, used when the index exists")
+	beamsStr := benchCmd.String("beam", "1,2,4,8", "comma separated beam widths of tree search, used when the clusters form a tree")
+	indexFile := benchCmd.String("index", "", "HNSW index path, default <db>.hnsw")
+	seed := benchCmd.Int64("seed", 1, "random seed of the query sample")
+
+	benchCmd.Parse(args)
+
+	ks, err := parseInts(*ksStr)
+	if err != nil {
+		log.Fatalf("invalid -k: %s", err)
+	}
+	efs, err := parseInts(*efsStr)
+	if err != nil {
+		log.Fatalf("invalid -ef: %s", err)
+	}
+	beams, err := parseInts(*beamsStr)
+	if err != nil {
+		log.Fatalf("invalid -beam: %s", err)
+	}
+	if *l <= 0 {
+		*l = *n
+	}
+	if *indexFile == "" {
+		*indexFile = indexPath(*dbFilePath)
+	}
+
+	db, err := gorm.Open(sqlite.Open(*dbFilePath), &gorm.Config{})
+	if err != nil {
+		log.Fatalf("unable to open db connection: %s", err.Error())
+	}
+	log.Printf("database inited")
+
+	clusters, err := cluster.GetClusters(db, nil)
+	if err != nil {
+		log.Fatalf("unable to get clusters: %s", err)
+	}
+	matrix, err := search.LoadMatrix(db, 0)
+	if err != nil {
+		log.Fatalf("unable to load words: %s", err)
+	}
+	idx, err := loadIndex(*indexFile, matrix)
+	if err != nil {
+		log.Printf("hnsw skipped: %s", err)
+		idx = nil
+	}
+
+	queries := sampleQueries(matrix, *numQueries, *seed)
+	log.Printf("sampled %d queries from %d words", len(queries), matrix.Len())
+
+	rows, err := benchRecall(matrix, clusters, idx, queries, *n, *l, ks, efs, beams)
+	if err != nil {
+		log.Fatalf("unable to run benchmark: %s", err)
+	}
+	log.Printf("method\tparam\trecall@%d\tlatency", *n)
+	for _, row := range rows {
+		log.Printf("%s\t%s\t%.3f\t%s", row.Method, row.Param, row.Recall, row.Latency)
+	}
+}
+
+// sampleQueries 随机抽取单词，以其自身的向量作为查询
+func sampleQueries(matrix *search.Matrix, count int, seed int64) [][]float64 {
+	r := rand.New(rand.NewSource(seed))
+	rows := r.Perm(matrix.Len())[:min(count, matrix.Len())]
+
+	queries := make([][]float64, len(rows))
+	for i, row := range rows {
+		queries[i] = make([]float64, matrix.Dim)
+		for d, f := range matrix.Row(row) {
+			queries[i][d] = float64(f)
+		}
+	}
+	return queries
+}
+
+// benchRecall 以精确查询的前 n 个单词为基准，计算簇探查（每个 k）、簇树（每个 beam）与 HNSW（每个 ef）的 recall@n
+func benchRecall(
+	matrix *search.Matrix,
+	clusters []cluster.Cluster,
+	idx *hnsw.Index,
+	queries [][]float64,
+	n int,
+	l int,
+	ks []int,
+	efs []int,
+	beams []int,
+) ([]recallRow, error) {
+	truth := make([][]search.SearchResult, len(queries))
+	exact, err := measure("exact", "-", queries, func(i int, q []float64) ([]search.SearchResult, error) {
+		results, err := matrix.QueryExact(q, n, false)
+		truth[i] = results
+		return results, err
+	}, nil)
+	if err != nil {
+		return nil, err
+	}
+	rows := []recallRow{exact}
+
+	for _, k := range ks {
+		row, err := measure(searchClusters, fmt.Sprintf("k=%d", k), queries, func(_ int, q []float64) ([]search.SearchResult, error) {
+			return matrix.QueryWords(q, clusters, k, l, false)
+		}, truth)
+		if err != nil {
+			return nil, err
+		}
+		rows = append(rows, row)
+	}
+
+	if len(search.Leaves(clusters)) < len(clusters) {
+		for _, beam := range beams {
+			row, err := measure(searchTree, fmt.Sprintf("beam=%d", beam), queries, func(_ int, q []float64) ([]search.SearchResult, error) {
+				return matrix.QueryTree(q, clusters, beam, l, false)
+			}, truth)
+			if err != nil {
+				return nil, err
+			}
+			rows = append(rows, row)
+		}
+	}
+
+	if idx == nil {
+		return rows, nil
+	}
+	for _, ef := range efs {
+		row, err := measure(searchHNSW, fmt.Sprintf("ef=%d", ef), queries, func(_ int, q []float64) ([]search.SearchResult, error) {
+			return matrix.QueryHNSW(idx, q, n, ef, false)
+		}, truth)
+		if err != nil {
+			return nil, err
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// measure 依次执行全部查询，统计平均耗时和召回率：结果前 len(truth[i]) 个单词中
+// 相似度不低于精确结果最后一名的视为命中，相似度相同的单词可以互换；truth 为空时召回率记为 1
+func measure(
+	method string,
+	param string,
+	queries [][]float64,
+	query func(i int, q []float64) ([]search.SearchResult, error),
+	truth [][]search.SearchResult,
+) (recallRow, error) {
+	var elapsed time.Duration
+	found, total := 0, 0
+	for i, q := range queries {
+		start := time.Now()
+		results, err := query(i, q)
+		elapsed += time.Since(start)
+		if err != nil {
+			return recallRow{}, fmt.Errorf("%s %s: %w", method, param, err)
+		}
+
+		if truth == nil || len(truth[i]) == 0 {
+			continue
+		}
+		total += len(truth[i])
+		threshold := truth[i][len(truth[i])-1].Similarity - 1e-9
+		for _, r := range results[:min(len(truth[i]), len(results))] {
+			if r.Similarity >= threshold {
+				found++
+			}
+		}
+	}
+
+	recall := 1.0
+	if total > 0 {
+		recall = float64(found) / float64(total)
+	}
+	return recallRow{
+		Method:  method,
+		Param:   param,
+		Recall:  recall,
+		Latency: elapsed / time.Duration(max(len(queries), 1)),
+	}, nil
+}
+
+// parseInts 解析逗号分隔的整数列表
+func parseInts(s string) ([]int, error) {
+	var values []int
+	for _, field := range strings.Split(s, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		v, err := strconv.Atoi(field)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, v)
+	}
+	return values, nil
+}
@@ -0,0 +1,51 @@
+package cmd
+
+import (
+	"testing"
+	"yggdrasil/sim-words/internal/cluster"
+	"yggdrasil/sim-words/internal/hnsw"
+	"yggdrasil/sim-words/internal/search"
+)
+
+func TestBenchRecall(t *testing.T) {
+	db := openTestDB(t, loadTestDB(t))
+	clusters, _ := cluster.GetClusters(db, nil)
+	matrix, err := search.LoadMatrix(db, 0)
+	if err != nil {
+		t.Fatalf("unable to load matrix: %s", err)
+	}
+	idx := hnsw.Build(matrix, matrix.IDs, 8, 100, 1)
+	queries := sampleQueries(matrix, 20, 1)
+
+	rows, err := benchRecall(matrix, clusters, idx, queries, 5, 5, []int{1, len(clusters)}, []int{100}, []int{1})
+	if err != nil {
+		t.Fatalf("benchmark failed: %s", err)
+	}
+	if len(rows) != 4 {
+		t.Fatalf("expected exact, 2 cluster and 1 hnsw rows, got %+v", rows)
+	}
+
+	if rows[0].Method != searchExact || rows[0].Recall != 1 {
+		t.Errorf("unexpected exact row %+v", rows[0])
+	}
+	// 探查全部簇时等同于精确查询
+	if rows[2].Recall != 1 {
+		t.Errorf("probing all clusters should have full recall, got %+v", rows[2])
+	}
+	if rows[1].Recall > rows[2].Recall {
+		t.Errorf("recall should not drop with more clusters: %+v", rows)
+	}
+	if rows[3].Method != searchHNSW || rows[3].Recall < 0.9 {
+		t.Errorf("unexpected hnsw row %+v", rows[3])
+	}
+}
+
+func TestParseInts(t *testing.T) {
+	values, err := parseInts("1, 2,,8")
+	if err != nil || len(values) != 3 || values[2] != 8 {
+		t.Errorf("unexpected values %v %v", values, err)
+	}
+	if _, err := parseInts("1,x"); err == nil {
+		t.Error("expected an error")
+	}
+}
@@ -0,0 +1,96 @@
+package cmd
+
+import (
+	"flag"
+	"log"
+	"time"
+	"yggdrasil/sim-words/internal/cache"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func RunCache(args []string) {
+	if len(args) < 1 {
+		log.Fatalln("expected cache subcommand: stats, prune")
+	}
+
+	switch args[0] {
+	case "stats":
+		runCacheStats(args[1:])
+	case "prune":
+		runCachePrune(args[1:])
+	default:
+		log.Fatalf("unknown cache subcommand %s", args[0])
+	}
+}
+
+func runCacheStats(args []string) {
+	statsCmd := flag.NewFlagSet("cache stats", flag.ExitOnError)
+	dbFilePath := statsCmd.String("db", "data.sqlite", "path to storage data")
+	statsCmd.Parse(args)
+
+	db := openCacheDB(*dbFilePath)
+
+	counts, err := cache.CountByModel(db)
+	if err != nil {
+		log.Fatalf("unable to count cache entries: %s", err)
+	}
+	var total int64
+	for model, count := range counts {
+		log.Printf("%s\t%d", model, count)
+		total += count
+	}
+	log.Printf("%d entries in total", total)
+}
+
+func runCachePrune(args []string) {
+	pruneCmd := flag.NewFlagSet("cache prune", flag.ExitOnError)
+	dbFilePath := pruneCmd.String("db", "data.sqlite", "path to storage data")
+	model := pruneCmd.String("model", "", "delete all entries of this model id")
+	unusedFor := pruneCmd.Duration("unused-for", 0, "delete entries not used within this duration, e.g. 720h")
+	maxEntries := pruneCmd.Int64("max-entries", -1, "keep at most this many recently used entries")
+	pruneCmd.Parse(args)
+
+	db := openCacheDB(*dbFilePath)
+
+	if *model != "" {
+		deleted, err := cache.DeleteByModel(db, *model)
+		if err != nil {
+			log.Fatalf("unable to delete entries of %s: %s", *model, err)
+		}
+		log.Printf("deleted %d entries of %s", deleted, *model)
+	}
+
+	if *unusedFor > 0 {
+		deleted, err := cache.DeleteUnusedSince(db, time.Now().Add(-*unusedFor))
+		if err != nil {
+			log.Fatalf("unable to delete unused entries: %s", err)
+		}
+		log.Printf("deleted %d entries unused for %s", deleted, *unusedFor)
+	}
+
+	if *maxEntries >= 0 {
+		deleted, err := cache.Truncate(db, *maxEntries)
+		if err != nil {
+			log.Fatalf("unable to truncate cache: %s", err)
+		}
+		log.Printf("deleted %d least recently used entries", deleted)
+	}
+
+	// 释放删除后的空间
+	if err := db.Exec("VACUUM").Error; err != nil {
+		log.Fatalf("unable to vacuum database: %s", err)
+	}
+}
+
+func openCacheDB(path string) *gorm.DB {
+	db, err := gorm.Open(sqlite.Open(path), &gorm.Config{})
+	if err != nil {
+		log.Fatalf("unable to open db connection: %s", err.Error())
+	}
+	if err := cache.Migrate(db); err != nil {
+		log.Fatalf("unable to migrate embedding cache: %s", err)
+	}
+	return db
+}
@@ -0,0 +1,85 @@
+package cmd
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"time"
+	"yggdrasil/sim-words/internal/cache"
+	"yggdrasil/sim-words/internal/embedding"
+
+	"gorm.io/gorm"
+)
+
+// embedderFlags load、query、serve 共用的嵌入服务参数
+type embedderFlags struct {
+	provider   *string
+	baseUrl    *string
+	model      *string
+	apiKey     *string
+	dimension  *int
+	cache      *bool
+	cacheLimit *int64
+	timeout    *time.Duration
+	retries    *int
+}
+
+// registerEmbedderFlags cacheByDefault 决定 -embd-cache 的默认值
+func registerEmbedderFlags(fs *flag.FlagSet, cacheByDefault bool) *embedderFlags {
+	return &embedderFlags{
+		provider:   fs.String("embedder", "service", "embedding provider: service, openai, hash"),
+		baseUrl:    fs.String("embd-url", embedding.DefaultBaseUrl, "base url of the embedding service"),
+		model:      fs.String("embd-model", "", "model name of the embedding service"),
+		apiKey:     fs.String("embd-key", "", "api key of the embedding service, sent as bearer token"),
+		dimension:  fs.Int("embd-dim", 0, "requested embedding dimension, 0 for the model default"),
+		cache:      fs.Bool("embd-cache", cacheByDefault, "cache embeddings in the database"),
+		cacheLimit: fs.Int64("embd-cache-max", 1000000, "max entries of the embedding cache, 0 for unlimited"),
+		timeout:    fs.Duration("embd-timeout", 30*time.Second, "timeout of each embedding request"),
+		retries:    fs.Int("embd-retries", 3, "max retries of a failed embedding request"),
+	}
+}
+
+// build 创建 embedder，启用缓存时缓存存放在 db 中
+func (f *embedderFlags) build(db *gorm.DB) (embedding.Embedder, error) {
+	options := embedding.DefaultClientOptions()
+	options.Timeout = *f.timeout
+	options.MaxRetries = *f.retries
+
+	var embedder embedding.Embedder
+	switch *f.provider {
+	case "service":
+		embedder = embedding.NewServiceEmbedder(*f.baseUrl, *f.model, options)
+	case "openai":
+		if *f.model == "" {
+			return nil, fmt.Errorf("-embd-model is required for openai provider")
+		}
+		embedder = embedding.NewOpenAIEmbedder(*f.baseUrl, *f.model, *f.apiKey, *f.dimension, options)
+	case "hash":
+		embedder = embedding.NewHashEmbedder(*f.dimension)
+	default:
+		return nil, fmt.Errorf("unknown embedding provider %s", *f.provider)
+	}
+
+	if !*f.cache {
+		return embedder, nil
+	}
+	return cache.NewEmbedder(db, embedder, f.modelID(embedder), *f.cacheLimit)
+}
+
+// modelID 区分缓存条目所属的模型，服务地址不同视为不同模型
+func (f *embedderFlags) modelID(embedder embedding.Embedder) string {
+	switch *f.provider {
+	case "hash":
+		return embedder.Model()
+	default:
+		return fmt.Sprintf("%s:%s@%s:%d", *f.provider, *f.model, *f.baseUrl, *f.dimension)
+	}
+}
+
+// logCacheStats 启用缓存时输出命中统计
+func logCacheStats(embedder embedding.Embedder) {
+	if c, ok := embedder.(*cache.Embedder); ok {
+		stats := c.Stats()
+		log.Printf("embedding cache: %d hits, %d misses", stats.Hits, stats.Misses)
+	}
+}
@@ -0,0 +1,180 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"yggdrasil/sim-words/internal/vectors"
+	"yggdrasil/sim-words/internal/word"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// formatJSONL 导出为每行一个 JSON 对象，包含全部字段
+const formatJSONL vectors.Format = "jsonl"
+
+// exportRecord JSONL 导出的一行
+type exportRecord struct {
+	Word      string    `json:"word"`
+	Frequency int       `json:"frequency"`
+	ClusterID uint      `json:"cluster_id"`
+	Model     string    `json:"model"`
+	Embedding []float64 `json:"embedding"`
+}
+
+// exportOptions 导出参数
+type exportOptions struct {
+	Format vectors.Format
+	Model  string
+	// Raw 导出原始向量而不是归一化后的向量
+	Raw bool
+	// VocabPath 单词表路径，为空时不写出
+	VocabPath string
+}
+
+func RunExport(args []string) {
+	exportCmd := flag.NewFlagSet("export", flag.ExitOnError)
+
+	outputPath := exportCmd.String("output", "", "output file path, - for stdout, gzip compressed when ending with .gz")
+	exportCmd.StringVar(outputPath, "o", "", "shorthand for -output")
+	format := exportCmd.String("format", "auto", "output format: auto, glove, word2vec, word2vec-bin, npy, jsonl")
+	model := exportCmd.String("model", "", "only export words embedded with this model id, empty for all")
+	raw := exportCmd.Bool("raw", false, "export raw embeddings instead of normalized ones")
+	vocabPath := exportCmd.String("vocab", "", "vocabulary TSV with row, word, frequency and cluster id, default <output>.vocab.tsv for npy")
+
+	dbFilePath := exportCmd.String("db", "data.sqlite", "path to storage data")
+
+	exportCmd.Parse(args)
+
+	if *outputPath == "" {
+		log.Fatalln("expected -output")
+	}
+	opts := exportOptions{
+		Format:    vectors.Format(*format),
+		Model:     *model,
+		Raw:       *raw,
+		VocabPath: *vocabPath,
+	}
+	if *format == "auto" {
+		opts.Format = detectExportFormat(*outputPath)
+	}
+	if opts.Format == vectors.FormatNpy && opts.VocabPath == "" {
+		if *outputPath == "-" {
+			log.Fatalln("expected -vocab when writing npy to stdout")
+		}
+		opts.VocabPath = strings.TrimSuffix(strings.TrimSuffix(*outputPath, ".gz"), ".npy") + ".vocab.tsv"
+	}
+
+	db, err := gorm.Open(sqlite.Open(*dbFilePath), &gorm.Config{})
+	if err != nil {
+		log.Fatalf("unable to open db connection: %s", err.Error())
+	}
+	log.Printf("database inited")
+
+	count, err := exportWords(db, *outputPath, opts)
+	if err != nil {
+		log.Fatalf("unable to export to %s: %s", *outputPath, err)
+	}
+	log.Printf("exported %d words to %s", count, *outputPath)
+	if opts.VocabPath != "" {
+		log.Printf("vocabulary written to %s", opts.VocabPath)
+	}
+}
+
+// detectExportFormat 在向量格式之外识别 .jsonl
+func detectExportFormat(path string) vectors.Format {
+	name := strings.TrimSuffix(strings.ToLower(path), ".gz")
+	if strings.HasSuffix(name, ".jsonl") || strings.HasSuffix(name, ".ndjson") {
+		return formatJSONL
+	}
+	return vectors.DetectFormat(path)
+}
+
+// exportWords 按 ID 顺序分批导出单词，返回导出的单词数
+func exportWords(db *gorm.DB, path string, opts exportOptions) (int, error) {
+	count, err := word.Count(db, opts.Model)
+	if err != nil {
+		return 0, fmt.Errorf("unable to count words: %w", err)
+	}
+	if count == 0 {
+		return 0, errors.New("no words to export")
+	}
+
+	output, err := vectors.Create(path)
+	if err != nil {
+		return 0, err
+	}
+	defer output.Close()
+
+	var vocab io.WriteCloser
+	if opts.VocabPath != "" {
+		vocab, err = vectors.Create(opts.VocabPath)
+		if err != nil {
+			return 0, err
+		}
+		defer vocab.Close()
+		fmt.Fprintln(vocab, "row\tword\tfrequency\tcluster_id")
+	}
+
+	var writer *vectors.Writer
+	encoder := json.NewEncoder(output)
+	exported := 0
+	err = word.FindInBatches(db, opts.Model, 1000, func(words []word.WordEmbedding) error {
+		for _, w := range words {
+			vector := []float64(w.NormalizedEmbedding)
+			if opts.Raw {
+				vector = w.RawEmbedding
+			}
+
+			if opts.Format == formatJSONL {
+				err = encoder.Encode(exportRecord{
+					Word:      w.Word,
+					Frequency: w.Frequency,
+					ClusterID: w.ClusterID,
+					Model:     w.Model,
+					Embedding: vector,
+				})
+			} else {
+				// 维度取自第一个单词
+				if writer == nil {
+					writer, err = vectors.NewWriter(output, opts.Format, int(count), len(vector))
+					if err != nil {
+						return err
+					}
+				}
+				err = writer.Write(w.Word, vector)
+			}
+			if err != nil {
+				return err
+			}
+
+			if vocab != nil {
+				if _, err := fmt.Fprintf(vocab, "%d\t%s\t%d\t%d\n", exported, w.Word, w.Frequency, w.ClusterID); err != nil {
+					return err
+				}
+			}
+			exported++
+		}
+		return nil
+	})
+	if err != nil {
+		return exported, err
+	}
+	if writer != nil {
+		if err := writer.Close(); err != nil {
+			return exported, err
+		}
+	}
+
+	if vocab != nil {
+		if err := vocab.Close(); err != nil {
+			return exported, err
+		}
+	}
+	return exported, output.Close()
+}
@@ -0,0 +1,116 @@
+package cmd
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"yggdrasil/sim-words/internal/dataset"
+	"yggdrasil/sim-words/internal/vectors"
+	"yggdrasil/sim-words/internal/word"
+)
+
+func TestExportWord2VecBinary(t *testing.T) {
+	dbPath := loadTestDB(t)
+	db := openTestDB(t, dbPath)
+	outputPath := filepath.Join(t.TempDir(), "vectors.bin.gz")
+
+	RunExport([]string{"-o", outputPath, "-db", dbPath})
+
+	words, _ := word.SelectByModel(db, "hash-2-4-256")
+	byWord := map[string]word.WordEmbedding{}
+	for _, w := range words {
+		byWord[w.Word] = w
+	}
+
+	file, err := dataset.Open(outputPath)
+	if err != nil {
+		t.Fatalf("unable to open export: %s", err)
+	}
+	defer file.Close()
+	read := 0
+	err = vectors.Read(file, vectors.FormatWord2VecBinary, func(w string, vector []float64) error {
+		read++
+		expected := byWord[w].NormalizedEmbedding
+		for i := range vector {
+			if float32(vector[i]) != float32(expected[i]) {
+				t.Fatalf("vector of %s differs at %d", w, i)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unable to read export: %s", err)
+	}
+	if read != len(words) {
+		t.Errorf("expected %d words, got %d", len(words), read)
+	}
+}
+
+func TestExportNpyAndVocab(t *testing.T) {
+	dbPath := loadTestDB(t)
+	db := openTestDB(t, dbPath)
+	dir := t.TempDir()
+
+	count, err := exportWords(db, filepath.Join(dir, "vectors.npy"), exportOptions{
+		Format:    vectors.FormatNpy,
+		Raw:       true,
+		VocabPath: filepath.Join(dir, "vectors.vocab.tsv"),
+	})
+	if err != nil {
+		t.Fatalf("export failed: %s", err)
+	}
+
+	data, _ := os.ReadFile(filepath.Join(dir, "vectors.npy"))
+	headerLen := int(binary.LittleEndian.Uint16(data[8:10]))
+	if len(data)-10-headerLen != count*256*4 {
+		t.Errorf("unexpected npy data size %d for %d words", len(data)-10-headerLen, count)
+	}
+
+	vocab, _ := os.ReadFile(filepath.Join(dir, "vectors.vocab.tsv"))
+	lines := strings.Split(strings.TrimSpace(string(vocab)), "\n")
+	if len(lines) != count+1 || lines[0] != "row\tword\tfrequency\tcluster_id" {
+		t.Fatalf("unexpected vocabulary with %d lines, header %q", len(lines), lines[0])
+	}
+	fields := strings.Split(lines[1], "\t")
+	if len(fields) != 4 || fields[0] != "0" || fields[3] == "0" {
+		t.Errorf("unexpected vocabulary line %q", lines[1])
+	}
+}
+
+func TestExportJSONL(t *testing.T) {
+	dbPath := loadTestDB(t)
+	db := openTestDB(t, dbPath)
+	outputPath := filepath.Join(t.TempDir(), "words.jsonl")
+
+	count, err := exportWords(db, outputPath, exportOptions{Format: detectExportFormat(outputPath)})
+	if err != nil {
+		t.Fatalf("export failed: %s", err)
+	}
+
+	file, _ := os.Open(outputPath)
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(nil, 1024*1024)
+	lines := 0
+	for scanner.Scan() {
+		var record exportRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			t.Fatalf("invalid line: %s", err)
+		}
+		if record.Word == "" || record.ClusterID == 0 || record.Model != "hash-2-4-256" || len(record.Embedding) != 256 {
+			t.Fatalf("unexpected record %+v", record)
+		}
+		lines++
+	}
+	if lines != count {
+		t.Errorf("expected %d lines, got %d", count, lines)
+	}
+
+	if _, err := exportWords(db, outputPath, exportOptions{Format: formatJSONL, Model: "other"}); err == nil {
+		t.Error("expected an error when there is nothing to export")
+	}
+}
@@ -0,0 +1,198 @@
+package cmd
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"path/filepath"
+	"slices"
+	"strings"
+	"yggdrasil/sim-words/internal/base"
+	"yggdrasil/sim-words/internal/dataset"
+	"yggdrasil/sim-words/internal/quant"
+	"yggdrasil/sim-words/internal/vectors"
+	"yggdrasil/sim-words/internal/word"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// errImportLimit 读取数量达到 -limit 时用于提前结束读取
+var errImportLimit = errors.New("import limit reached")
+
+func RunImport(args []string) {
+	importCmd := flag.NewFlagSet("import", flag.ExitOnError)
+
+	inputPath := importCmd.String("input", "", "vector file path, - for stdin")
+	importCmd.StringVar(inputPath, "i", "", "shorthand for -input")
+	format := importCmd.String("format", "auto", "vector format: auto, glove, word2vec, word2vec-bin (fastText .vec is word2vec)")
+	model := importCmd.String("model", "", "model id recorded for the words, default import:<file name>")
+	limit := importCmd.Int("limit", 0, "import at most this many words, 0 for all")
+	minLength := importCmd.Int("min-length", 0, "keep words with length not less than this value")
+	clean := importCmd.Bool("clean", true, "lowercase words and drop non-letters like load does, keeping the first duplicate")
+
+	clusterFlags := registerKMeansFlags(importCmd)
+
+	dbFilePath := importCmd.String("db", "data.sqlite", "path to storage data")
+	vectorEncoding := importCmd.String("vector-encoding", string(base.EncodingFloat64), "storage encoding of vectors: float64, float32, json")
+	buildHNSW := importCmd.Bool("hnsw", false, "also build the HNSW index saved as <db>.hnsw")
+	indexFlags := registerHNSWFlags(importCmd)
+	quantize := importCmd.String("quantize", string(quant.None), "also store quantized vectors for a fast first search pass: none, int8, int8-dim, binary")
+	productFlags := registerPQFlags(importCmd)
+
+	importCmd.Parse(args)
+
+	vectorFormat := vectors.Format(*format)
+	if *format == "auto" {
+		vectorFormat = vectors.DetectFormat(*inputPath)
+	}
+	modelID := *model
+	if modelID == "" {
+		modelID = "import:" + filepath.Base(*inputPath)
+	}
+
+	encoding, err := base.ParseVectorEncoding(*vectorEncoding)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	base.Encoding = encoding
+	scheme, err := quant.ParseScheme(*quantize)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	clusterOptions, err := clusterFlags.options()
+	if err != nil {
+		log.Fatalln(err)
+	}
+	tuning, err := clusterFlags.tuning()
+	if err != nil {
+		log.Fatalln(err)
+	}
+	tree, err := clusterFlags.tree()
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	db, err := gorm.Open(sqlite.Open(*dbFilePath), &gorm.Config{})
+	if err != nil {
+		log.Fatalf("unable to open db connection: %s", err.Error())
+	}
+	log.Printf("database inited")
+
+	words, err := importVectors(db, *inputPath, vectorFormat, modelID, *limit, *minLength, *clean)
+	if err != nil {
+		log.Fatalf("unable to import from %s: %s", *inputPath, err)
+	}
+	log.Printf("imported %d words as %s", len(words), modelID)
+
+	if clusterOptions.K == 0 {
+		clusterOptions.K, err = autoK(words, clusterOptions, tuning)
+		if err != nil {
+			log.Fatalf("unable to choose k: %s", err)
+		}
+	}
+
+	err = clusterWords(db, words, clusterOptions, tree, *clusterFlags.anchors)
+	if err != nil {
+		log.Fatalf("unable to cluster words: %s", err)
+	}
+
+	err = quantizeWords(db, scheme)
+	if err != nil {
+		log.Fatalf("unable to quantize words: %s", err)
+	}
+
+	err = trainPQ(db, productFlags)
+	if err != nil {
+		log.Fatalf("unable to train product quantization: %s", err)
+	}
+
+	if *buildHNSW {
+		if err := buildIndex(db, indexPath(*dbFilePath), indexFlags); err != nil {
+			log.Fatalf("unable to build index: %s", err)
+		}
+	}
+}
+
+// importVectors 读取预先计算好的向量，替换单词表中的全部单词
+func importVectors(
+	db *gorm.DB,
+	path string,
+	format vectors.Format,
+	modelID string,
+	limit int,
+	minLength int,
+	clean bool,
+) ([]word.WordEmbedding, error) {
+	file, err := dataset.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	db.AutoMigrate(&word.WordEmbedding{})
+	if err := word.DeleteAll(db); err != nil {
+		return nil, fmt.Errorf("unable to delete old words: %w", err)
+	}
+
+	seen := map[string]bool{}
+	batch := []word.WordEmbedding{}
+	imported := 0
+	dim := 0
+	flush := func() error {
+		if err := word.SaveWords(db, batch); err != nil {
+			return fmt.Errorf("unable to save words: %w", err)
+		}
+		imported += len(batch)
+		batch = batch[:0]
+		return nil
+	}
+
+	err = vectors.Read(file, format, func(w string, vector []float64) error {
+		if clean {
+			w = cleanWord(strings.ToLower(w))
+		}
+		if w == "" || len(w) < minLength || seen[w] {
+			return nil
+		}
+		if dim == 0 {
+			dim = len(vector)
+		}
+		if len(vector) != dim {
+			return fmt.Errorf("vector of %s has dimension %d, expected %d", w, len(vector), dim)
+		}
+		if !slices.ContainsFunc(vector, func(v float64) bool { return v != 0 }) {
+			// 零向量无法归一化
+			return nil
+		}
+		seen[w] = true
+
+		batch = append(batch, word.WordEmbedding{
+			Word:  w,
+			Model: modelID,
+			Embedding: base.Embedding{
+				RawEmbedding:        vector,
+				NormalizedEmbedding: word.L2Normalize(vector),
+			},
+		})
+		if len(batch) >= 1000 {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+		if limit > 0 && imported+len(batch) >= limit {
+			return errImportLimit
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, errImportLimit) {
+		return nil, err
+	}
+	if err := flush(); err != nil {
+		return nil, err
+	}
+	log.Printf("read %d vectors of dimension %d", imported, dim)
+
+	return word.SelectByModel(db, modelID)
+}
@@ -0,0 +1,117 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"yggdrasil/sim-words/internal/cluster"
+	"yggdrasil/sim-words/internal/dataset"
+	"yggdrasil/sim-words/internal/embedding"
+	"yggdrasil/sim-words/internal/word"
+)
+
+// writeGloVe 用哈希嵌入为测试单词生成 GloVe 文本文件
+func writeGloVe(t *testing.T, path string) []word.RawRecord {
+	t.Helper()
+
+	records, err := loadFromFile(testWordsPath, dataset.Options{}, 0, 0, 0)
+	if err != nil {
+		t.Fatalf("unable to read test words: %s", err)
+	}
+	texts := make([]string, len(records))
+	for i, r := range records {
+		texts[i] = r.Word
+	}
+	vectors, _ := embedding.NewHashEmbedder(32).Embed(texts)
+
+	var sb strings.Builder
+	for i, text := range texts {
+		sb.WriteString(text)
+		for _, v := range vectors[i] {
+			fmt.Fprintf(&sb, " %g", v)
+		}
+		sb.WriteString("\n")
+	}
+	// 重复和需要清洗的单词
+	sb.WriteString("Apple!" + strings.Repeat(" 1", 32) + "\n")
+	if err := os.WriteFile(path, []byte(sb.String()), 0o644); err != nil {
+		t.Fatalf("unable to write vectors: %s", err)
+	}
+	return records
+}
+
+func TestImportGloVe(t *testing.T) {
+	dir := t.TempDir()
+	vectorPath := filepath.Join(dir, "vectors.txt")
+	records := writeGloVe(t, vectorPath)
+	dbPath := filepath.Join(dir, "test.sqlite")
+
+	RunImport([]string{"-i", vectorPath, "-k", "1", "-db", dbPath})
+
+	db := openTestDB(t, dbPath)
+	words, err := word.SelectByModel(db, "import:vectors.txt")
+	if err != nil {
+		t.Fatalf("unable to read words: %s", err)
+	}
+	if len(words) != len(records) {
+		t.Fatalf("expected %d words, got %d", len(records), len(words))
+	}
+	for _, w := range words {
+		if len(w.RawEmbedding) != 32 || len(w.NormalizedEmbedding) != 32 || w.ClusterID == 0 {
+			t.Fatalf("word %s not imported correctly: %+v", w.Word, w)
+		}
+	}
+
+	clusters, _ := cluster.GetClusters(db, nil)
+	if len(clusters) != 1 || clusters[0].AnchorWord == "" {
+		t.Fatalf("unexpected clusters %+v", clusters)
+	}
+
+	query, _ := embedding.NewHashEmbedder(32).Embed([]string{"apple"})
+	results, err := queryWords(db, staticEmbedder{query[0]}, clusters, "apple", "", 1, 1)
+	if err != nil {
+		t.Fatalf("query failed: %s", err)
+	}
+	if len(results) == 0 || results[0].Word != "apples" {
+		t.Errorf("expected apples, got %+v", results)
+	}
+}
+
+func TestImportLimit(t *testing.T) {
+	dir := t.TempDir()
+	vectorPath := filepath.Join(dir, "vectors.txt")
+	writeGloVe(t, vectorPath)
+
+	db := openTestDB(t, filepath.Join(dir, "test.sqlite"))
+	words, err := importVectors(db, vectorPath, "glove", "m", 10, 5, true)
+	if err != nil {
+		t.Fatalf("import failed: %s", err)
+	}
+	if len(words) != 10 {
+		t.Fatalf("expected 10 words, got %d", len(words))
+	}
+	for _, w := range words {
+		if len(w.Word) < 5 {
+			t.Errorf("word %s is shorter than min length", w.Word)
+		}
+	}
+}
+
+// staticEmbedder 总是返回同一个向量
+type staticEmbedder struct {
+	vector []float64
+}
+
+func (e staticEmbedder) Embed(texts []string) ([][]float64, error) {
+	result := make([][]float64, len(texts))
+	for i := range texts {
+		result[i] = e.vector
+	}
+	return result, nil
+}
+
+func (e staticEmbedder) Dimension() int { return len(e.vector) }
+
+func (e staticEmbedder) Model() string { return "static" }
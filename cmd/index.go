@@ -0,0 +1,99 @@
+package cmd
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"time"
+	"yggdrasil/sim-words/internal/hnsw"
+	"yggdrasil/sim-words/internal/search"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// 查询方式
+const (
+	// searchClusters 探查与查询最相似和最不相似的簇
+	searchClusters = "clusters"
+	// searchHNSW 在 HNSW 索引上查询，不经过簇
+	searchHNSW = "hnsw"
+	// searchExact 对全部单词打分
+	searchExact = "exact"
+	// searchTree 沿层次聚类的簇树以一定宽度向下探查
+	searchTree = "tree"
+)
+
+// hnswFlags build-index 与 load、import 共用的建图参数
+type hnswFlags struct {
+	m              *int
+	efConstruction *int
+	seed           *int64
+}
+
+func registerHNSWFlags(fs *flag.FlagSet) *hnswFlags {
+	return &hnswFlags{
+		m:              fs.Int("hnsw-m", 16, "max neighbours per node and layer of the HNSW index"),
+		efConstruction: fs.Int("hnsw-ef-construction", 200, "candidates per layer when building the HNSW index"),
+		seed:           fs.Int64("hnsw-seed", 1, "random seed of the HNSW node levels"),
+	}
+}
+
+func RunBuildIndex(args []string) {
+	indexCmd := flag.NewFlagSet("build-index", flag.ExitOnError)
+
+	dbFilePath := indexCmd.String("db", "data.sqlite", "path to storage data")
+	outputPath := indexCmd.String("o", "", "index file path, default <db>.hnsw")
+	indexFlags := registerHNSWFlags(indexCmd)
+
+	indexCmd.Parse(args)
+
+	if *outputPath == "" {
+		*outputPath = indexPath(*dbFilePath)
+	}
+
+	db, err := gorm.Open(sqlite.Open(*dbFilePath), &gorm.Config{})
+	if err != nil {
+		log.Fatalf("unable to open db connection: %s", err.Error())
+	}
+	log.Printf("database inited")
+
+	if err := buildIndex(db, *outputPath, indexFlags); err != nil {
+		log.Fatalf("unable to build index: %s", err)
+	}
+}
+
+// indexPath HNSW 索引默认保存在数据库文件旁
+func indexPath(dbPath string) string {
+	return dbPath + ".hnsw"
+}
+
+// buildIndex 载入全部单词并建立 HNSW 索引，写入 path
+func buildIndex(db *gorm.DB, path string, f *hnswFlags) error {
+	matrix, err := search.LoadMatrix(db, 0)
+	if err != nil {
+		return fmt.Errorf("unable to load words: %w", err)
+	}
+
+	start := time.Now()
+	idx := hnsw.Build(matrix, matrix.IDs, *f.m, *f.efConstruction, *f.seed)
+	log.Printf("built HNSW index of %d words in %s", matrix.Len(), time.Since(start))
+
+	if err := idx.Save(path); err != nil {
+		return fmt.Errorf("unable to save index: %w", err)
+	}
+	log.Printf("index saved to %s", path)
+	return nil
+}
+
+// loadIndex 读取 HNSW 索引并检查其节点与内存中的单词一致
+func loadIndex(path string, matrix *search.Matrix) (*hnsw.Index, error) {
+	idx, err := hnsw.Load(path)
+	if err != nil {
+		return nil, err
+	}
+	if !idx.Matches(matrix.IDs) {
+		return nil, fmt.Errorf("index %s does not match the words in the database, run build-index again", path)
+	}
+	return idx, nil
+}
@@ -0,0 +1,484 @@
+package cmd
+
+import (
+	"compress/gzip"
+	"flag"
+	"maps"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"yggdrasil/sim-words/internal/base"
+	"yggdrasil/sim-words/internal/cluster"
+	"yggdrasil/sim-words/internal/dataset"
+	"yggdrasil/sim-words/internal/embedding"
+	"yggdrasil/sim-words/internal/kmeans"
+	"yggdrasil/sim-words/internal/pq"
+	"yggdrasil/sim-words/internal/quant"
+	"yggdrasil/sim-words/internal/search"
+	"yggdrasil/sim-words/internal/word"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+const testWordsPath = "../testdata/words.tsv"
+
+// loadTestDB 用离线哈希嵌入把 testdata/words.tsv 载入临时数据库
+func loadTestDB(t *testing.T, extraArgs ...string) string {
+	t.Helper()
+
+	dbPath := filepath.Join(t.TempDir(), "test.sqlite")
+	args := append([]string{
+		"-i", testWordsPath,
+		"-mi", "0",
+		"-mf", "0",
+		"-k", "4",
+		"-embedder", "hash",
+		"-db", dbPath,
+	}, extraArgs...)
+	RunLoad(args)
+	return dbPath
+}
+
+func openTestDB(t *testing.T, path string) *gorm.DB {
+	t.Helper()
+
+	db, err := gorm.Open(sqlite.Open(path), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("unable to open db: %s", err)
+	}
+	return db
+}
+
+func TestLoadAndQuery(t *testing.T) {
+	db := openTestDB(t, loadTestDB(t))
+
+	records, err := loadFromFile(testWordsPath, dataset.Options{}, 0, 0, 0)
+	if err != nil {
+		t.Fatalf("unable to read test words: %s", err)
+	}
+	words, err := word.SelectByModel(db, embedding.NewHashEmbedder(0).Model())
+	if err != nil {
+		t.Fatalf("unable to read words: %s", err)
+	}
+	if len(words) != len(records) {
+		t.Fatalf("expected %d words, got %d", len(records), len(words))
+	}
+
+	clusters, err := cluster.GetClusters(db, nil)
+	if err != nil {
+		t.Fatalf("unable to read clusters: %s", err)
+	}
+	if len(clusters) != 4 {
+		t.Fatalf("expected 4 clusters, got %d", len(clusters))
+	}
+	for _, w := range words {
+		if w.ClusterID == 0 {
+			t.Fatalf("word %s has no cluster", w.Word)
+		}
+	}
+
+	// 探查全部簇，结果与 k-means 的随机初始化无关
+	results, err := queryWords(db, embedding.NewHashEmbedder(0), clusters, "apple", "", len(clusters), 3)
+	if err != nil {
+		t.Fatalf("query failed: %s", err)
+	}
+	if len(results) < 2 || results[0].Word != "apples" || results[0].Similarity < 0.6 {
+		t.Fatalf("expected apples first, got %+v", results)
+	}
+	for _, r := range results {
+		if r.Word == "apple" {
+			t.Errorf("query word should be excluded, got %+v", results)
+		}
+	}
+	foundSauce := false
+	for _, r := range results {
+		if r.Word == "applesauce" {
+			foundSauce = true
+		}
+	}
+	if !foundSauce {
+		t.Errorf("expected applesauce in results, got %+v", results)
+	}
+}
+
+func TestLoadAndQueryWithTemplate(t *testing.T) {
+	db := openTestDB(t, loadTestDB(t))
+
+	clusters, err := cluster.GetClusters(db, nil)
+	if err != nil {
+		t.Fatalf("unable to read clusters: %s", err)
+	}
+
+	results, err := queryWords(db, embedding.NewHashEmbedder(0), clusters, "kitten", "I like {{placeholder}}", len(clusters), 100)
+	if err != nil {
+		t.Fatalf("query failed: %s", err)
+	}
+	if len(results) == 0 || results[0].Word != "kittens" {
+		t.Fatalf("expected kittens first, got %+v", results[:min(5, len(results))])
+	}
+}
+
+func TestLoadPlainListGzip(t *testing.T) {
+	dir := t.TempDir()
+	inputPath := filepath.Join(dir, "words.txt.gz")
+	file, err := os.Create(inputPath)
+	if err != nil {
+		t.Fatalf("unable to create input: %s", err)
+	}
+	gz := gzip.NewWriter(file)
+	if _, err := gz.Write([]byte("Apple\napples\npear\npears\ncat\ncats\napple\n")); err != nil {
+		t.Fatalf("unable to write input: %s", err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatalf("unable to write input: %s", err)
+	}
+	if err := file.Close(); err != nil {
+		t.Fatalf("unable to write input: %s", err)
+	}
+
+	dbPath := filepath.Join(dir, "test.sqlite")
+	RunLoad([]string{"-i", inputPath, "-mi", "0", "-mf", "0", "-k", "1", "-embedder", "hash", "-db", dbPath})
+
+	words, err := word.SelectByModel(openTestDB(t, dbPath), embedding.NewHashEmbedder(0).Model())
+	if err != nil {
+		t.Fatalf("unable to read words: %s", err)
+	}
+	if len(words) != 6 {
+		t.Fatalf("expected 6 distinct words, got %d", len(words))
+	}
+	for _, w := range words {
+		if w.Word == "apple" && w.Frequency != 2 {
+			t.Errorf("expected apple to appear twice, got %d", w.Frequency)
+		}
+	}
+}
+
+func TestLoadQuantized(t *testing.T) {
+	for _, scheme := range []string{"int8", "int8-dim", "binary"} {
+		db := openTestDB(t, loadTestDB(t, "-quantize", scheme))
+
+		words, _ := word.SelectByModel(db, embedding.NewHashEmbedder(0).Model())
+		for _, w := range words {
+			if len(w.Quantized) == 0 {
+				t.Fatalf("%s: word %s is not quantized", scheme, w.Word)
+			}
+		}
+
+		// 保存的参数给出的近似分数与全精度内积一致：int8 为近似值，binary 为符号相同与不同的维度数之差
+		params, err := quant.GetParams(db)
+		if err != nil || params == nil || string(params.Scheme) != scheme {
+			t.Fatalf("%s: expected saved params, got %+v, %v", scheme, params, err)
+		}
+		query, _ := embedWord(embedding.NewHashEmbedder(0), "apple")
+		query = word.L2Normalize(query)
+		scorer := params.NewScorer(query)
+		for _, w := range words {
+			var dot, signs float64
+			for d, f := range w.NormalizedEmbedding {
+				dot += query[d] * f
+				if (query[d] > 0) == (f > 0) {
+					signs++
+				} else {
+					signs--
+				}
+			}
+			expected, tolerance := dot, 0.05
+			if scheme == "binary" {
+				expected, tolerance = signs, 0
+			}
+			if score := scorer(w.Quantized); math.Abs(score-expected) > tolerance {
+				t.Fatalf("%s: word %s scores %f, expected %f", scheme, w.Word, score, expected)
+			}
+		}
+
+		// 重新 load 且不量化时清除量化参数
+		if err := quantizeWords(db, quant.None); err != nil {
+			t.Fatalf("unable to clear quantization: %s", err)
+		}
+		if params, _ := quant.GetParams(db); params != nil {
+			t.Errorf("%s: params should be deleted", scheme)
+		}
+	}
+}
+
+func TestLoadIsReproducibleWithSeed(t *testing.T) {
+	assignments := func(args ...string) map[string]string {
+		db := openTestDB(t, loadTestDB(t, args...))
+		clusters, _ := cluster.GetClusters(db, nil)
+		anchors := map[uint]string{}
+		for _, c := range clusters {
+			anchors[c.ID] = c.AnchorWord
+		}
+		words, _ := word.SelectByModel(db, embedding.NewHashEmbedder(0).Model())
+		result := map[string]string{}
+		for _, w := range words {
+			result[w.Word] = anchors[w.ClusterID]
+		}
+		return result
+	}
+
+	for _, init := range []string{"kmeans++", "kmeans||"} {
+		first := assignments("-init", init, "-seed", "7", "-restarts", "2")
+		second := assignments("-init", init, "-seed", "7", "-restarts", "2")
+		if !maps.Equal(first, second) {
+			t.Fatalf("%s: clusters differ between loads with the same seed", init)
+		}
+	}
+}
+
+func TestLoadSpherical(t *testing.T) {
+	db := openTestDB(t, loadTestDB(t, "-algorithm", "spherical"))
+
+	clusters, _ := cluster.GetClusters(db, nil)
+	centers := map[uint]base.Float64Slice{}
+	for _, c := range clusters {
+		if c.Algorithm != "spherical" {
+			t.Errorf("cluster %d has algorithm %q", c.ID, c.Algorithm)
+		}
+		var norm float64
+		for _, f := range c.NormalizedEmbedding {
+			norm += f * f
+		}
+		if math.Abs(norm-1) > 1e-9 {
+			t.Errorf("cluster %d center has squared norm %f", c.ID, norm)
+		}
+		centers[c.ID] = c.NormalizedEmbedding
+	}
+
+	// 单词分到点积最大的中心，即余弦相似度最高的簇
+	words, _ := word.SelectByModel(db, embedding.NewHashEmbedder(0).Model())
+	for _, w := range words {
+		assigned := search.CosineSimilarity(w.NormalizedEmbedding, centers[w.ClusterID])
+		for id, center := range centers {
+			if sim := search.CosineSimilarity(w.NormalizedEmbedding, center); sim > assigned+1e-9 {
+				t.Errorf("word %s is in cluster %d but cluster %d is more similar", w.Word, w.ClusterID, id)
+			}
+		}
+	}
+}
+
+func TestLoadMiniBatch(t *testing.T) {
+	db := openTestDB(t, loadTestDB(t, "-kBatch", "32", "-kIters", "200", "-restarts", "3"))
+
+	clusters, _ := cluster.GetClusters(db, nil)
+	if len(clusters) != 4 {
+		t.Fatalf("expected 4 clusters, got %d", len(clusters))
+	}
+	// 最后一次分配使用全部单词而不只是最后一批
+	words, _ := word.SelectByModel(db, embedding.NewHashEmbedder(0).Model())
+	for _, w := range words {
+		assigned := slices.IndexFunc(clusters, func(c cluster.Cluster) bool { return c.ID == w.ClusterID })
+		if assigned < 0 {
+			t.Fatalf("word %s has no cluster", w.Word)
+		}
+		for _, c := range clusters {
+			if base.Distance(w.NormalizedEmbedding, c.NormalizedEmbedding) < base.Distance(w.NormalizedEmbedding, clusters[assigned].NormalizedEmbedding)-1e-12 {
+				t.Errorf("word %s is in cluster %d but cluster %d is closer", w.Word, w.ClusterID, c.ID)
+			}
+		}
+	}
+
+	// 批次大于单词数时按单词数抽取，两种批次都在达到最大批次数之前停止
+	fs := flag.NewFlagSet("load", flag.ContinueOnError)
+	flags := registerKMeansFlags(fs)
+	if err := fs.Parse([]string{"-k", "4", "-kBatch", "32", "-kIters", "200"}); err != nil {
+		t.Fatalf("unable to parse flags: %s", err)
+	}
+	opts, err := flags.options()
+	if err != nil || opts.BatchSize != 32 {
+		t.Fatalf("expected batch size 32, got %d, %v", opts.BatchSize, err)
+	}
+	for _, batchSize := range []int{32, 10 * len(words)} {
+		opts.BatchSize = batchSize
+		result := kmeans.KMeans(words, opts)
+		if !result.Converged || result.Iterations >= opts.MaxIter || len(result.History) != result.Iterations {
+			t.Errorf("batch size %d: expected to converge within %d batches, got %d batches, converged %t",
+				batchSize, opts.MaxIter, result.Iterations, result.Converged)
+		}
+		total := 0
+		for _, size := range result.Sizes {
+			total += size
+		}
+		if len(result.Assignments) != len(words) || total != len(words) {
+			t.Errorf("batch size %d: expected all %d words assigned, got sizes %v", batchSize, len(words), result.Sizes)
+		}
+	}
+}
+
+func TestLoadTreeAndQuery(t *testing.T) {
+	db := openTestDB(t, loadTestDB(t, "-levels", "2", "-sub-k", "3"))
+
+	clusters, _ := cluster.GetClusters(db, nil)
+	leaves := map[uint]bool{}
+	roots := 0
+	for _, c := range search.Leaves(clusters) {
+		leaves[c.ID] = true
+	}
+	for _, c := range clusters {
+		if c.AnchorWord == "" {
+			t.Errorf("cluster %d has no anchor word", c.ID)
+		}
+		if c.ParentID == nil {
+			roots++
+			if c.Level != 0 || leaves[c.ID] {
+				t.Errorf("root cluster %d should be at level 0 with children", c.ID)
+			}
+		} else if c.Level != 1 {
+			t.Errorf("child cluster %d at level %d", c.ID, c.Level)
+		}
+	}
+	if roots != 4 || len(leaves) <= 4 {
+		t.Fatalf("expected 4 roots with children, got %d roots and %d leaves", roots, len(leaves))
+	}
+	words, _ := word.SelectByModel(db, embedding.NewHashEmbedder(0).Model())
+	for _, w := range words {
+		if !leaves[w.ClusterID] {
+			t.Fatalf("word %s belongs to cluster %d which is not a leaf", w.Word, w.ClusterID)
+		}
+	}
+
+	results, err := queryTree(db, embedding.NewHashEmbedder(0), clusters, "apple", 2, 3)
+	if err != nil {
+		t.Fatalf("query failed: %s", err)
+	}
+	if len(results) == 0 || results[0].Word != "apples" {
+		t.Errorf("expected apples first, got %+v", results)
+	}
+
+	// 足够宽的 beam 探查全部叶子簇，等同于精确查询
+	matrix, _ := search.LoadMatrix(db, 0)
+	rows, err := benchRecall(matrix, clusters, nil, sampleQueries(matrix, 10, 1), 5, 5, nil, nil, []int{1, len(clusters)})
+	if err != nil {
+		t.Fatalf("benchmark failed: %s", err)
+	}
+	if len(rows) != 3 || rows[1].Method != searchTree || rows[2].Recall != 1 || rows[1].Recall > rows[2].Recall {
+		t.Errorf("unexpected tree rows %+v", rows)
+	}
+}
+
+// adcScore 按 ADC 计算的单词与查询的近似相似度及单词所属的簇
+type adcScore struct {
+	similarity float64
+	clusterID  uint
+}
+
+// adcScores 用数据库中的码本、簇中心与 PQ 编码独立计算每个单词的 ADC 相似度
+func adcScores(t *testing.T, db *gorm.DB, query base.Float64Slice) map[string]adcScore {
+	t.Helper()
+
+	codebook, err := pq.GetCodebook(db)
+	if err != nil || codebook == nil {
+		t.Fatalf("expected a codebook, got %v, %v", codebook, err)
+	}
+	clusters, _ := cluster.GetClusters(db, nil)
+	centers := map[uint]base.Float64Slice{}
+	for _, c := range clusters {
+		centers[c.ID] = c.NormalizedEmbedding
+	}
+
+	normalized := word.L2Normalize(query)
+	table := codebook.NewTable(normalized)
+	words, _ := word.SelectByModel(db, embedding.NewHashEmbedder(0).Model())
+	scores := make(map[string]adcScore, len(words))
+	for _, w := range words {
+		var centerSim float64
+		for d, f := range centers[w.ClusterID] {
+			centerSim += normalized[d] * f
+		}
+		scores[w.Word] = adcScore{centerSim + table.Score(w.PQCode), w.ClusterID}
+	}
+	return scores
+}
+
+// checkADCOrder 检查不重新排序的 PQ 查询结果按 ADC 相似度降序排列，
+// 相似度与独立计算的一致，且每个簇的第一个结果是簇内 ADC 相似度最高的单词
+func checkADCOrder(t *testing.T, results []search.SearchResult, scores map[string]adcScore) {
+	t.Helper()
+
+	if len(results) == 0 {
+		t.Fatal("expected results")
+	}
+	best := map[uint]float64{}
+	for _, s := range scores {
+		if sim, ok := best[s.clusterID]; !ok || s.similarity > sim {
+			best[s.clusterID] = s.similarity
+		}
+	}
+	seen := map[uint]bool{}
+	for i, r := range results {
+		s, ok := scores[r.Word]
+		if !ok || math.Abs(r.Similarity-s.similarity) > 1e-9 {
+			t.Errorf("word %s has similarity %f, expected ADC similarity %f", r.Word, r.Similarity, s.similarity)
+		}
+		if i > 0 && r.Similarity > results[i-1].Similarity {
+			t.Errorf("results are not in descending order: %+v", results)
+		}
+		if !seen[s.clusterID] && math.Abs(s.similarity-best[s.clusterID]) > 1e-9 {
+			t.Errorf("word %s is first in cluster %d with %f, expected %f", r.Word, s.clusterID, s.similarity, best[s.clusterID])
+		}
+		seen[s.clusterID] = true
+	}
+}
+
+func TestLoadPQ(t *testing.T) {
+	db := openTestDB(t, loadTestDB(t, "-pq-m", "16", "-pq-ks", "16"))
+
+	codebook, err := pq.GetCodebook(db)
+	if err != nil || codebook == nil || codebook.M != 16 || codebook.Ks != 16 {
+		t.Fatalf("expected a codebook with m 16 and ks 16, got %v, %v", codebook, err)
+	}
+	words, _ := word.SelectByModel(db, embedding.NewHashEmbedder(0).Model())
+	for _, w := range words {
+		if len(w.PQCode) != 16 {
+			t.Fatalf("word %s has code of %d bytes", w.Word, len(w.PQCode))
+		}
+	}
+
+	// 不重新排序时直接按 ADC 相似度返回
+	defer func(rerank int) { search.PQRerank = rerank }(search.PQRerank)
+	search.PQRerank = 0
+	embedder := embedding.NewHashEmbedder(0)
+	query, _ := embedWord(embedder, "apple")
+	clusters, _ := cluster.GetClusters(db, nil)
+	results, err := queryWords(db, embedder, clusters, "apple", "", 1, 5)
+	if err != nil {
+		t.Fatalf("query failed: %s", err)
+	}
+	checkADCOrder(t, results, adcScores(t, db, query))
+
+	// 关闭 PQ 时清除码本与编码
+	zero := 0
+	if err := trainPQ(db, &pqFlags{m: &zero}); err != nil {
+		t.Fatalf("unable to clear PQ: %s", err)
+	}
+	if codebook, _ := pq.GetCodebook(db); codebook != nil {
+		t.Errorf("codebook should be deleted")
+	}
+}
+
+func TestLoadWithHNSWAndQuery(t *testing.T) {
+	dbPath := loadTestDB(t, "-hnsw")
+	db := openTestDB(t, dbPath)
+
+	results, err := queryHNSW(db, embedding.NewHashEmbedder(0), indexPath(dbPath), "apple", 3, 32)
+	if err != nil {
+		t.Fatalf("query failed: %s", err)
+	}
+	if len(results) != 3 || results[0].Word != "apples" {
+		t.Fatalf("expected apples first, got %+v", results)
+	}
+
+	// 重新 load 后单词 ID 变化，旧索引不再可用
+	RunLoad([]string{"-i", testWordsPath, "-mi", "0", "-mf", "0", "-k", "4", "-embedder", "hash", "-db", dbPath})
+	if _, err := queryHNSW(db, embedding.NewHashEmbedder(0), indexPath(dbPath), "apple", 3, 32); err == nil {
+		t.Fatal("expected an error for stale index")
+	}
+
+	RunBuildIndex([]string{"-db", dbPath})
+	if _, err := queryHNSW(db, embedding.NewHashEmbedder(0), indexPath(dbPath), "apple", 3, 32); err != nil {
+		t.Fatalf("query after build-index failed: %s", err)
+	}
+}
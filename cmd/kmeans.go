@@ -0,0 +1,151 @@
+package cmd
+
+import (
+	"flag"
+	"fmt"
+	"slices"
+	"strconv"
+	"yggdrasil/sim-words/internal/kmeans"
+)
+
+// kmeansFlags load 与 import 共用的聚类参数
+type kmeansFlags struct {
+	k         *string
+	iters     *int
+	init      *string
+	algorithm *string
+	seed      *int64
+	restarts  *int
+
+	batchSize    *int
+	schedule     *string
+	learningRate *float64
+	tolerance    *float64
+	patience     *int
+
+	levels *int
+	subK   *int
+
+	anchors *int
+
+	tuneKs           *string
+	tuneSample       *int
+	silhouetteSample *int
+	criterion        *string
+}
+
+// treeOptions 层次聚类参数
+type treeOptions struct {
+	// levels 簇树的层数，1 为不分层
+	levels int
+	// subK 每个簇分出的子簇数
+	subK int
+}
+
+// tuneOptions -k auto 与 tune-k 的参数
+type tuneOptions struct {
+	ks []int
+	// sample 在最多这么多个随机单词上聚类
+	sample           int
+	silhouetteSample int
+	criterion        kmeans.Criterion
+}
+
+func registerKMeansFlags(fs *flag.FlagSet) *kmeansFlags {
+	return &kmeansFlags{
+		k:         fs.String("k", "10", "k of k-means, auto to choose from -tune-ks by -tune-criterion"),
+		iters:     fs.Int("kIters", 1000, "max iterations of k-means, or max batches of mini-batch k-means"),
+		init:      fs.String("init", string(kmeans.InitPlusPlus), "initial centers of k-means: random, kmeans++, kmeans||"),
+		algorithm: fs.String("algorithm", string(kmeans.Lloyd), "clustering algorithm: lloyd (euclidean), spherical (cosine)"),
+		seed:      fs.Int64("seed", 1, "random seed of k-means"),
+		restarts:  fs.Int("restarts", 1, "run k-means this many times and keep the result with the lowest inertia"),
+
+		batchSize:    fs.Int("kBatch", 0, "words per batch of mini-batch k-means, 0 to use all words every iteration"),
+		schedule:     fs.String("kSchedule", string(kmeans.ScheduleCount), "learning rate of mini-batch k-means: count (1/words seen by the center), decay (kLearningRate/sqrt(1+batch))"),
+		learningRate: fs.Float64("kLearningRate", 0.1, "initial learning rate of -kSchedule decay"),
+		tolerance:    fs.Float64("kTol", 1e-6, "stop k-means when no center moves more than this squared distance in an iteration or batch"),
+		patience:     fs.Int("kPatience", 10, "stop mini-batch k-means after this many batches without inertia improvement, 0 to disable"),
+
+		levels: fs.Int("levels", 1, "levels of the cluster tree, 1 for flat clusters"),
+		subK:   fs.Int("sub-k", 10, "child clusters per cluster below the top level of the cluster tree"),
+
+		anchors: fs.Int("anchors", 5, "representative words stored per cluster, both closest to the center and most frequent"),
+
+		tuneKs:           fs.String("tune-ks", "2,4,8,16,32,64,128,256", "comma separated k values tried by -k auto"),
+		tuneSample:       fs.Int("tune-sample", 10000, "cluster at most this many random words per k when choosing k, 0 for all"),
+		silhouetteSample: fs.Int("silhouette-sample", 1000, "compute the silhouette among this many of the sampled words, 0 for all"),
+		criterion:        fs.String("tune-criterion", string(kmeans.CriterionSilhouette), "choose k by: silhouette, davies-bouldin, elbow"),
+	}
+}
+
+// options 校验并转换为 k-means 参数，-k auto 时 K 为 0
+func (f *kmeansFlags) options() (kmeans.Options, error) {
+	k := 0
+	if *f.k != "auto" {
+		value, err := strconv.Atoi(*f.k)
+		if err != nil || value <= 0 {
+			return kmeans.Options{}, fmt.Errorf("invalid -k %s, expected a positive number or auto", *f.k)
+		}
+		k = value
+	}
+	init, err := kmeans.ParseInit(*f.init)
+	if err != nil {
+		return kmeans.Options{}, err
+	}
+	algorithm, err := kmeans.ParseAlgorithm(*f.algorithm)
+	if err != nil {
+		return kmeans.Options{}, err
+	}
+	schedule, err := kmeans.ParseSchedule(*f.schedule)
+	if err != nil {
+		return kmeans.Options{}, err
+	}
+	return kmeans.Options{
+		K:         k,
+		MaxIter:   *f.iters,
+		Init:      init,
+		Algorithm: algorithm,
+		Seed:      *f.seed,
+		Restarts:  *f.restarts,
+
+		BatchSize:    *f.batchSize,
+		Schedule:     schedule,
+		LearningRate: *f.learningRate,
+		Tolerance:    *f.tolerance,
+		Patience:     *f.patience,
+	}, nil
+}
+
+// tuning 校验并转换为选择 k 的参数。ks 按升序去重，肘部法依赖这个顺序
+func (f *kmeansFlags) tuning() (tuneOptions, error) {
+	ks, err := parseInts(*f.tuneKs)
+	if err != nil || len(ks) == 0 {
+		return tuneOptions{}, fmt.Errorf("invalid -tune-ks %s", *f.tuneKs)
+	}
+	slices.Sort(ks)
+	ks = slices.Compact(ks)
+	if ks[0] < 2 {
+		return tuneOptions{}, fmt.Errorf("invalid -tune-ks %s, expected every k to be at least 2", *f.tuneKs)
+	}
+	criterion, err := kmeans.ParseCriterion(*f.criterion)
+	if err != nil {
+		return tuneOptions{}, err
+	}
+	return tuneOptions{
+		ks:               ks,
+		sample:           *f.tuneSample,
+		silhouetteSample: *f.silhouetteSample,
+		criterion:        criterion,
+	}, nil
+}
+
+// tree 校验并转换为层次聚类参数
+func (f *kmeansFlags) tree() (treeOptions, error) {
+	if *f.levels < 1 {
+		return treeOptions{}, fmt.Errorf("invalid -levels %d, expected at least 1", *f.levels)
+	}
+	if *f.levels > 1 && *f.subK < 2 {
+		return treeOptions{}, fmt.Errorf("invalid -sub-k %d, expected at least 2", *f.subK)
+	}
+	return treeOptions{levels: *f.levels, subK: *f.subK}, nil
+}
@@ -0,0 +1,61 @@
+package cmd
+
+import (
+	"math"
+	"sort"
+	"yggdrasil/sim-words/internal/base"
+	"yggdrasil/sim-words/internal/cluster"
+	"yggdrasil/sim-words/internal/search"
+	"yggdrasil/sim-words/internal/word"
+)
+
+// labelCluster 用簇内单词 members 计算簇的代表词与统计量：离中心最近的 n 个单词、频率最高的 n 个单词、
+// 单词数、单词到中心的平均距离，以及与中心的余弦相似度乘以 log(1+频率) 最大的单词作为标签。
+// members 为空时不做修改
+func labelCluster(c *cluster.Cluster, members []word.WordEmbedding, n int) {
+	if len(members) == 0 {
+		return
+	}
+
+	distances := make([]float64, len(members))
+	var spread float64
+	for i, w := range members {
+		distances[i] = base.Distance(c.NormalizedEmbedding, w.NormalizedEmbedding)
+		spread += math.Sqrt(distances[i])
+	}
+
+	byDistance := make([]int, len(members))
+	byFrequency := make([]int, len(members))
+	for i := range members {
+		byDistance[i] = i
+		byFrequency[i] = i
+	}
+	sort.SliceStable(byDistance, func(i, j int) bool {
+		return distances[byDistance[i]] < distances[byDistance[j]]
+	})
+	sort.SliceStable(byFrequency, func(i, j int) bool {
+		return members[byFrequency[i]].Frequency > members[byFrequency[j]].Frequency
+	})
+
+	// 分数相同时取离中心较近的单词
+	label, labelScore := byDistance[0], math.Inf(-1)
+	for _, i := range byDistance {
+		w := members[i]
+		score := search.CosineSimilarity(c.NormalizedEmbedding, w.NormalizedEmbedding) * math.Log1p(float64(max(w.Frequency, 0)))
+		if score > labelScore {
+			label, labelScore = i, score
+		}
+	}
+
+	n = min(n, len(members))
+	c.Anchors = make(base.StringSlice, n)
+	c.FrequentWords = make(base.StringSlice, n)
+	for i := range n {
+		c.Anchors[i] = members[byDistance[i]].Word
+		c.FrequentWords[i] = members[byFrequency[i]].Word
+	}
+	c.AnchorWord = c.Anchors[0]
+	c.Label = members[label].Word
+	c.Size = len(members)
+	c.Spread = spread / float64(len(members))
+}
@@ -0,0 +1,92 @@
+package cmd
+
+import (
+	"math"
+	"slices"
+	"testing"
+	"yggdrasil/sim-words/internal/base"
+	"yggdrasil/sim-words/internal/cluster"
+	"yggdrasil/sim-words/internal/embedding"
+	"yggdrasil/sim-words/internal/word"
+)
+
+func TestLabelCluster(t *testing.T) {
+	newWord := func(text string, frequency int, vector ...float64) word.WordEmbedding {
+		w := word.WordEmbedding{Word: text, Frequency: frequency}
+		w.NormalizedEmbedding = vector
+		return w
+	}
+	members := []word.WordEmbedding{
+		newWord("pear", 1, 0.8, 0.6),
+		newWord("apple", 1000, 0.6, 0.8),
+		newWord("fig", 2, 1, 0),
+		newWord("quince", 0, 0.71, 0.71),
+	}
+	c := cluster.Cluster{Embedding: base.Embedding{NormalizedEmbedding: base.Float64Slice{0.7, 0.7}}}
+
+	labelCluster(&c, members, 2)
+	if !slices.Equal(c.Anchors, base.StringSlice{"quince", "pear"}) || c.AnchorWord != "quince" {
+		t.Errorf("expected quince and pear closest, got %v", c.Anchors)
+	}
+	if !slices.Equal(c.FrequentWords, base.StringSlice{"apple", "fig"}) {
+		t.Errorf("expected apple and fig most frequent, got %v", c.FrequentWords)
+	}
+	// apple 比 quince 稍远，但频率高得多
+	if c.Label != "apple" {
+		t.Errorf("expected apple as label, got %s", c.Label)
+	}
+	if c.Size != 4 {
+		t.Errorf("expected size 4, got %d", c.Size)
+	}
+	var spread float64
+	for _, w := range members {
+		spread += math.Sqrt(base.Distance(c.NormalizedEmbedding, w.NormalizedEmbedding))
+	}
+	if math.Abs(c.Spread-spread/4) > 1e-9 {
+		t.Errorf("expected spread %f, got %f", spread/4, c.Spread)
+	}
+
+	// 单词不足 n 个时全部保留，没有单词时不修改
+	labelCluster(&c, members[:1], 3)
+	if len(c.Anchors) != 1 || c.Label != "pear" || c.Size != 1 {
+		t.Errorf("expected only pear, got %+v", c)
+	}
+	labelCluster(&c, nil, 3)
+	if c.AnchorWord != "pear" {
+		t.Errorf("expected the labels to stay, got %+v", c)
+	}
+}
+
+func TestLoadLabelsClusters(t *testing.T) {
+	db := openTestDB(t, loadTestDB(t, "-anchors", "3"))
+
+	clusters, _ := cluster.GetClusters(db, nil)
+	total := 0
+	for _, c := range clusters {
+		words, _ := word.SelectByClusterID(db, c.ID)
+		texts := make([]string, len(words))
+		for i, w := range words {
+			texts[i] = w.Word
+		}
+		if c.Size != len(words) || c.Spread <= 0 {
+			t.Errorf("cluster %d has size %d and spread %f for %d words", c.ID, c.Size, c.Spread, len(words))
+		}
+		if len(c.Anchors) != min(3, len(words)) || c.Anchors[0] != c.AnchorWord || len(c.FrequentWords) != len(c.Anchors) {
+			t.Errorf("cluster %d has anchors %v and frequent words %v", c.ID, c.Anchors, c.FrequentWords)
+		}
+		for _, w := range append(append([]string{c.Label}, c.Anchors...), c.FrequentWords...) {
+			if !slices.Contains(texts, w) {
+				t.Errorf("word %s is not in cluster %d", w, c.ID)
+			}
+		}
+		total += c.Size
+	}
+	if count, _ := word.Count(db, ""); total != int(count) {
+		t.Errorf("expected sizes to add up to %d, got %d", count, total)
+	}
+
+	results, err := queryWords(db, embedding.NewHashEmbedder(0), clusters, "apple", "I like {{placeholder}}", 2, 3)
+	if err != nil || len(results) == 0 {
+		t.Fatalf("templated query failed: %+v, %v", results, err)
+	}
+}
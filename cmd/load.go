@@ -1,19 +1,21 @@
 package cmd
 
 import (
-	"bufio"
 	"flag"
 	"fmt"
 	"log"
-	"os"
-	"strconv"
+	"slices"
+	"sort"
 	"strings"
 	"unicode"
 	"yggdrasil/sim-words/internal/base"
 	"yggdrasil/sim-words/internal/cluster"
 	"yggdrasil/sim-words/internal/common"
+	"yggdrasil/sim-words/internal/dataset"
 	"yggdrasil/sim-words/internal/embedding"
+	"yggdrasil/sim-words/internal/job"
 	"yggdrasil/sim-words/internal/kmeans"
+	"yggdrasil/sim-words/internal/quant"
 	"yggdrasil/sim-words/internal/word"
 
 	"gorm.io/driver/sqlite"
@@ -24,9 +26,14 @@ func RunLoad(args []string) {
 	loadCmd := flag.NewFlagSet("load", flag.ExitOnError)
 
 	// flags
-	inputPath := loadCmd.String("input", "", "input file path")
+	inputPath := loadCmd.String("input", "", "input file path, - for stdin")
 	loadCmd.StringVar(inputPath, "i", "", "shorthand for -input")
 
+	format := loadCmd.String("format", "auto", "input format: auto, tsv, csv, jsonl, lines")
+	indexColumn := loadCmd.String("index-col", "", "index column, 1-based position or header name")
+	wordColumn := loadCmd.String("word-col", "", "word column, 1-based position or header name")
+	frequencyColumn := loadCmd.String("freq-col", "", "frequency column, 1-based position or header name")
+
 	minIndex := loadCmd.Int(
 		"min-index",
 		100,
@@ -49,17 +56,52 @@ func RunLoad(args []string) {
 	loadCmd.IntVar(minLength, "ml", 0, "shorthand for min-length")
 
 	// k-means flags
-	k := loadCmd.Int("k", 10, "k of k-means")
-	kIters := loadCmd.Int("kIters", 1000, "max iterations of k-means")
+	clusterFlags := registerKMeansFlags(loadCmd)
 
 	// database flags
 	dbFilePath := loadCmd.String("db", "data.sqlite", "path to storage data")
+	vectorEncoding := loadCmd.String("vector-encoding", string(base.EncodingFloat64), "storage encoding of vectors: float64, float32, json")
+	buildHNSW := loadCmd.Bool("hnsw", false, "also build the HNSW index saved as <db>.hnsw")
+	indexFlags := registerHNSWFlags(loadCmd)
+	quantize := loadCmd.String("quantize", string(quant.None), "also store quantized vectors for a fast first search pass: none, int8, int8-dim, binary")
+	productFlags := registerPQFlags(loadCmd)
+
+	// embedding flags
+	// 单词向量本身已保存在单词表中，load 默认不再写入缓存
+	embdFlags := registerEmbedderFlags(loadCmd, false)
+	batchSize := loadCmd.Int("batch-size", 1000, "number of words per embedding request")
+	concurrency := loadCmd.Int("concurrency", 4, "number of concurrent embedding requests")
+	rps := loadCmd.Float64("rps", 0, "max embedding requests per second, 0 for unlimited")
+	tps := loadCmd.Float64("tps", 0, "max embedded words per second, 0 for unlimited")
+	resume := loadCmd.Bool("resume", false, "keep words already embedded with the same model and only embed the rest")
 
 	// parse flags
 	loadCmd.Parse(args)
 
 	// === START LOADING ===
 
+	encoding, err := base.ParseVectorEncoding(*vectorEncoding)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	base.Encoding = encoding
+	scheme, err := quant.ParseScheme(*quantize)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	clusterOptions, err := clusterFlags.options()
+	if err != nil {
+		log.Fatalln(err)
+	}
+	tuning, err := clusterFlags.tuning()
+	if err != nil {
+		log.Fatalln(err)
+	}
+	tree, err := clusterFlags.tree()
+	if err != nil {
+		log.Fatalln(err)
+	}
+
 	// initialized db connection
 	db, err := gorm.Open(sqlite.Open(*dbFilePath), &gorm.Config{})
 	if err != nil {
@@ -67,101 +109,221 @@ func RunLoad(args []string) {
 	}
 	log.Printf("database inited")
 
+	embedder, err := embdFlags.build(db)
+	if err != nil {
+		log.Fatalf("unable to create embedder: %s", err)
+	}
+
 	// load from given file
-	rawRecords, err := loadFromFile(*inputPath, *minIndex, *minFrequency, *minLength)
+	inputOptions := dataset.Options{
+		Format:          dataset.Format(*format),
+		IndexColumn:     *indexColumn,
+		WordColumn:      *wordColumn,
+		FrequencyColumn: *frequencyColumn,
+	}
+	if *format == "auto" {
+		inputOptions.Format = dataset.DetectFormat(*inputPath)
+	}
+	rawRecords, err := loadFromFile(*inputPath, inputOptions, *minIndex, *minFrequency, *minLength)
 	if err != nil {
 		log.Fatalf("unable to load from %s: %s", *inputPath, err.Error())
 	}
 	log.Printf("read %d records", len(rawRecords))
 
-	// embed words
-	words, nil := embedWords(rawRecords, 1000)
+	// embed and save words
+	modelID := embdFlags.modelID(embedder)
+	words, err := embedAndSaveWords(db, embedder, modelID, *inputPath, rawRecords, *resume, embedding.PoolOptions{
+		BatchSize:         *batchSize,
+		Concurrency:       *concurrency,
+		RequestsPerSecond: *rps,
+		TextsPerSecond:    *tps,
+	})
 	if err != nil {
 		log.Fatalf("unable to embed: %s", err)
 	}
-	log.Printf("embed %d records", len(words))
+	log.Printf("%d words embedded with %s", len(words), modelID)
+	logCacheStats(embedder)
 
-	// nomalize embeddings
-	for i := range words {
-		words[i].NormalizedEmbedding = word.L2Normalize(words[i].RawEmbedding)
+	if clusterOptions.K == 0 {
+		clusterOptions.K, err = autoK(words, clusterOptions, tuning)
+		if err != nil {
+			log.Fatalf("unable to choose k: %s", err)
+		}
+	}
+
+	err = clusterWords(db, words, clusterOptions, tree, *clusterFlags.anchors)
+	if err != nil {
+		log.Fatalf("unable to cluster words: %s", err)
+	}
+
+	err = quantizeWords(db, scheme)
+	if err != nil {
+		log.Fatalf("unable to quantize words: %s", err)
 	}
 
-	// save words
-	err = word.SaveWords(db, words)
+	err = trainPQ(db, productFlags)
 	if err != nil {
-		log.Fatalf("unable to save words: %s", err)
+		log.Fatalf("unable to train product quantization: %s", err)
+	}
+
+	if *buildHNSW {
+		if err := buildIndex(db, indexPath(*dbFilePath), indexFlags); err != nil {
+			log.Fatalf("unable to build index: %s", err)
+		}
+	}
+
+	err = job.FinishJob(db, *inputPath, modelID)
+	if err != nil {
+		log.Fatalf("unable to finish load job: %s", err)
+	}
+}
+
+// clusterWords 对已保存的单词做 k-means 聚类，重建簇表并更新单词所属的簇，每个簇保存 anchors 个代表词。
+// tree.levels 大于 1 时递归地把每个簇再分为 tree.subK 个子簇，单词属于最底层的叶子簇
+func clusterWords(db *gorm.DB, words []word.WordEmbedding, opts kmeans.Options, tree treeOptions, anchors int) error {
+	if opts.K <= 0 || len(words) < opts.K {
+		return fmt.Errorf("cannot cluster %d words into %d clusters", len(words), opts.K)
+	}
+	if anchors < 1 {
+		return fmt.Errorf("invalid number of anchor words %d", anchors)
+	}
+
+	// 簇会整体重建
+	err := cluster.DeleteAll(db)
+	if err != nil {
+		return fmt.Errorf("unable to delete old clusters: %w", err)
+	}
+
+	members := make([]int, len(words))
+	for i := range members {
+		members[i] = i
+	}
+	leafIDs := make([]uint, len(words))
+	saved, err := clusterLevel(db, words, members, opts, tree, anchors, nil, leafIDs)
+	if err != nil {
+		return err
+	}
+	log.Printf("saved %d clusters", saved)
+
+	// assign clusters to words
+	err = word.BatchUpdateClusterIDs(db, words, leafIDs)
+	if err != nil {
+		return fmt.Errorf("unable to update cluster IDs: %w", err)
+	}
+	log.Printf("%d words updated", len(words))
+
+	return nil
+}
+
+// clusterLevel 把 members 指定的单词聚为 opts.K 个簇并保存为 parent 的子簇，需要时继续细分，
+// 叶子簇的 ID 写入 leafIDs。返回保存的簇数
+func clusterLevel(
+	db *gorm.DB,
+	words []word.WordEmbedding,
+	members []int,
+	opts kmeans.Options,
+	tree treeOptions,
+	anchors int,
+	parent *cluster.Cluster,
+	leafIDs []uint,
+) (int, error) {
+	level := 0
+	var parentID *uint
+	if parent != nil {
+		level = parent.Level + 1
+		parentID = &parent.ID
+	}
+
+	subset := make([]word.WordEmbedding, len(members))
+	for i, m := range members {
+		subset[i] = words[m]
 	}
-	log.Printf("saved %d words", len(words))
 
 	// k-means clustering
-	centers, clusterIndexies := kmeans.KMeans(words, *k, *kIters)
-	clusters := common.Map(centers, func(vector []float64) cluster.Cluster {
-		return cluster.Cluster{
+	result := kmeans.KMeans(subset, opts)
+	log.Printf("k-means of level %d finished after %d iterations: inertia %.6g, converged %t, %d empty clusters reseeded, cluster sizes %d - %d",
+		level, result.Iterations, result.Inertia, result.Converged, result.Reseeded, slices.Min(result.Sizes), slices.Max(result.Sizes))
+
+	// 代表词取自簇内单词，空簇的锚点词取全部单词中最近的
+	groups := make([][]int, len(result.Centers))
+	for i, index := range result.Assignments {
+		groups[index] = append(groups[index], members[i])
+	}
+	clusters := make([]cluster.Cluster, len(result.Centers))
+	for i, vector := range result.Centers {
+		clusters[i] = cluster.Cluster{
 			Embedding: base.Embedding{
 				NormalizedEmbedding: vector,
 			},
-			AnchorWord: findClosest(vector, words).Word,
+			Algorithm: string(opts.Algorithm),
+			ParentID:  parentID,
+			Level:     level,
 		}
-	})
+		if len(groups[i]) == 0 {
+			anchor := findClosest(vector, subset).Word
+			clusters[i].AnchorWord = anchor
+			clusters[i].Anchors = base.StringSlice{anchor}
+			clusters[i].Label = anchor
+			continue
+		}
+		labelCluster(&clusters[i], common.Map(groups[i], func(m int) word.WordEmbedding {
+			return words[m]
+		}), anchors)
+	}
 
 	// save clusters
-	err = cluster.SaveClusters(db, clusters)
+	err := cluster.SaveClusters(db, clusters)
 	if err != nil {
-		log.Fatalf("unable to save clusters: %s", err)
+		return 0, fmt.Errorf("unable to save clusters: %w", err)
 	}
-	log.Printf("saved %d clusters", len(clusters))
+	saved := len(clusters)
+
+	for i := range clusters {
+		group := groups[i]
+		if level+1 >= tree.levels || len(group) < 2 {
+			// 叶子簇
+			for _, m := range group {
+				leafIDs[m] = clusters[i].ID
+			}
+			continue
+		}
 
-	// assign clusters to words
-	err = word.BatchUpdateClusterIDs(db, words, common.Map(clusterIndexies, func(index uint) uint {
-		return clusters[index].ID
-	}))
-	if err != nil {
-		log.Fatalf("unable to update cluster IDs: %s", err)
+		sub := opts
+		sub.K = min(tree.subK, len(group))
+		count, err := clusterLevel(db, words, group, sub, tree, anchors, &clusters[i], leafIDs)
+		if err != nil {
+			return 0, err
+		}
+		saved += count
 	}
-	log.Printf("%d words updated", len(words))
-	// assign anchor words
-	for i, c := range clusters {
-		clusters[i].AnchorWord = findClosest(c.NormalizedEmbedding, common.Filter(words, func(word word.WordEmbedding) bool {
-			return word.ClusterID == c.ID
-		})).Word
-	}
-	err = cluster.UpdateClusters(db, clusters)
-	log.Printf("anchor words updated")
+	return saved, nil
 }
 
-func loadFromFile(path string, minIndex int, minFrequency int, minLength int) ([]word.RawRecord, error) {
+func loadFromFile(path string, opts dataset.Options, minIndex int, minFrequency int, minLength int) ([]word.RawRecord, error) {
 	freqMap := make(map[string]int)
 	indexMap := make(map[string]int)
 
-	file, err := os.Open(path)
+	file, err := dataset.Open(path)
 	if err != nil {
 		return nil, err
 	}
 	defer file.Close()
 
-	scanner := bufio.NewScanner(file)
-	for scanner.Scan() {
-		line := scanner.Text()
-		parts := strings.Split(line, "\t")
-		if len(parts) < 3 {
-			return nil, fmt.Errorf("invalid line: %s", line)
-		}
-
-		index, err := strconv.Atoi(parts[0])
-		if err != nil {
-			return nil, err
-		}
-		wordStr := cleanWord(strings.ToLower(parts[1]))
-		frequency, err := strconv.Atoi(parts[2])
-		if index <= minIndex || len(wordStr) < minLength {
-			continue
+	err = dataset.Read(file, opts, func(record word.RawRecord) error {
+		wordStr := cleanWord(strings.ToLower(record.Word))
+		if record.Index <= minIndex || len(wordStr) < minLength {
+			return nil
 		}
 
-		freqMap[wordStr] += frequency
+		freqMap[wordStr] += record.Frequency
 		if _, ok := indexMap[wordStr]; !ok {
 			// 保留第一次出现的下标
-			indexMap[wordStr] = index
+			indexMap[wordStr] = record.Index
 		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 
 	records := make([]word.RawRecord, 0, len(freqMap))
@@ -178,46 +340,122 @@ func loadFromFile(path string, minIndex int, minFrequency int, minLength int) ([
 		records = append(records, word.RawRecord{Index: index, Word: w, Frequency: f})
 	}
 
+	// 按输入中的顺序保存，相同的输入与种子才能得到相同的聚类
+	sort.Slice(records, func(i, j int) bool {
+		if records[i].Index != records[j].Index {
+			return records[i].Index < records[j].Index
+		}
+		return records[i].Word < records[j].Word
+	})
 	return records, nil
 }
 
-func embedWords(words []word.RawRecord, batchSize int) ([]word.WordEmbedding, error) {
-	embeddings := make([]word.WordEmbedding, len(words))
-	// 收集单词便于批量嵌入化
-	wordStrs := make([]string, len(words))
-	for i, w := range words {
-		wordStrs[i] = w.Word
-	}
-
-	// 分批嵌入化
-	batches := (len(words) + batchSize - 1) / batchSize // ceil(len/size)
-	log.Printf("got %d batches", batches)
+// embedAndSaveWords 分批嵌入化并在每批完成后立即保存，进度记录在 LoadJob 中。
+// 不续跑时清空已有单词；续跑时跳过已由同一模型嵌入的单词。返回该模型的全部单词
+func embedAndSaveWords(
+	db *gorm.DB,
+	embedder embedding.Embedder,
+	modelID string,
+	input string,
+	records []word.RawRecord,
+	resume bool,
+	opts embedding.PoolOptions,
+) ([]word.WordEmbedding, error) {
+	db.AutoMigrate(&word.WordEmbedding{})
+
+	var loadJob *job.LoadJob
+	var err error
+	total := len(records)
+	if resume {
+		loadJob, err = job.FindUnfinished(db, input, modelID)
+		if err != nil {
+			return nil, fmt.Errorf("unable to find unfinished job: %w", err)
+		}
 
-	for b := range batches {
-		start := b * batchSize
-		end := min((b+1)*batchSize, len(words))
-		log.Printf("batch #%d: %d - %d", b, start, end)
+		// 其他模型的向量不能与本次的向量一起聚类，其所属的簇也会被重建
+		deleted, err := word.DeleteByOtherModels(db, modelID)
+		if err != nil {
+			return nil, fmt.Errorf("unable to delete words of other models: %w", err)
+		}
+		if deleted > 0 {
+			log.Printf("resume: deleted %d words embedded with other models", deleted)
+		}
 
-		batch := words[start:end]
-		batchEmbd, err := embedding.Embedding(common.Map(batch, func(record word.RawRecord) string {
-			return record.Word
-		}))
+		embedded, err := word.SelectWordsByModel(db, modelID)
 		if err != nil {
-			return nil, err
+			return nil, fmt.Errorf("unable to read embedded words: %w", err)
+		}
+		embeddedSet := make(map[string]bool, len(embedded))
+		for _, w := range embedded {
+			embeddedSet[w] = true
 		}
-		for i, embd := range batchEmbd.Embeddings {
-			index := b*batchSize + i
-			embeddings[index] = word.WordEmbedding{
-				Word:      words[index].Word,
-				Frequency: words[index].Frequency,
+		records = common.Filter(records, func(record word.RawRecord) bool {
+			return !embeddedSet[record.Word]
+		})
+		log.Printf("resume: %d words already embedded, %d left", len(embedded), len(records))
+	} else {
+		if err := word.DeleteAll(db); err != nil {
+			return nil, fmt.Errorf("unable to delete old words: %w", err)
+		}
+	}
+
+	if loadJob == nil {
+		loadJob = &job.LoadJob{Input: input, Model: modelID}
+		if err := job.CreateJob(db, loadJob); err != nil {
+			return nil, fmt.Errorf("unable to create load job: %w", err)
+		}
+	}
+	// 进度按全部单词计算，续跑前已嵌入的单词计入 Embedded
+	loadJob.Status = job.StatusRunning
+	loadJob.Total = total
+	loadJob.Embedded = total - len(records)
+	loadJob.Error = ""
+	if err := job.UpdateJob(db, loadJob); err != nil {
+		return nil, fmt.Errorf("unable to update load job: %w", err)
+	}
+	log.Printf("load job #%d started", loadJob.ID)
+
+	// 每批完成后归一化并保存，中断时已完成的批次不会丢失
+	opts.OnBatch = func(start int, embeddings [][]float64) error {
+		batch := make([]word.WordEmbedding, len(embeddings))
+		for i, embd := range embeddings {
+			record := records[start+i]
+			batch[i] = word.WordEmbedding{
+				Word:      record.Word,
+				Frequency: record.Frequency,
+				Model:     modelID,
 				Embedding: base.Embedding{
-					RawEmbedding: embd,
+					RawEmbedding:        embd,
+					NormalizedEmbedding: word.L2Normalize(embd),
 				},
 			}
 		}
+		if err := word.SaveWords(db, batch); err != nil {
+			return fmt.Errorf("unable to save words: %w", err)
+		}
+
+		loadJob.Embedded += len(batch)
+		return job.UpdateJob(db, loadJob)
+	}
+
+	_, err = embedding.EmbedAll(embedder, common.Map(records, func(record word.RawRecord) string {
+		return record.Word
+	}), opts)
+	if err != nil {
+		loadJob.Status = job.StatusFailed
+		loadJob.Error = err.Error()
+		if updateErr := job.UpdateJob(db, loadJob); updateErr != nil {
+			log.Printf("unable to update load job: %s", updateErr)
+		}
+		return nil, fmt.Errorf("%w (%d / %d words saved, rerun with -resume to continue)", err, loadJob.Embedded, loadJob.Total)
 	}
 
-	return embeddings, nil
+	loadJob.Status = job.StatusEmbedded
+	if err := job.UpdateJob(db, loadJob); err != nil {
+		return nil, fmt.Errorf("unable to update load job: %w", err)
+	}
+
+	return word.SelectByModel(db, modelID)
 }
 
 func cleanWord(raw string) string {
@@ -230,7 +468,11 @@ func cleanWord(raw string) string {
 	return noSymbol.String()
 }
 
+// findClosest 返回离中心最近的单词，words 为空时返回零值
 func findClosest(clusterCenter base.Float64Slice, words []word.WordEmbedding) word.WordEmbedding {
+	if len(words) == 0 {
+		return word.WordEmbedding{}
+	}
 	closestIndex := 0
 	closestSim := base.Distance(clusterCenter, words[0].NormalizedEmbedding)
 	for i, w := range words {
@@ -0,0 +1,155 @@
+package cmd
+
+import (
+	"fmt"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"yggdrasil/sim-words/internal/cluster"
+	"yggdrasil/sim-words/internal/dataset"
+	"yggdrasil/sim-words/internal/embedding"
+	"yggdrasil/sim-words/internal/job"
+	"yggdrasil/sim-words/internal/kmeans"
+	"yggdrasil/sim-words/internal/word"
+)
+
+// failingEmbedder 第 failAfter 个批次之后全部失败，failAfter 为 0 时不失败
+type failingEmbedder struct {
+	*embedding.HashEmbedder
+	failAfter int32
+	calls     atomic.Int32
+}
+
+func (e *failingEmbedder) Embed(texts []string) ([][]float64, error) {
+	if e.failAfter > 0 && e.calls.Add(1) > e.failAfter {
+		return nil, fmt.Errorf("service unavailable")
+	}
+	return e.HashEmbedder.Embed(texts)
+}
+
+func TestEmbedAndSaveWordsResume(t *testing.T) {
+	db := openTestDB(t, filepath.Join(t.TempDir(), "test.sqlite"))
+	records, err := loadFromFile(testWordsPath, dataset.Options{}, 0, 0, 0)
+	if err != nil {
+		t.Fatalf("unable to read test words: %s", err)
+	}
+	opts := embedding.PoolOptions{BatchSize: 10, Concurrency: 1}
+	modelID := "hash-test"
+
+	// 第 3 批之后失败，前 3 批已保存
+	failing := &failingEmbedder{HashEmbedder: embedding.NewHashEmbedder(0), failAfter: 3}
+	_, err = embedAndSaveWords(db, failing, modelID, testWordsPath, records, false, opts)
+	if err == nil {
+		t.Fatalf("expected load to fail")
+	}
+	saved, _ := word.SelectWordsByModel(db, modelID)
+	if len(saved) != 30 {
+		t.Fatalf("expected 30 words saved before the failure, got %d", len(saved))
+	}
+	failedJob, _ := job.FindUnfinished(db, testWordsPath, modelID)
+	if failedJob == nil || failedJob.Status != job.StatusFailed || failedJob.Embedded != 30 || failedJob.Total != len(records) {
+		t.Fatalf("unexpected job after failure: %+v", failedJob)
+	}
+
+	// 续跑只嵌入剩余单词
+	resumed := &failingEmbedder{HashEmbedder: embedding.NewHashEmbedder(0)}
+	words, err := embedAndSaveWords(db, resumed, modelID, testWordsPath, records, true, opts)
+	if err != nil {
+		t.Fatalf("resume failed: %s", err)
+	}
+	if len(words) != len(records) {
+		t.Fatalf("expected %d words after resume, got %d", len(records), len(words))
+	}
+	seen := map[string]bool{}
+	for _, w := range words {
+		if seen[w.Word] {
+			t.Errorf("word %s saved twice", w.Word)
+		}
+		seen[w.Word] = true
+	}
+
+	resumedJob, _ := job.FindUnfinished(db, testWordsPath, modelID)
+	if resumedJob == nil || resumedJob.ID != failedJob.ID {
+		t.Fatalf("resume should continue job #%d, got %+v", failedJob.ID, resumedJob)
+	}
+	if resumedJob.Status != job.StatusEmbedded || resumedJob.Embedded != len(records) || resumedJob.Total != len(records) {
+		t.Errorf("unexpected job after resume: %+v", resumedJob)
+	}
+
+	if err := job.FinishJob(db, testWordsPath, modelID); err != nil {
+		t.Fatalf("unable to finish job: %s", err)
+	}
+	if unfinished, _ := job.FindUnfinished(db, testWordsPath, modelID); unfinished != nil {
+		t.Errorf("job should be done, got %+v", unfinished)
+	}
+}
+
+func TestResumeWithAnotherModel(t *testing.T) {
+	dbPath := loadTestDB(t)
+	db := openTestDB(t, dbPath)
+
+	// 用另一个维度续跑，旧模型的单词应被删除
+	RunLoad([]string{
+		"-i", testWordsPath,
+		"-mi", "0",
+		"-mf", "0",
+		"-k", "4",
+		"-embedder", "hash",
+		"-embd-dim", "64",
+		"-resume",
+		"-db", dbPath,
+	})
+
+	var models []string
+	db.Model(&word.WordEmbedding{}).Distinct("model").Pluck("model", &models)
+	if len(models) != 1 || models[0] != embedding.NewHashEmbedder(64).Model() {
+		t.Fatalf("expected only words of the new model, got %v", models)
+	}
+
+	var orphans int64
+	db.Model(&word.WordEmbedding{}).
+		Where("cluster_id NOT IN (SELECT id FROM clusters)").
+		Count(&orphans)
+	if orphans != 0 {
+		t.Errorf("expected no words pointing to deleted clusters, got %d", orphans)
+	}
+}
+
+func TestClusterWordsWithDuplicateVectors(t *testing.T) {
+	db := openTestDB(t, filepath.Join(t.TempDir(), "test.sqlite"))
+	db.AutoMigrate(&word.WordEmbedding{})
+
+	// 只有两种不同的向量，k=3 时必有空簇，不应 panic
+	var words []word.WordEmbedding
+	for i := range 6 {
+		w := word.WordEmbedding{Word: fmt.Sprintf("w%d", i)}
+		w.NormalizedEmbedding = []float64{float64(i % 2), float64(1 - i%2)}
+		words = append(words, w)
+	}
+	if err := word.SaveWords(db, words); err != nil {
+		t.Fatalf("unable to save words: %s", err)
+	}
+	words, _ = word.SelectByModel(db, "")
+	for seed := range int64(10) {
+		err := clusterWords(db, words, kmeans.Options{K: 3, MaxIter: 10, Init: kmeans.InitRandom, Seed: seed}, treeOptions{levels: 1}, 1)
+		if err != nil {
+			t.Fatalf("unable to cluster words: %s", err)
+		}
+		clusters, _ := cluster.GetClusters(db, nil)
+		for _, c := range clusters {
+			if c.AnchorWord == "" {
+				t.Fatalf("cluster %d has no anchor word", c.ID)
+			}
+		}
+	}
+
+	if err := clusterWords(db, words, kmeans.Options{K: 7, MaxIter: 10}, treeOptions{levels: 1}, 1); err == nil {
+		t.Fatal("expected an error when k exceeds the number of words")
+	}
+	if err := clusterWords(db, words, kmeans.Options{K: 2, MaxIter: 10}, treeOptions{levels: 1}, 0); err == nil {
+		t.Fatal("expected an error without anchor words")
+	}
+	if w := findClosest([]float64{1, 0}, nil); w.Word != "" {
+		t.Fatalf("expected the zero word, got %+v", w)
+	}
+}
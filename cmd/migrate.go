@@ -0,0 +1,168 @@
+package cmd
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"yggdrasil/sim-words/internal/base"
+	"yggdrasil/sim-words/internal/quant"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// vectorColumns 需要转换的表及其向量列
+var vectorColumns = []struct {
+	table   string
+	columns []string
+}{
+	{"word_embeddings", []string{"normalized_embedding", "raw_embedding"}},
+	{"clusters", []string{"normalized_embedding", "raw_embedding"}},
+	{"embedding_cache", []string{"embedding"}},
+}
+
+func RunMigrate(args []string) {
+	migrateCmd := flag.NewFlagSet("migrate", flag.ExitOnError)
+
+	dbFilePath := migrateCmd.String("db", "data.sqlite", "path to storage data")
+	encodingName := migrateCmd.String("vector-encoding", string(base.EncodingFloat64), "target vector encoding: float64, float32, json")
+	batchSize := migrateCmd.Int("batch-size", 1000, "number of rows converted per transaction")
+	quantize := migrateCmd.String("quantize", "", "also (re)quantize words: none, int8, int8-dim, binary; empty to keep as is")
+	vacuum := migrateCmd.Bool("vacuum", true, "run VACUUM afterwards to reclaim space")
+
+	migrateCmd.Parse(args)
+	if *batchSize <= 0 {
+		log.Fatalf("invalid -batch-size %d, expected at least 1", *batchSize)
+	}
+
+	encoding, err := base.ParseVectorEncoding(*encodingName)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	db, err := gorm.Open(sqlite.Open(*dbFilePath), &gorm.Config{})
+	if err != nil {
+		log.Fatalf("unable to open db connection: %s", err.Error())
+	}
+	log.Printf("database inited")
+	sizeBefore := fileSize(*dbFilePath)
+
+	for _, t := range vectorColumns {
+		if !db.Migrator().HasTable(t.table) {
+			continue
+		}
+		converted, err := migrateVectors(db, t.table, t.columns, encoding, *batchSize)
+		if err != nil {
+			log.Fatalf("unable to migrate %s: %s", t.table, err)
+		}
+		log.Printf("%s: converted %d rows to %s", t.table, converted, encoding)
+	}
+
+	if *quantize != "" {
+		scheme, err := quant.ParseScheme(*quantize)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		if err := quantizeWords(db, scheme); err != nil {
+			log.Fatalf("unable to quantize words: %s", err)
+		}
+	}
+
+	if *vacuum {
+		if err := db.Exec("VACUUM").Error; err != nil {
+			log.Fatalf("unable to vacuum database: %s", err)
+		}
+		log.Printf("database size %d -> %d bytes", sizeBefore, fileSize(*dbFilePath))
+	}
+}
+
+// migrateVectors 把表中不是目标编码的向量列按 rowid 分批重写，返回改写的行数
+func migrateVectors(db *gorm.DB, table string, columns []string, encoding base.VectorEncoding, batchSize int) (int, error) {
+	query := fmt.Sprintf("SELECT rowid, %s FROM %s WHERE rowid > ? ORDER BY rowid LIMIT ?", strings.Join(columns, ", "), table)
+	assignments := make([]string, len(columns))
+	for i, column := range columns {
+		assignments[i] = column + " = ?"
+	}
+	update := fmt.Sprintf("UPDATE %s SET %s WHERE rowid = ?", table, strings.Join(assignments, ", "))
+
+	converted := 0
+	var lastRowID int64
+	for {
+		rows, err := db.Raw(query, lastRowID, batchSize).Rows()
+		if err != nil {
+			return converted, err
+		}
+
+		type pending struct {
+			rowID  int64
+			values []any
+		}
+		batch := []pending{}
+		read := 0
+		for rows.Next() {
+			read++
+			raw := make([][]byte, len(columns))
+			dest := []any{&lastRowID}
+			for i := range raw {
+				dest = append(dest, &raw[i])
+			}
+			if err := rows.Scan(dest...); err != nil {
+				rows.Close()
+				return converted, err
+			}
+
+			changed := false
+			values := make([]any, len(columns))
+			for i, data := range raw {
+				if data == nil || base.EncodingOf(data) == encoding {
+					values[i] = data
+					continue
+				}
+				vector, err := base.DecodeVector(data)
+				if err != nil {
+					rows.Close()
+					return converted, fmt.Errorf("row %d column %s: %w", lastRowID, columns[i], err)
+				}
+				if values[i], err = base.EncodeVector(vector, encoding); err != nil {
+					rows.Close()
+					return converted, err
+				}
+				changed = true
+			}
+			if changed {
+				batch = append(batch, pending{lastRowID, values})
+			}
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return converted, err
+		}
+
+		err = db.Transaction(func(tx *gorm.DB) error {
+			for _, p := range batch {
+				if err := tx.Exec(update, append(p.values, p.rowID)...).Error; err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return converted, err
+		}
+		converted += len(batch)
+
+		if read < batchSize {
+			return converted, nil
+		}
+	}
+}
+
+func fileSize(path string) int64 {
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0
+	}
+	return info.Size()
+}
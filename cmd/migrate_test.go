@@ -0,0 +1,94 @@
+package cmd
+
+import (
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+	"yggdrasil/sim-words/internal/base"
+	"yggdrasil/sim-words/internal/cluster"
+	"yggdrasil/sim-words/internal/embedding"
+	"yggdrasil/sim-words/internal/word"
+)
+
+func countEncoding(t *testing.T, dbPath string, table string, encoding base.VectorEncoding) (int, int) {
+	t.Helper()
+
+	var rows [][]byte
+	openTestDB(t, dbPath).Raw("SELECT normalized_embedding FROM " + table).Scan(&rows)
+	matched := 0
+	for _, data := range rows {
+		if base.EncodingOf(data) == encoding {
+			matched++
+		}
+	}
+	return matched, len(rows)
+}
+
+func TestMigrateFromJSON(t *testing.T) {
+	dbPath := loadTestDB(t, "-vector-encoding", "json")
+	defer func() { base.Encoding = base.EncodingFloat64 }()
+
+	if matched, total := countEncoding(t, dbPath, "word_embeddings", base.EncodingJSON); matched != total || total == 0 {
+		t.Fatalf("expected all %d words stored as JSON, got %d", total, matched)
+	}
+	db := openTestDB(t, dbPath)
+	before, _ := word.SelectByModel(db, embedding.NewHashEmbedder(0).Model())
+
+	RunMigrate([]string{"-db", dbPath, "-vector-encoding", "float32", "-batch-size", "10"})
+
+	for _, table := range []string{"word_embeddings", "clusters"} {
+		if matched, total := countEncoding(t, dbPath, table, base.EncodingFloat32); matched != total || total == 0 {
+			t.Errorf("%s: expected all %d rows stored as float32, got %d", table, total, matched)
+		}
+	}
+
+	after, err := word.SelectByModel(db, embedding.NewHashEmbedder(0).Model())
+	if err != nil {
+		t.Fatalf("unable to read migrated words: %s", err)
+	}
+	if len(after) != len(before) {
+		t.Fatalf("expected %d words, got %d", len(before), len(after))
+	}
+	for i := range before {
+		for d := range before[i].RawEmbedding {
+			if float32(before[i].RawEmbedding[d]) != float32(after[i].RawEmbedding[d]) {
+				t.Fatalf("word %s changed at %d", before[i].Word, d)
+			}
+		}
+	}
+
+	// 迁移后仍可查询
+	clusters, _ := cluster.GetClusters(db, nil)
+	results, err := queryWords(db, embedding.NewHashEmbedder(0), clusters, "apple", "", len(clusters), 3)
+	if err != nil || len(results) == 0 || results[0].Word != "apples" {
+		t.Errorf("expected apples first, got %+v %v", results, err)
+	}
+
+	// 已是目标编码的行不会再改写
+	converted, err := migrateVectors(db, "word_embeddings", []string{"normalized_embedding", "raw_embedding"}, base.EncodingFloat32, 10)
+	if err != nil || converted != 0 {
+		t.Errorf("expected nothing to convert, got %d %v", converted, err)
+	}
+}
+
+func TestMigrateRejectsBatchSize(t *testing.T) {
+	// RunMigrate 以 log.Fatal 退出，在子进程中运行
+	if size := os.Getenv("MIGRATE_BATCH_SIZE"); size != "" {
+		RunMigrate([]string{"-db", os.Getenv("MIGRATE_DB"), "-batch-size", size})
+		return
+	}
+
+	dbPath := loadTestDB(t)
+	for _, size := range []string{"0", "-1"} {
+		cmd := exec.Command(os.Args[0], "-test.run=^TestMigrateRejectsBatchSize$")
+		cmd.Env = append(os.Environ(), "MIGRATE_BATCH_SIZE="+size, "MIGRATE_DB="+dbPath)
+		output, err := cmd.CombinedOutput()
+		if _, ok := err.(*exec.ExitError); !ok {
+			t.Fatalf("expected -batch-size %s to exit with an error, got %v", size, err)
+		}
+		if !strings.Contains(string(output), "invalid -batch-size") {
+			t.Errorf("expected a usage error for -batch-size %s, got %s", size, output)
+		}
+	}
+}
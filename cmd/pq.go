@@ -0,0 +1,113 @@
+package cmd
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"math/rand"
+	"yggdrasil/sim-words/internal/base"
+	"yggdrasil/sim-words/internal/cluster"
+	"yggdrasil/sim-words/internal/pq"
+	"yggdrasil/sim-words/internal/word"
+
+	"gorm.io/gorm"
+)
+
+// pqTrainSamples 训练码本最多使用的残差数
+const pqTrainSamples = 65536
+
+// pqFlags load 与 import 共用的乘积量化参数
+type pqFlags struct {
+	m     *int
+	ks    *int
+	iters *int
+	seed  *int64
+}
+
+func registerPQFlags(fs *flag.FlagSet) *pqFlags {
+	return &pqFlags{
+		m:     fs.Int("pq-m", 0, "subspaces of product quantization codes on cluster residuals, must divide the dimension, 0 to disable"),
+		ks:    fs.Int("pq-ks", 256, "centroids per subspace of product quantization, at most 256"),
+		iters: fs.Int("pq-iters", 25, "k-means iterations per subspace when training product quantization"),
+		seed:  fs.Int64("pq-seed", 1, "random seed of product quantization training"),
+	}
+}
+
+// trainPQ 在单词向量与所属簇中心的残差上训练码本并为全部单词编码，m 为 0 时清除码本和编码
+func trainPQ(db *gorm.DB, flags *pqFlags) error {
+	db.AutoMigrate(&word.WordEmbedding{})
+	if *flags.m == 0 {
+		if err := pq.DeleteCodebook(db); err != nil {
+			return fmt.Errorf("unable to delete PQ codebook: %w", err)
+		}
+		return word.ClearPQCodes(db)
+	}
+
+	clusters, err := cluster.GetClusters(db, nil)
+	if err != nil {
+		return fmt.Errorf("unable to get clusters: %w", err)
+	}
+	centers := map[uint]base.Float64Slice{}
+	for _, c := range clusters {
+		centers[c.ID] = c.NormalizedEmbedding
+	}
+	residual := func(w word.WordEmbedding) ([]float64, error) {
+		center, ok := centers[w.ClusterID]
+		if !ok {
+			return nil, fmt.Errorf("word %s has no cluster", w.Word)
+		}
+		return residual(w.NormalizedEmbedding, center), nil
+	}
+
+	// 第一遍用蓄水池抽样选出训练用的残差
+	r := rand.New(rand.NewSource(*flags.seed))
+	var samples [][]float64
+	seen := 0
+	err = word.FindInBatches(db, "", 1000, func(words []word.WordEmbedding) error {
+		for _, w := range words {
+			v, err := residual(w)
+			if err != nil {
+				return err
+			}
+			seen++
+			if len(samples) < pqTrainSamples {
+				samples = append(samples, v)
+			} else if i := r.Intn(seen); i < pqTrainSamples {
+				samples[i] = v
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("unable to read words: %w", err)
+	}
+
+	codebook, err := pq.Train(samples, *flags.m, *flags.ks, *flags.iters, *flags.seed)
+	if err != nil {
+		return fmt.Errorf("unable to train PQ codebook: %w", err)
+	}
+	log.Printf("PQ codebook trained on %d residuals: m=%d, ks=%d", len(samples), codebook.M, codebook.Ks)
+
+	// 第二遍写入编码
+	encoded := 0
+	err = word.FindInBatches(db, "", 1000, func(words []word.WordEmbedding) error {
+		for i := range words {
+			v, err := residual(words[i])
+			if err != nil {
+				return err
+			}
+			words[i].PQCode = codebook.Encode(v)
+		}
+		encoded += len(words)
+		return word.UpdatePQCodes(db, words)
+	})
+	if err != nil {
+		return fmt.Errorf("unable to save PQ codes: %w", err)
+	}
+
+	if err := pq.SaveCodebook(db, codebook); err != nil {
+		return fmt.Errorf("unable to save PQ codebook: %w", err)
+	}
+	log.Printf("%d words encoded with %d bytes each", encoded, codebook.M)
+	return nil
+}
@@ -0,0 +1,54 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"yggdrasil/sim-words/internal/quant"
+	"yggdrasil/sim-words/internal/word"
+
+	"gorm.io/gorm"
+)
+
+// quantizeWords 量化全部单词的 NormalizedEmbedding 并保存量化参数，scheme 为 None 时清除量化结果
+func quantizeWords(db *gorm.DB, scheme quant.Scheme) error {
+	db.AutoMigrate(&word.WordEmbedding{})
+	if scheme == quant.None {
+		if err := quant.DeleteParams(db); err != nil {
+			return fmt.Errorf("unable to delete quantization params: %w", err)
+		}
+		return word.ClearQuantized(db)
+	}
+
+	// 第一遍统计量化参数
+	params := &quant.Params{Scheme: scheme}
+	err := word.FindInBatches(db, "", 1000, func(words []word.WordEmbedding) error {
+		for _, w := range words {
+			if err := params.Fit(w.NormalizedEmbedding); err != nil {
+				return fmt.Errorf("word %s: %w", w.Word, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("unable to train quantization params: %w", err)
+	}
+
+	// 第二遍写入量化向量
+	quantized := 0
+	err = word.FindInBatches(db, "", 1000, func(words []word.WordEmbedding) error {
+		for i := range words {
+			words[i].Quantized = params.Encode(words[i].NormalizedEmbedding)
+		}
+		quantized += len(words)
+		return word.UpdateQuantized(db, words)
+	})
+	if err != nil {
+		return fmt.Errorf("unable to save quantized vectors: %w", err)
+	}
+
+	if err := quant.SaveParams(db, params); err != nil {
+		return fmt.Errorf("unable to save quantization params: %w", err)
+	}
+	log.Printf("%d words quantized with %s", quantized, scheme)
+	return nil
+}
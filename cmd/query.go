@@ -2,6 +2,7 @@ package cmd
 
 import (
 	"flag"
+	"fmt"
 	"log"
 	"yggdrasil/sim-words/internal/base"
 	"yggdrasil/sim-words/internal/cluster"
@@ -23,18 +24,34 @@ func RunQuery(args []string) {
 
 	dbFilePath := queryCmd.String("db", "data.sqlite", "path to storage data")
 
+	searchMode := queryCmd.String("search", searchClusters, "search method: clusters, tree, hnsw, exact")
+	beam := queryCmd.Int("beam", 4, "clusters kept per level of -search tree")
+	ef := queryCmd.Int("ef", 64, "search width of -search hnsw, at least l")
+	indexFile := queryCmd.String("index", "", "HNSW index path, default <db>.hnsw")
+	rescore := queryCmd.Int("rescore", search.RescoreFactor, "rescore this many times l candidates per cluster when quantized, 0 to skip quantized vectors")
+	pqRerank := queryCmd.Int("pq-rerank", search.PQRerank, "re-rank this many times l candidates per cluster exactly when PQ encoded, 0 to return approximate similarities, -1 to skip PQ codes")
+	templateAnchors := queryCmd.Int("template-anchors", search.TemplateAnchors, "representative words per cluster embedded with the template, their similarities are averaged")
+
+	embdFlags := registerEmbedderFlags(queryCmd, true)
+
 	queryCmd.Parse(args)
+	search.RescoreFactor = *rescore
+	search.PQRerank = *pqRerank
+	search.TemplateAnchors = *templateAnchors
 
 	// 强制非空检查
 	if *query == "" {
 		log.Fatalln("query cannot be empty. Use -q <keyword>")
 	}
 	log.Printf("query %s with k=%d, l=%d", *query, *k, *l)
-
-	// 嵌入化查询字符
-	embd, err := embedWord(*query)
-	if err != nil {
-		log.Fatalf("unable to embed query string: %s", *query)
+	if *searchMode != searchClusters && *searchMode != searchTree && *searchMode != searchHNSW && *searchMode != searchExact {
+		log.Fatalf("unknown search method %s", *searchMode)
+	}
+	if *searchMode != searchClusters && *template != "" {
+		log.Fatalln("templates are only supported with -search clusters")
+	}
+	if *indexFile == "" {
+		*indexFile = indexPath(*dbFilePath)
 	}
 
 	// 初始化数据库连接
@@ -44,6 +61,11 @@ func RunQuery(args []string) {
 	}
 	log.Printf("database inited")
 
+	embedder, err := embdFlags.build(db)
+	if err != nil {
+		log.Fatalf("unable to create embedder: %s", err)
+	}
+
 	// 读取簇
 	clusters, err := cluster.GetClusters(db, nil)
 	if err != nil {
@@ -52,30 +74,96 @@ func RunQuery(args []string) {
 	log.Printf("read %d clusters", len(clusters))
 
 	// 查询
-	if *template == "" {
-		results, err := search.QueryWords(db, embd, clusters, *k, *l, false)
-		if err != nil {
-			log.Fatalf("unable to query words: %s", err)
-		}
-		for _, r := range results {
-			log.Printf("%s\t%.2g\t%d", r.Word, r.Similarity, r.Frequency)
-		}
-	} else {
+	if *template != "" {
 		log.Printf("query with template: %s", *template)
-		results, err := search.QueryWordsWithTemplate(db, *query, *template, clusters, *k, *l, false)
-		if err != nil {
-			log.Fatalf("unable to query words: %s", err)
-		}
-		for _, r := range results {
-			log.Printf("%s\t%.2g\t%d", r.Word, r.Similarity, r.Frequency)
-		}
 	}
+	var results []search.SearchResult
+	switch *searchMode {
+	case searchHNSW:
+		results, err = queryHNSW(db, embedder, *indexFile, *query, *l, *ef)
+	case searchExact:
+		results, err = queryExact(db, embedder, *query, *l)
+	case searchTree:
+		results, err = queryTree(db, embedder, clusters, *query, *beam, *l)
+	default:
+		results, err = queryWords(db, embedder, clusters, *query, *template, *k, *l)
+	}
+	if err != nil {
+		log.Fatalf("unable to query words: %s", err)
+	}
+	for _, r := range results {
+		log.Printf("%s\t%.2g\t%d", r.Word, r.Similarity, r.Frequency)
+	}
+	logCacheStats(embedder)
+}
+
+// queryWords 模板为空时直接按查询词向量查询，否则按模板查询
+func queryWords(
+	db *gorm.DB,
+	embedder embedding.Embedder,
+	clusters []cluster.Cluster,
+	query string,
+	template string,
+	k int,
+	l int,
+) ([]search.SearchResult, error) {
+	if template != "" {
+		return search.QueryWordsWithTemplate(db, embedder, query, template, clusters, k, l, false)
+	}
+
+	// 嵌入化查询字符
+	embd, err := embedWord(embedder, query)
+	if err != nil {
+		return nil, fmt.Errorf("unable to embed query string %s: %w", query, err)
+	}
+	return search.QueryWords(db, embd, clusters, k, l, false)
+}
+
+// queryTree 沿簇树向下探查
+func queryTree(db *gorm.DB, embedder embedding.Embedder, clusters []cluster.Cluster, query string, beam int, l int) ([]search.SearchResult, error) {
+	embd, err := embedWord(embedder, query)
+	if err != nil {
+		return nil, fmt.Errorf("unable to embed query string %s: %w", query, err)
+	}
+	return search.QueryTree(db, embd, clusters, beam, l, false)
+}
+
+// queryHNSW 载入全部单词和 HNSW 索引后查询
+func queryHNSW(db *gorm.DB, embedder embedding.Embedder, path string, query string, l int, ef int) ([]search.SearchResult, error) {
+	matrix, err := search.LoadMatrix(db, 0)
+	if err != nil {
+		return nil, fmt.Errorf("unable to load words: %w", err)
+	}
+	idx, err := loadIndex(path, matrix)
+	if err != nil {
+		return nil, err
+	}
+
+	embd, err := embedWord(embedder, query)
+	if err != nil {
+		return nil, fmt.Errorf("unable to embed query string %s: %w", query, err)
+	}
+	return matrix.QueryHNSW(idx, embd, l, ef, false)
+}
+
+// queryExact 载入全部单词后逐一打分
+func queryExact(db *gorm.DB, embedder embedding.Embedder, query string, l int) ([]search.SearchResult, error) {
+	matrix, err := search.LoadMatrix(db, 0)
+	if err != nil {
+		return nil, fmt.Errorf("unable to load words: %w", err)
+	}
+
+	embd, err := embedWord(embedder, query)
+	if err != nil {
+		return nil, fmt.Errorf("unable to embed query string %s: %w", query, err)
+	}
+	return matrix.QueryExact(embd, l, false)
 }
 
-func embedWord(str string) (base.Float64Slice, error) {
-	value, err := embedding.Embedding([]string{str})
+func embedWord(embedder embedding.Embedder, str string) (base.Float64Slice, error) {
+	value, err := embedder.Embed([]string{str})
 	if err != nil {
 		return nil, err
 	}
-	return value.Embeddings[0], nil
+	return value[0], nil
 }
@@ -0,0 +1,90 @@
+package cmd
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"yggdrasil/sim-words/internal/kmeans"
+	"yggdrasil/sim-words/internal/pq"
+	"yggdrasil/sim-words/internal/word"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func RunRecluster(args []string) {
+	reclusterCmd := flag.NewFlagSet("recluster", flag.ExitOnError)
+
+	dbFilePath := reclusterCmd.String("db", "data.sqlite", "path to storage data")
+	clusterFlags := registerKMeansFlags(reclusterCmd)
+	pqIters := reclusterCmd.Int("pq-iters", 25, "k-means iterations per subspace when retraining product quantization")
+	pqSeed := reclusterCmd.Int64("pq-seed", 1, "random seed of product quantization retraining")
+
+	reclusterCmd.Parse(args)
+
+	clusterOptions, err := clusterFlags.options()
+	if err != nil {
+		log.Fatalln(err)
+	}
+	tuning, err := clusterFlags.tuning()
+	if err != nil {
+		log.Fatalln(err)
+	}
+	tree, err := clusterFlags.tree()
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	db, err := gorm.Open(sqlite.Open(*dbFilePath), &gorm.Config{})
+	if err != nil {
+		log.Fatalf("unable to open db connection: %s", err.Error())
+	}
+	log.Printf("database inited")
+
+	// 残差随簇中心改变，已有码本时按原来的 m 与 ks 重新训练
+	codebook, err := pq.GetCodebook(db)
+	if err != nil {
+		log.Fatalf("unable to read PQ codebook: %s", err)
+	}
+	m, ks := 0, 0
+	if codebook != nil {
+		m, ks = codebook.M, codebook.Ks
+	}
+
+	err = recluster(db, clusterOptions, tuning, tree, *clusterFlags.anchors, &pqFlags{m: &m, ks: &ks, iters: pqIters, seed: pqSeed})
+	if err != nil {
+		log.Fatalf("unable to recluster: %s", err)
+	}
+}
+
+// recluster 读取已保存的单词向量重新聚类，在同一个事务中重建簇表、单词所属的簇与代表词，
+// 并重新训练 PQ 码本与编码。任何一步失败时原有的簇与编码保持不变。
+// 量化向量与 HNSW 索引只依赖单词向量，不受影响
+func recluster(db *gorm.DB, opts kmeans.Options, tuning tuneOptions, tree treeOptions, anchors int, product *pqFlags) error {
+	var words []word.WordEmbedding
+	err := word.FindInBatches(db, "", 1000, func(batch []word.WordEmbedding) error {
+		words = append(words, batch...)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("unable to read words: %w", err)
+	}
+	log.Printf("read %d words", len(words))
+
+	if opts.K == 0 {
+		opts.K, err = autoK(words, opts, tuning)
+		if err != nil {
+			return fmt.Errorf("unable to choose k: %w", err)
+		}
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := clusterWords(tx, words, opts, tree, anchors); err != nil {
+			return err
+		}
+		if err := trainPQ(tx, product); err != nil {
+			return fmt.Errorf("unable to train product quantization: %w", err)
+		}
+		return nil
+	})
+}
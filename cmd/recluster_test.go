@@ -0,0 +1,144 @@
+package cmd
+
+import (
+	"slices"
+	"testing"
+	"yggdrasil/sim-words/internal/cluster"
+	"yggdrasil/sim-words/internal/embedding"
+	"yggdrasil/sim-words/internal/kmeans"
+	"yggdrasil/sim-words/internal/pq"
+	"yggdrasil/sim-words/internal/word"
+
+	"gorm.io/gorm"
+)
+
+// partition 返回每个单词所属簇的首个单词，与簇 ID 无关，用于比较两次聚类是否相同
+func partition(t *testing.T, db *gorm.DB) map[string]string {
+	t.Helper()
+
+	words, err := word.SelectByModel(db, embedding.NewHashEmbedder(0).Model())
+	if err != nil {
+		t.Fatalf("unable to read words: %s", err)
+	}
+	first := map[uint]string{}
+	result := map[string]string{}
+	for _, w := range words {
+		if _, ok := first[w.ClusterID]; !ok {
+			first[w.ClusterID] = w.Word
+		}
+		result[w.Word] = first[w.ClusterID]
+	}
+	return result
+}
+
+func TestRecluster(t *testing.T) {
+	db := openTestDB(t, loadTestDB(t, "-pq-m", "16", "-pq-ks", "16"))
+	loaded := partition(t, db)
+
+	// 模拟上次聚类以来增删过单词
+	embedder := embedding.NewHashEmbedder(0)
+	if err := db.Model(&cluster.Cluster{}).Where("1 = 1").Update("changed", 3).Error; err != nil {
+		t.Fatalf("unable to update clusters: %s", err)
+	}
+
+	m, ks, iters, seed := 16, 16, 25, int64(1)
+	product := &pqFlags{m: &m, ks: &ks, iters: &iters, seed: &seed}
+	opts := kmeans.Options{K: 2, MaxIter: 100, Init: kmeans.InitPlusPlus, Seed: 1}
+	if err := recluster(db, opts, tuneOptions{}, treeOptions{levels: 1}, 3, product); err != nil {
+		t.Fatalf("unable to recluster: %s", err)
+	}
+
+	clusters, _ := cluster.GetClusters(db, nil)
+	if len(clusters) != 2 {
+		t.Fatalf("expected 2 clusters, got %d", len(clusters))
+	}
+	centers := map[uint]cluster.Cluster{}
+	total := 0
+	for _, c := range clusters {
+		if c.AnchorWord == "" || c.Changed != 0 || c.Size == 0 {
+			t.Errorf("cluster %d has anchor word %q, %d changed of %d words", c.ID, c.AnchorWord, c.Changed, c.Size)
+		}
+		centers[c.ID] = c
+		total += c.Size
+	}
+
+	// 全部单词指向新的簇，编码为与新簇中心的残差
+	codebook, err := pq.GetCodebook(db)
+	if err != nil || codebook == nil || codebook.M != 16 {
+		t.Fatalf("expected a codebook with m 16, got %+v, %v", codebook, err)
+	}
+	words, _ := word.SelectByModel(db, embedder.Model())
+	if total != len(words) {
+		t.Errorf("expected cluster sizes to add up to %d, got %d", len(words), total)
+	}
+	for _, w := range words {
+		c, ok := centers[w.ClusterID]
+		if !ok {
+			t.Fatalf("word %s has cluster %d which does not exist", w.Word, w.ClusterID)
+		}
+		if !slices.Equal(w.PQCode, codebook.Encode(residual(w.NormalizedEmbedding, c.NormalizedEmbedding))) {
+			t.Fatalf("word %s is not encoded against the center of cluster %d", w.Word, c.ID)
+		}
+	}
+
+	// 与 load 相同的参数得到与 load 相同的聚类
+	opts.K = 4
+	opts.MaxIter = 1000
+	if err := recluster(db, opts, tuneOptions{}, treeOptions{levels: 1}, 3, product); err != nil {
+		t.Fatalf("unable to recluster: %s", err)
+	}
+	reclustered := partition(t, db)
+	for w, first := range loaded {
+		if reclustered[w] != first {
+			t.Fatalf("word %s is clustered with %s, expected %s", w, reclustered[w], first)
+		}
+	}
+}
+
+func TestReclusterRollsBack(t *testing.T) {
+	db := openTestDB(t, loadTestDB(t, "-pq-m", "16", "-pq-ks", "16"))
+	embedder := embedding.NewHashEmbedder(0)
+	loadedClusters, _ := cluster.GetClusters(db, nil)
+	before, _, err := addWords(db, embedder, embedder.Model(), []string{"kumquat"}, 1, loadedClusters, false)
+	if err != nil {
+		t.Fatalf("unable to add words: %s", err)
+	}
+	loaded := partition(t, db)
+	codes := map[string][]byte{}
+	words, _ := word.SelectByModel(db, embedder.Model())
+	for _, w := range words {
+		codes[w.Word] = w.PQCode
+	}
+
+	// 7 不能整除向量维度，聚类完成后训练码本失败
+	m, ks, iters, seed := 7, 16, 25, int64(1)
+	opts := kmeans.Options{K: 2, MaxIter: 100, Init: kmeans.InitPlusPlus, Seed: 1}
+	err = recluster(db, opts, tuneOptions{}, treeOptions{levels: 1}, 3, &pqFlags{m: &m, ks: &ks, iters: &iters, seed: &seed})
+	if err == nil {
+		t.Fatal("expected an error from PQ training")
+	}
+
+	after, _ := cluster.GetClusters(db, nil)
+	if len(after) != len(before) {
+		t.Fatalf("expected the %d old clusters to remain, got %d", len(before), len(after))
+	}
+	for i := range after {
+		if after[i].ID != before[i].ID || after[i].Changed != before[i].Changed || after[i].Size != before[i].Size {
+			t.Errorf("cluster %d changed from %+v to %+v", before[i].ID, before[i], after[i])
+		}
+	}
+	for w, first := range partition(t, db) {
+		if loaded[w] != first {
+			t.Fatalf("word %s moved to the cluster of %s", w, first)
+		}
+	}
+	if codebook, _ := pq.GetCodebook(db); codebook == nil || codebook.M != 16 {
+		t.Errorf("expected the old codebook to remain, got %+v", codebook)
+	}
+	words, _ = word.SelectByModel(db, embedder.Model())
+	for _, w := range words {
+		if !slices.Equal(w.PQCode, codes[w.Word]) {
+			t.Fatalf("code of word %s changed", w.Word)
+		}
+	}
+}
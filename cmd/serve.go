@@ -1,13 +1,22 @@
 package cmd
 
 import (
+	"errors"
 	"flag"
 	"fmt"
 	"log"
 	"net/http"
+	"os"
 	"strconv"
+	"sync"
+	"time"
+	"yggdrasil/sim-words/internal/cache"
 	"yggdrasil/sim-words/internal/cluster"
+	"yggdrasil/sim-words/internal/common"
+	"yggdrasil/sim-words/internal/embedding"
+	"yggdrasil/sim-words/internal/hnsw"
 	"yggdrasil/sim-words/internal/search"
+	"yggdrasil/sim-words/internal/word"
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/driver/sqlite"
@@ -16,6 +25,38 @@ import (
 
 var db *gorm.DB
 var clusters = []cluster.Cluster{}
+var embedder embedding.Embedder
+
+// matrix 常驻内存的单词向量，未载入时查询走数据库
+var matrix *search.Matrix
+
+// index HNSW 索引，需要 matrix 提供向量
+var index *hnsw.Index
+
+// defaultSearch、defaultEf、defaultBeam 请求未指定 search、ef、beam 参数时的取值
+var defaultSearch = searchClusters
+var defaultEf = 64
+var defaultBeam = 4
+
+// modelID 新增单词的嵌入模型标识，driftThreshold 建议重新聚类的增删比例
+var modelID string
+var driftThreshold = 0.2
+
+// mu 增删单词时独占簇、matrix 与数据库，查询时共享
+var mu sync.RWMutex
+
+// wordsRequest POST 与 DELETE /words 的请求体
+type wordsRequest struct {
+	Words     []string `json:"words"`
+	Frequency int      `json:"frequency"`
+	Nudge     bool     `json:"nudge"`
+}
+
+// wordsResponse 增删的单词与之后的漂移
+type wordsResponse struct {
+	Words []wordChange
+	Drift driftReport
+}
 
 func RunServe(args []string) {
 	serveCmd := flag.NewFlagSet("query", flag.ExitOnError)
@@ -23,7 +64,30 @@ func RunServe(args []string) {
 	port := serveCmd.Int("p", 3000, "server port")
 	dbFilePath := serveCmd.String("db", "data.sqlite", "path to storage data")
 
+	inMemory := serveCmd.Bool("in-memory", true, "load all word vectors into memory at start-up")
+	maxMemory := serveCmd.Int64("max-memory", 4096, "memory budget in MiB for -in-memory, 0 for unlimited; falls back to the database when exceeded")
+	searchMode := serveCmd.String("search", searchClusters, "default search method: clusters, tree, hnsw, exact")
+	ef := serveCmd.Int("ef", 64, "default search width of hnsw")
+	beam := serveCmd.Int("beam", 4, "default clusters kept per level of tree search")
+	threshold := serveCmd.Float64("drift-threshold", 0.2, "advise recluster when the words added or removed since clustering exceed this ratio")
+	indexFile := serveCmd.String("index", "", "HNSW index path, default <db>.hnsw, loaded when it exists")
+	rescore := serveCmd.Int("rescore", search.RescoreFactor, "rescore this many times l candidates per cluster when quantized, 0 to skip quantized vectors")
+	pqRerank := serveCmd.Int("pq-rerank", search.PQRerank, "re-rank this many times l candidates per cluster exactly when PQ encoded, 0 to return approximate similarities, -1 to skip PQ codes")
+	templateAnchors := serveCmd.Int("template-anchors", search.TemplateAnchors, "representative words per cluster embedded with the template, their similarities are averaged")
+
+	embdFlags := registerEmbedderFlags(serveCmd, true)
+
 	serveCmd.Parse(args)
+	search.RescoreFactor = *rescore
+	search.PQRerank = *pqRerank
+	search.TemplateAnchors = *templateAnchors
+	defaultSearch = *searchMode
+	defaultEf = *ef
+	defaultBeam = *beam
+	driftThreshold = *threshold
+	if *indexFile == "" {
+		*indexFile = indexPath(*dbFilePath)
+	}
 
 	var err error
 	db, err = gorm.Open(sqlite.Open(*dbFilePath), &gorm.Config{})
@@ -32,6 +96,12 @@ func RunServe(args []string) {
 	}
 	log.Println("database inited")
 
+	embedder, err = embdFlags.build(db)
+	if err != nil {
+		log.Fatalf("unable to create embedder: %s", err)
+	}
+	modelID = embdFlags.modelID(embedder)
+
 	// 读取簇
 	clusters, err = cluster.GetClusters(db, nil)
 	if err != nil {
@@ -40,11 +110,41 @@ func RunServe(args []string) {
 	}
 	log.Printf("read %d clusters", len(clusters))
 
+	if *inMemory {
+		start := time.Now()
+		matrix, err = search.LoadMatrix(db, *maxMemory<<20)
+		if errors.Is(err, search.ErrMemoryBudget) {
+			log.Printf("%s, querying the database instead", err)
+		} else if err != nil {
+			log.Fatalf("unable to load words into memory: %s", err)
+		} else {
+			log.Printf("loaded %d words into memory in %s", matrix.Len(), time.Since(start))
+		}
+	}
+
+	// 索引文件存在时载入，-search hnsw 时必须载入成功
+	if matrix == nil && (defaultSearch == searchHNSW || defaultSearch == searchExact) {
+		log.Fatalf("-search %s requires -in-memory", defaultSearch)
+	}
+	if _, statErr := os.Stat(*indexFile); matrix != nil && (statErr == nil || defaultSearch == searchHNSW) {
+		index, err = loadIndex(*indexFile, matrix)
+		if err != nil && defaultSearch == searchHNSW {
+			log.Fatalf("unable to load index: %s", err)
+		} else if err != nil {
+			log.Printf("unable to load index, hnsw search disabled: %s", err)
+		} else {
+			log.Printf("loaded HNSW index %s", *indexFile)
+		}
+	}
+
 	r := gin.Default()
 
 	r.Use(ErrorHandler())
 
 	r.GET("/query", handleQuery)
+	r.GET("/cache/stats", handleCacheStats)
+	r.POST("/words", handleAddWords)
+	r.DELETE("/words", handleRemoveWords)
 
 	r.Run(fmt.Sprintf(":%d", *port))
 }
@@ -54,34 +154,73 @@ func handleQuery(c *gin.Context) {
 	lStr := c.DefaultQuery("l", "5")
 	query := c.DefaultQuery("q", "")
 	template := c.DefaultQuery("t", "")
-	log.Printf("query k=%s l=%s q=%s t=%s", kStr, lStr, query, template)
+	searchMode := c.DefaultQuery("search", defaultSearch)
+	efStr := c.DefaultQuery("ef", strconv.Itoa(defaultEf))
+	beamStr := c.DefaultQuery("beam", strconv.Itoa(defaultBeam))
+	log.Printf("query k=%s l=%s q=%s t=%s search=%s", kStr, lStr, query, template, searchMode)
 
 	k, err := strconv.Atoi(kStr)
 	if err != nil {
 		c.Error(fmt.Errorf("%s is not a valid number", kStr))
+		return
 	}
 
 	l, err := strconv.Atoi(lStr)
 	if err != nil {
 		c.Error(fmt.Errorf("%s is not a valid number", lStr))
+		return
+	}
+
+	ef, err := strconv.Atoi(efStr)
+	if err != nil {
+		c.Error(fmt.Errorf("%s is not a valid number", efStr))
+		return
+	}
+
+	beam, err := strconv.Atoi(beamStr)
+	if err != nil {
+		c.Error(fmt.Errorf("%s is not a valid number", beamStr))
+		return
 	}
 
 	// 查询
+	mu.RLock()
+	defer mu.RUnlock()
 	var results []search.SearchResult
 	if template == "" {
-		embd, err := embedWord(query)
+		embd, err := embedWord(embedder, query)
 		if err != nil {
 			c.Error(fmt.Errorf("unable to embed query string: %s", err))
+			return
 		}
 
-		results, err = search.QueryWords(db, embd, clusters, k, l, false)
+		switch {
+		case searchMode == searchHNSW && index != nil:
+			results, err = matrix.QueryHNSW(index, embd, l, ef, false)
+		case searchMode == searchHNSW:
+			err = fmt.Errorf("hnsw index is not loaded")
+		case searchMode == searchExact && matrix != nil:
+			results, err = matrix.QueryExact(embd, l, false)
+		case searchMode == searchExact:
+			err = fmt.Errorf("exact search requires -in-memory")
+		case searchMode == searchTree && matrix != nil:
+			results, err = matrix.QueryTree(embd, clusters, beam, l, false)
+		case searchMode == searchTree:
+			results, err = search.QueryTree(db, embd, clusters, beam, l, false)
+		case searchMode != searchClusters:
+			err = fmt.Errorf("unknown search method %s", searchMode)
+		case matrix != nil:
+			results, err = matrix.QueryWords(embd, clusters, k, l, false)
+		default:
+			results, err = search.QueryWords(db, embd, clusters, k, l, false)
+		}
 		if err != nil {
 			c.Error(fmt.Errorf("unable to query words: %s", err))
 			return
 		}
 	} else {
 		log.Printf("query with template: %s", template)
-		results, err = search.QueryWordsWithTemplate(db, query, template, clusters, k, l, false)
+		results, err = search.QueryWordsWithTemplate(db, embedder, query, template, clusters, k, l, false)
 		if err != nil {
 			c.Error(fmt.Errorf("unable to query words: %s", err))
 			return
@@ -94,6 +233,79 @@ func handleQuery(c *gin.Context) {
 	})
 }
 
+// handleAddWords 嵌入化并加入新单词，同时加入内存中的矩阵。HNSW 索引不会更新
+func handleAddWords(c *gin.Context) {
+	var req wordsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.Error(fmt.Errorf("invalid request: %s", err))
+		return
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	updated, added, err := addWords(db, embedder, modelID, req.Words, req.Frequency, clusters, req.Nudge)
+	if err != nil {
+		c.Error(fmt.Errorf("unable to add words: %s", err))
+		return
+	}
+	clusters = updated
+	if matrix != nil {
+		for _, w := range added {
+			matrix.Append(w)
+		}
+	}
+	log.Printf("added %d words", len(added))
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "ok",
+		"data":    wordsResponse{Words: changesOf(added), Drift: measureDrift(clusters, driftThreshold)},
+	})
+}
+
+// handleRemoveWords 删除单词，同时从内存中的矩阵移除
+func handleRemoveWords(c *gin.Context) {
+	var req wordsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.Error(fmt.Errorf("invalid request: %s", err))
+		return
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	updated, removed, err := removeWords(db, req.Words, clusters, req.Nudge)
+	if err != nil {
+		c.Error(fmt.Errorf("unable to remove words: %s", err))
+		return
+	}
+	clusters = updated
+	if matrix != nil {
+		matrix.Remove(common.Map(removed, func(w word.WordEmbedding) uint {
+			return w.ID
+		}))
+	}
+	log.Printf("removed %d words", len(removed))
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "ok",
+		"data":    wordsResponse{Words: changesOf(removed), Drift: measureDrift(clusters, driftThreshold)},
+	})
+}
+
+func handleCacheStats(c *gin.Context) {
+	embdCache, ok := embedder.(*cache.Embedder)
+	if !ok {
+		c.Error(fmt.Errorf("embedding cache is disabled"))
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "ok",
+		"data":    embdCache.Stats(),
+	})
+}
+
 func ErrorHandler() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		c.Next()
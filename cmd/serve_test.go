@@ -0,0 +1,88 @@
+package cmd
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"yggdrasil/sim-words/internal/cluster"
+	"yggdrasil/sim-words/internal/embedding"
+	"yggdrasil/sim-words/internal/hnsw"
+	"yggdrasil/sim-words/internal/search"
+
+	"github.com/gin-gonic/gin"
+)
+
+type queryResponse struct {
+	Success bool                  `json:"success"`
+	Message string                `json:"message"`
+	Data    []search.SearchResult `json:"data"`
+}
+
+// serveQuery 用给定的全局状态处理一次 /query 请求
+func serveQuery(t *testing.T, url string) queryResponse {
+	t.Helper()
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(ErrorHandler())
+	r.GET("/query", handleQuery)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, url, nil))
+
+	var response queryResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("invalid response %s: %s", w.Body.String(), err)
+	}
+	return response
+}
+
+func TestServeQueryInMemory(t *testing.T) {
+	db = openTestDB(t, loadTestDB(t))
+	embedder = embedding.NewHashEmbedder(0)
+	clusters, _ = cluster.GetClusters(db, nil)
+	defer func() { matrix = nil }()
+
+	matrix = nil
+	fromDB := serveQuery(t, "/query?q=apple&k=4&l=3")
+
+	var err error
+	matrix, err = search.LoadMatrix(db, 0)
+	if err != nil {
+		t.Fatalf("unable to load matrix: %s", err)
+	}
+	inMemory := serveQuery(t, "/query?q=apple&k=4&l=3")
+
+	if !inMemory.Success || len(inMemory.Data) == 0 || inMemory.Data[0].Word != "apples" {
+		t.Fatalf("expected apples first, got %+v", inMemory)
+	}
+	if len(inMemory.Data) != len(fromDB.Data) {
+		t.Fatalf("expected %+v, got %+v", fromDB.Data, inMemory.Data)
+	}
+	for i := range fromDB.Data {
+		if inMemory.Data[i].Word != fromDB.Data[i].Word {
+			t.Errorf("result #%d: expected %s, got %s", i, fromDB.Data[i].Word, inMemory.Data[i].Word)
+		}
+	}
+
+	if response := serveQuery(t, "/query?q=apple&k=x"); response.Success {
+		t.Errorf("expected an error for invalid k, got %+v", response)
+	}
+
+	response := serveQuery(t, "/query?q=apple&l=3&search=exact")
+	if !response.Success || len(response.Data) != 3 || response.Data[0].Word != "apples" {
+		t.Errorf("expected apples first, got %+v", response)
+	}
+
+	// 未载入索引时 hnsw 查询报错
+	if response := serveQuery(t, "/query?q=apple&search=hnsw"); response.Success {
+		t.Errorf("expected an error without index, got %+v", response)
+	}
+	index = hnsw.Build(matrix, matrix.IDs, 8, 50, 1)
+	defer func() { index = nil }()
+	response = serveQuery(t, "/query?q=apple&l=3&search=hnsw&ef=16")
+	if !response.Success || len(response.Data) != 3 || response.Data[0].Word != "apples" {
+		t.Errorf("expected apples first, got %+v", response)
+	}
+}
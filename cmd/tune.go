@@ -0,0 +1,102 @@
+package cmd
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"math/rand"
+	"yggdrasil/sim-words/internal/kmeans"
+	"yggdrasil/sim-words/internal/word"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func RunTuneK(args []string) {
+	tuneCmd := flag.NewFlagSet("tune-k", flag.ExitOnError)
+
+	dbFilePath := tuneCmd.String("db", "data.sqlite", "path to storage data")
+	clusterFlags := registerKMeansFlags(tuneCmd)
+
+	tuneCmd.Parse(args)
+
+	clusterOptions, err := clusterFlags.options()
+	if err != nil {
+		log.Fatalln(err)
+	}
+	tuning, err := clusterFlags.tuning()
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	db, err := gorm.Open(sqlite.Open(*dbFilePath), &gorm.Config{})
+	if err != nil {
+		log.Fatalf("unable to open db connection: %s", err.Error())
+	}
+	log.Printf("database inited")
+
+	// 只保留抽样的单词，不必载入整个词表
+	words, total, err := sampleWords(db, tuning.sample, clusterOptions.Seed)
+	if err != nil {
+		log.Fatalf("unable to read words: %s", err)
+	}
+	log.Printf("sampled %d of %d words", len(words), total)
+
+	k, err := autoK(words, clusterOptions, tuning)
+	if err != nil {
+		log.Fatalf("unable to choose k: %s", err)
+	}
+	fmt.Println(k)
+}
+
+// autoK 在抽样的单词上对 tuning.ks 中的每个 k 聚类，打印各项指标并按 tuning.criterion 选出 k。
+// tuning.ks 须按升序排列，任何一个 k 超出 [2, 抽样单词数] 时返回错误
+func autoK(words []word.WordEmbedding, opts kmeans.Options, tuning tuneOptions) (int, error) {
+	sample := words
+	if tuning.sample > 0 && len(words) > tuning.sample {
+		r := rand.New(rand.NewSource(opts.Seed))
+		sample = make([]word.WordEmbedding, tuning.sample)
+		for i, j := range r.Perm(len(words))[:tuning.sample] {
+			sample[i] = words[j]
+		}
+	}
+
+	// 每个 k 都必须能分出非空的簇
+	for _, k := range tuning.ks {
+		if k < 2 || k > len(sample) {
+			return 0, fmt.Errorf("k=%d in -tune-ks is out of range [2, %d], the number of sampled words", k, len(sample))
+		}
+	}
+
+	scores, err := kmeans.Tune(sample, tuning.ks, opts, tuning.silhouetteSample)
+	if err != nil {
+		return 0, err
+	}
+	log.Printf("k\tinertia\tsilhouette\tdavies-bouldin\titerations")
+	for _, s := range scores {
+		log.Printf("%d\t%.6g\t%.4f\t%.4f\t%d", s.K, s.Inertia, s.Silhouette, s.DaviesBouldin, s.Iterations)
+	}
+
+	k := kmeans.Choose(scores, tuning.criterion)
+	log.Printf("chose k=%d by %s", k, tuning.criterion)
+	return k, nil
+}
+
+// sampleWords 用蓄水池抽样从全部单词中随机保留至多 size 个，size 为 0 时保留全部。同时返回单词总数
+func sampleWords(db *gorm.DB, size int, seed int64) ([]word.WordEmbedding, int, error) {
+	r := rand.New(rand.NewSource(seed))
+	var sample []word.WordEmbedding
+	seen := 0
+	err := word.FindInBatches(db, "", 1000, func(words []word.WordEmbedding) error {
+		for _, w := range words {
+			seen++
+			if size <= 0 || len(sample) < size {
+				sample = append(sample, w)
+			} else if i := r.Intn(seen); i < size {
+				sample[i] = w
+			}
+		}
+		return nil
+	})
+	return sample, seen, err
+}
@@ -0,0 +1,73 @@
+package cmd
+
+import (
+	"flag"
+	"slices"
+	"testing"
+	"yggdrasil/sim-words/internal/cluster"
+	"yggdrasil/sim-words/internal/kmeans"
+)
+
+func TestLoadWithAutoK(t *testing.T) {
+	db := openTestDB(t, loadTestDB(t, "-k", "auto", "-tune-ks", "8,2,5,3,5", "-tune-criterion", "davies-bouldin"))
+
+	clusters, err := cluster.GetClusters(db, nil)
+	if err != nil {
+		t.Fatalf("unable to get clusters: %s", err)
+	}
+	if !slices.Contains([]int{2, 3, 5, 8}, len(clusters)) {
+		t.Fatalf("unexpected number of clusters %d", len(clusters))
+	}
+}
+
+func TestTuneK(t *testing.T) {
+	db := openTestDB(t, loadTestDB(t))
+
+	words, total, err := sampleWords(db, 50, 1)
+	if err != nil {
+		t.Fatalf("unable to sample words: %s", err)
+	}
+	if len(words) != 50 || total <= 50 {
+		t.Fatalf("expected 50 of more than 50 words, got %d of %d", len(words), total)
+	}
+	all, _, _ := sampleWords(db, 0, 1)
+	if len(all) != total {
+		t.Fatalf("expected all %d words, got %d", total, len(all))
+	}
+
+	opts := kmeans.Options{MaxIter: 50, Init: kmeans.InitPlusPlus, Seed: 1}
+	tuning := tuneOptions{ks: []int{2, 4, 6}, sample: 40, criterion: kmeans.CriterionElbow}
+	k, err := autoK(all, opts, tuning)
+	if err != nil {
+		t.Fatalf("unable to choose k: %s", err)
+	}
+	if !slices.Contains(tuning.ks, k) {
+		t.Fatalf("chose k=%d outside %v", k, tuning.ks)
+	}
+
+	tuning.ks = []int{2, 100}
+	if _, err := autoK(all, opts, tuning); err == nil {
+		t.Fatal("expected an error when a k exceeds the sample")
+	}
+}
+
+func TestTuningSortsKs(t *testing.T) {
+	tuning := func(ks string) (tuneOptions, error) {
+		fs := flag.NewFlagSet("tune-k", flag.ContinueOnError)
+		flags := registerKMeansFlags(fs)
+		if err := fs.Parse([]string{"-tune-ks", ks}); err != nil {
+			t.Fatalf("unable to parse flags: %s", err)
+		}
+		return flags.tuning()
+	}
+
+	options, err := tuning("64,8,16,8")
+	if err != nil || !slices.Equal(options.ks, []int{8, 16, 64}) {
+		t.Fatalf("expected 8,16,64, got %v, %v", options.ks, err)
+	}
+	for _, ks := range []string{"1,4", "0", "-2,8", "", "4,x"} {
+		if _, err := tuning(ks); err == nil {
+			t.Errorf("expected an error for -tune-ks %q", ks)
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package base
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+)
+
+// VectorEncoding 向量列的存储编码
+type VectorEncoding string
+
+const (
+	// EncodingJSON 早期版本使用的 JSON 数组文本
+	EncodingJSON VectorEncoding = "json"
+	// EncodingFloat64 带表头的小端 float64 二进制
+	EncodingFloat64 VectorEncoding = "float64"
+	// EncodingFloat32 带表头的小端 float32 二进制，体积减半，精度约 7 位有效数字
+	EncodingFloat32 VectorEncoding = "float32"
+)
+
+// Encoding 写入向量列时使用的编码，读取时按内容自动识别，不同编码的行可以共存
+var Encoding = EncodingFloat64
+
+// 二进制表头：3 字节魔数 "VEC"、1 字节版本、1 字节元素宽度（4 或 8）、3 字节保留、4 字节小端维度
+const (
+	vectorMagic      = "VEC"
+	vectorVersion    = 1
+	vectorHeaderSize = 12
+)
+
+// ParseVectorEncoding 解析命令行中的编码名
+func ParseVectorEncoding(name string) (VectorEncoding, error) {
+	switch encoding := VectorEncoding(name); encoding {
+	case EncodingJSON, EncodingFloat64, EncodingFloat32:
+		return encoding, nil
+	default:
+		return "", fmt.Errorf("unknown vector encoding %s", name)
+	}
+}
+
+// EncodeVector 按指定编码序列化向量
+func EncodeVector(v []float64, encoding VectorEncoding) ([]byte, error) {
+	width := 8
+	switch encoding {
+	case EncodingJSON:
+		return json.Marshal(v)
+	case EncodingFloat32:
+		width = 4
+	case EncodingFloat64:
+	default:
+		return nil, fmt.Errorf("unknown vector encoding %s", encoding)
+	}
+
+	data := make([]byte, vectorHeaderSize+width*len(v))
+	copy(data, vectorMagic)
+	data[3] = vectorVersion
+	data[4] = byte(width)
+	binary.LittleEndian.PutUint32(data[8:], uint32(len(v)))
+
+	body := data[vectorHeaderSize:]
+	for i, f := range v {
+		if width == 4 {
+			binary.LittleEndian.PutUint32(body[4*i:], math.Float32bits(float32(f)))
+		} else {
+			binary.LittleEndian.PutUint64(body[8*i:], math.Float64bits(f))
+		}
+	}
+	return data, nil
+}
+
+// EncodingOf 识别已序列化向量的编码
+func EncodingOf(data []byte) VectorEncoding {
+	if len(data) < vectorHeaderSize || !bytes.HasPrefix(data, []byte(vectorMagic)) {
+		return EncodingJSON
+	}
+	if data[4] == 4 {
+		return EncodingFloat32
+	}
+	return EncodingFloat64
+}
+
+// DecodeVector 反序列化向量，兼容早期的 JSON 文本
+func DecodeVector(data []byte) ([]float64, error) {
+	if EncodingOf(data) == EncodingJSON {
+		var v []float64
+		if err := json.Unmarshal(data, &v); err != nil {
+			return nil, err
+		}
+		return v, nil
+	}
+
+	if data[3] != vectorVersion {
+		return nil, fmt.Errorf("unsupported vector version %d", data[3])
+	}
+	width := int(data[4])
+	if width != 4 && width != 8 {
+		return nil, fmt.Errorf("invalid vector element width %d", width)
+	}
+	dim := int(binary.LittleEndian.Uint32(data[8:]))
+	body := data[vectorHeaderSize:]
+	if len(body) != width*dim {
+		return nil, fmt.Errorf("vector of dimension %d has %d bytes of data", dim, len(body))
+	}
+	if dim == 0 {
+		return nil, nil
+	}
+
+	v := make([]float64, dim)
+	for i := range v {
+		if width == 4 {
+			v[i] = float64(math.Float32frombits(binary.LittleEndian.Uint32(body[4*i:])))
+		} else {
+			v[i] = math.Float64frombits(binary.LittleEndian.Uint64(body[8*i:]))
+		}
+	}
+	return v, nil
+}
@@ -0,0 +1,94 @@
+package base
+
+import (
+	"math"
+	"slices"
+	"testing"
+)
+
+func TestEncodeDecodeVector(t *testing.T) {
+	v := []float64{0.1, -2.5, math.Pi, 0}
+
+	for _, encoding := range []VectorEncoding{EncodingJSON, EncodingFloat64, EncodingFloat32} {
+		data, err := EncodeVector(v, encoding)
+		if err != nil {
+			t.Fatalf("%s: encode failed: %s", encoding, err)
+		}
+		if EncodingOf(data) != encoding {
+			t.Errorf("%s: detected as %s", encoding, EncodingOf(data))
+		}
+
+		decoded, err := DecodeVector(data)
+		if err != nil {
+			t.Fatalf("%s: decode failed: %s", encoding, err)
+		}
+		for i := range v {
+			if encoding == EncodingFloat32 {
+				if float32(decoded[i]) != float32(v[i]) {
+					t.Errorf("%s: value %d expected %g, got %g", encoding, i, v[i], decoded[i])
+				}
+			} else if decoded[i] != v[i] {
+				t.Errorf("%s: value %d expected %g, got %g", encoding, i, v[i], decoded[i])
+			}
+		}
+	}
+
+	data, _ := EncodeVector(v, EncodingFloat32)
+	if len(data) != vectorHeaderSize+4*len(v) {
+		t.Errorf("unexpected float32 size %d", len(data))
+	}
+}
+
+func TestDecodeVectorErrors(t *testing.T) {
+	data, _ := EncodeVector([]float64{1, 2}, EncodingFloat64)
+	if _, err := DecodeVector(data[:len(data)-1]); err == nil {
+		t.Error("expected an error for truncated data")
+	}
+
+	data[3] = 9
+	if _, err := DecodeVector(data); err == nil {
+		t.Error("expected an error for unknown version")
+	}
+
+	if _, err := DecodeVector([]byte("[1,")); err == nil {
+		t.Error("expected an error for invalid JSON")
+	}
+}
+
+func TestFloat64SliceScan(t *testing.T) {
+	var f Float64Slice
+	if err := f.Scan("[1,2]"); err != nil || !slices.Equal(f, Float64Slice{1, 2}) {
+		t.Errorf("unable to scan JSON text: %v %v", f, err)
+	}
+	if err := f.Scan(nil); err != nil || f != nil {
+		t.Errorf("unable to scan NULL: %v %v", f, err)
+	}
+
+	value, _ := Float64Slice{3, 4}.Value()
+	if err := f.Scan(value); err != nil || !slices.Equal(f, Float64Slice{3, 4}) {
+		t.Errorf("unable to scan own value: %v %v", f, err)
+	}
+	if err := f.Scan(42); err == nil {
+		t.Error("expected an error for int")
+	}
+}
+
+func TestStringSliceScan(t *testing.T) {
+	var s StringSlice
+	value, _ := StringSlice{"apple", "pear"}.Value()
+	if err := s.Scan(value); err != nil || !slices.Equal(s, StringSlice{"apple", "pear"}) {
+		t.Errorf("unable to scan own value: %v %v", s, err)
+	}
+	if err := s.Scan([]byte(`["cat"]`)); err != nil || !slices.Equal(s, StringSlice{"cat"}) {
+		t.Errorf("unable to scan JSON bytes: %v %v", s, err)
+	}
+	if err := s.Scan(nil); err != nil || s != nil {
+		t.Errorf("unable to scan NULL: %v %v", s, err)
+	}
+	if value, _ := StringSlice(nil).Value(); value != nil {
+		t.Errorf("expected NULL for nil, got %v", value)
+	}
+	if err := s.Scan(42); err == nil {
+		t.Error("expected an error for int")
+	}
+}
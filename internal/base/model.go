@@ -13,6 +13,7 @@ type BaseModel struct {
 	ID uint `gorm:"primaryKey;autoIncrement"`
 }
 
+// Embedding 向量列。列类型名 json 为兼容旧数据库而保留，实际内容由 Encoding 决定
 type Embedding struct {
 	NormalizedEmbedding Float64Slice `gorm:"type:json"`
 	RawEmbedding        Float64Slice `gorm:"type:json"`
@@ -21,13 +22,54 @@ type Embedding struct {
 type Float64Slice []float64
 
 func (f Float64Slice) Value() (driver.Value, error) {
-	return json.Marshal(f)
+	return EncodeVector(f, Encoding)
 }
 
 func (f *Float64Slice) Scan(value interface{}) error {
-	bytes, ok := value.([]byte)
-	if !ok {
-		return fmt.Errorf("failed to scan Float64Slice")
+	var data []byte
+	switch v := value.(type) {
+	case nil:
+		*f = nil
+		return nil
+	case []byte:
+		data = v
+	case string:
+		data = []byte(v)
+	default:
+		return fmt.Errorf("failed to scan Float64Slice from %T", value)
 	}
-	return json.Unmarshal(bytes, f)
+
+	vector, err := DecodeVector(data)
+	if err != nil {
+		return err
+	}
+	*f = vector
+	return nil
+}
+
+// StringSlice 以 JSON 数组保存的字符串列表
+type StringSlice []string
+
+func (s StringSlice) Value() (driver.Value, error) {
+	if s == nil {
+		return nil, nil
+	}
+	data, err := json.Marshal([]string(s))
+	return string(data), err
+}
+
+func (s *StringSlice) Scan(value interface{}) error {
+	var data []byte
+	switch v := value.(type) {
+	case nil:
+		*s = nil
+		return nil
+	case []byte:
+		data = v
+	case string:
+		data = []byte(v)
+	default:
+		return fmt.Errorf("failed to scan StringSlice from %T", value)
+	}
+	return json.Unmarshal(data, (*[]string)(s))
 }
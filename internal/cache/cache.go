@@ -0,0 +1,28 @@
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+	"yggdrasil/sim-words/internal/base"
+)
+
+// Entry 嵌入缓存条目，以模型标识和完整文本（已套用模板）的哈希作为主键
+type Entry struct {
+	Key        string `gorm:"primaryKey"`
+	Model      string `gorm:"index"`
+	Text       string
+	Embedding  base.Float64Slice `gorm:"type:json"`
+	CreatedAt  time.Time
+	LastUsedAt time.Time `gorm:"index"`
+}
+
+func (Entry) TableName() string {
+	return "embedding_cache"
+}
+
+// Key 计算缓存键
+func Key(model string, text string) string {
+	sum := sha256.Sum256([]byte(model + "\x00" + text))
+	return hex.EncodeToString(sum[:])
+}
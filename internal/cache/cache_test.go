@@ -0,0 +1,202 @@
+package cache
+
+import (
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// countingEmbedder 以文本长度作为向量并记录每次收到的文本
+type countingEmbedder struct {
+	calls [][]string
+}
+
+func (e *countingEmbedder) Embed(texts []string) ([][]float64, error) {
+	e.calls = append(e.calls, texts)
+	result := make([][]float64, len(texts))
+	for i, text := range texts {
+		result[i] = []float64{float64(len(text)), 1}
+	}
+	return result, nil
+}
+
+func (e *countingEmbedder) Dimension() int { return 2 }
+
+func (e *countingEmbedder) Model() string { return "counting" }
+
+func openTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "test.sqlite")), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("unable to open db: %s", err)
+	}
+	if err := Migrate(db); err != nil {
+		t.Fatalf("unable to migrate: %s", err)
+	}
+	return db
+}
+
+func TestEmbedderHitsAndMisses(t *testing.T) {
+	db := openTestDB(t)
+	inner := &countingEmbedder{}
+	e, err := NewEmbedder(db, inner, "m", 0)
+	if err != nil {
+		t.Fatalf("unable to create embedder: %s", err)
+	}
+
+	first, err := e.Embed([]string{"a", "bb"})
+	if err != nil {
+		t.Fatalf("embed failed: %s", err)
+	}
+	second, err := e.Embed([]string{"bb", "ccc"})
+	if err != nil {
+		t.Fatalf("embed failed: %s", err)
+	}
+
+	if stats := e.Stats(); stats.Hits != 1 || stats.Misses != 3 {
+		t.Errorf("expected 1 hit and 3 misses, got %+v", stats)
+	}
+	if len(inner.calls) != 2 || !slices.Equal(inner.calls[1], []string{"ccc"}) {
+		t.Errorf("only missed texts should reach the inner embedder, got %v", inner.calls)
+	}
+	if !slices.Equal(first[1], second[0]) || second[1][0] != 3 {
+		t.Errorf("unexpected embeddings %v %v", first, second)
+	}
+
+	// 不同模型的条目互不影响
+	other, _ := NewEmbedder(db, inner, "other", 0)
+	other.Embed([]string{"a"})
+	if stats := other.Stats(); stats.Hits != 0 || stats.Misses != 1 {
+		t.Errorf("expected a miss for another model, got %+v", stats)
+	}
+}
+
+func TestEmbedderDuplicatesInBatch(t *testing.T) {
+	db := openTestDB(t)
+	inner := &countingEmbedder{}
+	e, _ := NewEmbedder(db, inner, "m", 0)
+
+	embeddings, err := e.Embed([]string{"a", "bb", "a", "a"})
+	if err != nil {
+		t.Fatalf("embed failed: %s", err)
+	}
+
+	if len(inner.calls) != 1 || !slices.Equal(inner.calls[0], []string{"a", "bb"}) {
+		t.Errorf("duplicates should be embedded once, got %v", inner.calls)
+	}
+	if len(embeddings) != 4 || !slices.Equal(embeddings[0], embeddings[3]) || embeddings[1][0] != 2 {
+		t.Errorf("unexpected embeddings %v", embeddings)
+	}
+	if count, _ := Count(db, "m"); count != 2 {
+		t.Errorf("expected 2 entries, got %d", count)
+	}
+}
+
+func saveTestEntries(t *testing.T, db *gorm.DB, lastUsed map[string]time.Time) {
+	t.Helper()
+
+	entries := []Entry{}
+	for text, at := range lastUsed {
+		entries = append(entries, Entry{
+			Key:        Key("m", text),
+			Model:      "m",
+			Text:       text,
+			Embedding:  []float64{1},
+			CreatedAt:  at,
+			LastUsedAt: at,
+		})
+	}
+	if err := SaveEntries(db, entries); err != nil {
+		t.Fatalf("unable to save entries: %s", err)
+	}
+}
+
+func remainingTexts(t *testing.T, db *gorm.DB) []string {
+	t.Helper()
+
+	var texts []string
+	if err := db.Model(&Entry{}).Order("text").Pluck("text", &texts).Error; err != nil {
+		t.Fatalf("unable to read entries: %s", err)
+	}
+	return texts
+}
+
+func TestTruncateEvictsLeastRecentlyUsed(t *testing.T) {
+	db := openTestDB(t)
+	now := time.Now()
+	saveTestEntries(t, db, map[string]time.Time{
+		"old":    now.Add(-3 * time.Hour),
+		"older":  now.Add(-4 * time.Hour),
+		"new":    now.Add(-1 * time.Hour),
+		"newest": now,
+	})
+
+	deleted, err := Truncate(db, 2)
+	if err != nil {
+		t.Fatalf("truncate failed: %s", err)
+	}
+	if deleted != 2 {
+		t.Errorf("expected 2 deleted, got %d", deleted)
+	}
+	if got := remainingTexts(t, db); !slices.Equal(got, []string{"new", "newest"}) {
+		t.Errorf("expected the recently used entries to remain, got %v", got)
+	}
+
+	deleted, _ = Truncate(db, 10)
+	if deleted != 0 {
+		t.Errorf("nothing should be deleted under the limit, got %d", deleted)
+	}
+}
+
+func TestTouchKeepsEntriesFromEviction(t *testing.T) {
+	db := openTestDB(t)
+	inner := &countingEmbedder{}
+	e, _ := NewEmbedder(db, inner, "m", 0)
+
+	e.Embed([]string{"a"})
+	time.Sleep(10 * time.Millisecond)
+	e.Embed([]string{"bb"})
+	time.Sleep(10 * time.Millisecond)
+	// 命中后 a 成为最近使用
+	e.Embed([]string{"a"})
+
+	Truncate(db, 1)
+	if got := remainingTexts(t, db); !slices.Equal(got, []string{"a"}) {
+		t.Errorf("expected a to remain, got %v", got)
+	}
+}
+
+func TestDeleteUnusedSince(t *testing.T) {
+	db := openTestDB(t)
+	now := time.Now()
+	saveTestEntries(t, db, map[string]time.Time{
+		"stale": now.Add(-48 * time.Hour),
+		"fresh": now.Add(-time.Hour),
+	})
+
+	deleted, err := DeleteUnusedSince(db, now.Add(-24*time.Hour))
+	if err != nil {
+		t.Fatalf("delete failed: %s", err)
+	}
+	if deleted != 1 {
+		t.Errorf("expected 1 deleted, got %d", deleted)
+	}
+	if got := remainingTexts(t, db); !slices.Equal(got, []string{"fresh"}) {
+		t.Errorf("expected fresh to remain, got %v", got)
+	}
+}
+
+func TestEmbedderSizeLimit(t *testing.T) {
+	db := openTestDB(t)
+	e, _ := NewEmbedder(db, &countingEmbedder{}, "m", 2)
+
+	e.Embed([]string{"a", "bb", "ccc"})
+	if count, _ := Count(db, ""); count != 2 {
+		t.Errorf("expected cache to be truncated to 2 entries, got %d", count)
+	}
+}
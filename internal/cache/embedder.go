@@ -0,0 +1,149 @@
+package cache
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+	"yggdrasil/sim-words/internal/embedding"
+
+	"gorm.io/gorm"
+)
+
+// Embedder 在数据库中缓存嵌入结果的 embedding.Embedder 包装，
+// 只把未命中的文本交给内部 embedder
+type Embedder struct {
+	db      *gorm.DB
+	inner   embedding.Embedder
+	modelID string
+	// maxEntries 大于 0 时，写入后按最近使用淘汰超出的条目
+	maxEntries int64
+
+	// SQLite 不支持并发写入，缓存读写串行执行
+	mu sync.Mutex
+	// unchecked 上次检查条目数后写入的条目数
+	unchecked int64
+
+	hits   atomic.Int64
+	misses atomic.Int64
+}
+
+type Stats struct {
+	Hits   int64 `json:"hits"`
+	Misses int64 `json:"misses"`
+}
+
+func NewEmbedder(db *gorm.DB, inner embedding.Embedder, modelID string, maxEntries int64) (*Embedder, error) {
+	if err := Migrate(db); err != nil {
+		return nil, fmt.Errorf("unable to migrate embedding cache: %w", err)
+	}
+	return &Embedder{
+		db:         db,
+		inner:      inner,
+		modelID:    modelID,
+		maxEntries: maxEntries,
+	}, nil
+}
+
+func (e *Embedder) Embed(texts []string) ([][]float64, error) {
+	keys := make([]string, len(texts))
+	for i, text := range texts {
+		keys[i] = Key(e.modelID, text)
+	}
+
+	e.mu.Lock()
+	cached, err := GetEntries(e.db, keys)
+	e.mu.Unlock()
+	if err != nil {
+		return nil, fmt.Errorf("unable to read embedding cache: %w", err)
+	}
+
+	// 收集未命中的文本，同一批内重复的文本只嵌入一次
+	embeddings := make([][]float64, len(texts))
+	hitKeys := []string{}
+	missTexts := []string{}
+	missIndex := map[string]int{}
+	for i, key := range keys {
+		if entry, ok := cached[key]; ok {
+			embeddings[i] = entry.Embedding
+			hitKeys = append(hitKeys, key)
+			continue
+		}
+		if _, ok := missIndex[key]; !ok {
+			missIndex[key] = len(missTexts)
+			missTexts = append(missTexts, texts[i])
+		}
+	}
+	e.hits.Add(int64(len(hitKeys)))
+	e.misses.Add(int64(len(texts) - len(hitKeys)))
+
+	now := time.Now()
+	if len(hitKeys) > 0 {
+		e.mu.Lock()
+		err := TouchEntries(e.db, hitKeys, now)
+		e.mu.Unlock()
+		if err != nil {
+			log.Printf("unable to touch embedding cache: %s", err)
+		}
+	}
+	if len(missTexts) == 0 {
+		return embeddings, nil
+	}
+
+	missEmbeddings, err := e.inner.Embed(missTexts)
+	if err != nil {
+		return nil, err
+	}
+	if len(missEmbeddings) != len(missTexts) {
+		return nil, fmt.Errorf("expected %d embeddings, got %d", len(missTexts), len(missEmbeddings))
+	}
+
+	entries := make([]Entry, len(missTexts))
+	for i, text := range missTexts {
+		entries[i] = Entry{
+			Key:        Key(e.modelID, text),
+			Model:      e.modelID,
+			Text:       text,
+			Embedding:  missEmbeddings[i],
+			CreatedAt:  now,
+			LastUsedAt: now,
+		}
+	}
+	for i, key := range keys {
+		if embeddings[i] == nil {
+			embeddings[i] = missEmbeddings[missIndex[key]]
+		}
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	// 写缓存失败不影响本次结果
+	if err := SaveEntries(e.db, entries); err != nil {
+		log.Printf("unable to write embedding cache: %s", err)
+		return embeddings, nil
+	}
+	// 统计条目数需要扫描全表，累计写入超过上限的 1% 后才检查一次
+	e.unchecked += int64(len(entries))
+	if e.maxEntries > 0 && e.unchecked >= max(e.maxEntries/100, 1) {
+		e.unchecked = 0
+		if _, err := Truncate(e.db, e.maxEntries); err != nil {
+			log.Printf("unable to truncate embedding cache: %s", err)
+		}
+	}
+
+	return embeddings, nil
+}
+
+func (e *Embedder) Dimension() int {
+	return e.inner.Dimension()
+}
+
+func (e *Embedder) Model() string {
+	return e.inner.Model()
+}
+
+func (e *Embedder) Stats() Stats {
+	return Stats{Hits: e.hits.Load(), Misses: e.misses.Load()}
+}
@@ -0,0 +1,120 @@
+package cache
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// SQLite 单条语句的变量数有限，按此大小分批查询
+const queryBatchSize = 500
+
+func Migrate(db *gorm.DB) error {
+	return db.AutoMigrate(&Entry{})
+}
+
+// GetEntries 按键批量读取缓存，返回键到条目的映射
+func GetEntries(db *gorm.DB, keys []string) (map[string]Entry, error) {
+	result := make(map[string]Entry, len(keys))
+	for i := 0; i < len(keys); i += queryBatchSize {
+		end := min(i+queryBatchSize, len(keys))
+
+		var entries []Entry
+		if err := db.Where("key IN ?", keys[i:end]).Find(&entries).Error; err != nil {
+			return nil, err
+		}
+		for _, e := range entries {
+			result[e.Key] = e
+		}
+	}
+	return result, nil
+}
+
+func SaveEntries(db *gorm.DB, entries []Entry) error {
+	batchSize := 100
+	for i := 0; i < len(entries); i += batchSize {
+		end := min(i+batchSize, len(entries))
+
+		batch := entries[i:end]
+		if err := db.Save(&batch).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// TouchEntries 更新条目的最近使用时间，供按最近使用淘汰
+func TouchEntries(db *gorm.DB, keys []string, at time.Time) error {
+	for i := 0; i < len(keys); i += queryBatchSize {
+		end := min(i+queryBatchSize, len(keys))
+		err := db.Model(&Entry{}).
+			Where("key IN ?", keys[i:end]).
+			Update("last_used_at", at).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Count 返回缓存条目数，model 为空时统计全部模型
+func Count(db *gorm.DB, model string) (int64, error) {
+	var count int64
+	query := db.Model(&Entry{})
+	if model != "" {
+		query = query.Where("model = ?", model)
+	}
+	err := query.Count(&count).Error
+	return count, err
+}
+
+// CountByModel 按模型统计条目数
+func CountByModel(db *gorm.DB) (map[string]int64, error) {
+	var rows []struct {
+		Model string
+		Count int64
+	}
+	err := db.Model(&Entry{}).
+		Select("model, count(*) as count").
+		Group("model").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	result := make(map[string]int64, len(rows))
+	for _, r := range rows {
+		result[r.Model] = r.Count
+	}
+	return result, nil
+}
+
+// DeleteByModel 删除某个模型的全部条目
+func DeleteByModel(db *gorm.DB, model string) (int64, error) {
+	result := db.Where("model = ?", model).Delete(&Entry{})
+	return result.RowsAffected, result.Error
+}
+
+// DeleteUnusedSince 删除在 before 之后未被使用的条目
+func DeleteUnusedSince(db *gorm.DB, before time.Time) (int64, error) {
+	result := db.Where("last_used_at < ?", before).Delete(&Entry{})
+	return result.RowsAffected, result.Error
+}
+
+// Truncate 按最近使用时间淘汰，使条目数不超过 maxEntries
+func Truncate(db *gorm.DB, maxEntries int64) (int64, error) {
+	count, err := Count(db, "")
+	if err != nil {
+		return 0, err
+	}
+	if count <= maxEntries {
+		return 0, nil
+	}
+
+	oldest := db.Model(&Entry{}).
+		Select("key").
+		Order("last_used_at ASC").
+		Limit(int(count - maxEntries))
+	result := db.Where("key IN (?)", oldest).Delete(&Entry{})
+	return result.RowsAffected, result.Error
+}
@@ -8,4 +8,22 @@ type Cluster struct {
 	base.BaseModel
 	base.Embedding
 	AnchorWord string
+	// Anchors 离簇中心最近的若干个单词，由近到远，第一个即 AnchorWord
+	Anchors base.StringSlice `gorm:"type:json"`
+	// FrequentWords 簇内频率最高的若干个单词，由高到低
+	FrequentWords base.StringSlice `gorm:"type:json"`
+	// Label 按频率加权的标签，为与中心的余弦相似度乘以 log(1+频率) 最大的单词
+	Label string
+	// Spread 簇内单词到中心的平均欧氏距离
+	Spread float64
+	// Algorithm 计算簇中心的聚类算法，见 kmeans.Algorithm
+	Algorithm string
+	// ParentID 层次聚类中上一层的簇，顶层为空。单词只属于没有子簇的叶子簇
+	ParentID *uint `gorm:"index"`
+	// Level 所在层，顶层为 0
+	Level int
+	// Size 簇内单词数，上层簇为其下全部叶子簇的单词数
+	Size int
+	// Changed 上次聚类以来增删的单词数，用于估计漂移
+	Changed int
 }
@@ -9,7 +9,9 @@ import (
 func SaveClusters(db *gorm.DB, clusters []Cluster) error {
 	db.AutoMigrate(&Cluster{})
 	for i := range clusters {
-		db.Create(&clusters[i])
+		if err := db.Create(&clusters[i]).Error; err != nil {
+			return fmt.Errorf("failed to save cluster: %w", err)
+		}
 	}
 
 	return nil
@@ -46,3 +48,9 @@ func GetClusters(db *gorm.DB, ids []uint) ([]Cluster, error) {
 
 	return clusters, nil
 }
+
+// DeleteAll 清空簇表
+func DeleteAll(db *gorm.DB) error {
+	db.AutoMigrate(&Cluster{})
+	return db.Unscoped().Where("1 = 1").Delete(&Cluster{}).Error
+}
@@ -0,0 +1,88 @@
+package dataset
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+type Format string
+
+const (
+	// FormatTSV 默认的 index<TAB>word<TAB>frequency 格式
+	FormatTSV Format = "tsv"
+	// FormatCSV 带表头的 CSV
+	FormatCSV Format = "csv"
+	// FormatJSONL 每行一个 JSON 对象
+	FormatJSONL Format = "jsonl"
+	// FormatLines 每行一个单词
+	FormatLines Format = "lines"
+)
+
+// Options 读取参数。列可以用从 1 开始的序号或表头中的列名（JSONL 为键名）指定，
+// 为空时使用该格式的默认列，- 表示不读取该列；只要有一列按名称指定，就把第一行当作表头
+type Options struct {
+	Format          Format
+	IndexColumn     string
+	WordColumn      string
+	FrequencyColumn string
+}
+
+// DetectFormat 按扩展名推断格式，忽略 .gz 后缀，无法识别时返回 FormatTSV
+func DetectFormat(path string) Format {
+	name := strings.ToLower(strings.TrimSuffix(strings.ToLower(path), ".gz"))
+	switch filepath.Ext(name) {
+	case ".csv":
+		return FormatCSV
+	case ".jsonl", ".ndjson":
+		return FormatJSONL
+	case ".txt", ".lst", ".list":
+		return FormatLines
+	default:
+		return FormatTSV
+	}
+}
+
+type readCloser struct {
+	io.Reader
+	closers []io.Closer
+}
+
+func (r *readCloser) Close() error {
+	var err error
+	for i := len(r.closers) - 1; i >= 0; i-- {
+		if closeErr := r.closers[i].Close(); closeErr != nil && err == nil {
+			err = closeErr
+		}
+	}
+	return err
+}
+
+// Open 打开输入文件，path 为 - 时读取标准输入；gzip 压缩的内容按文件头识别并自动解压
+func Open(path string) (io.ReadCloser, error) {
+	var source io.ReadCloser = os.Stdin
+	if path != "-" {
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		source = file
+	}
+
+	buffered := bufio.NewReader(source)
+	magic, _ := buffered.Peek(2)
+	if !bytes.Equal(magic, []byte{0x1f, 0x8b}) {
+		return &readCloser{Reader: buffered, closers: []io.Closer{source}}, nil
+	}
+
+	gz, err := gzip.NewReader(buffered)
+	if err != nil {
+		source.Close()
+		return nil, err
+	}
+	return &readCloser{Reader: gz, closers: []io.Closer{source, gz}}, nil
+}
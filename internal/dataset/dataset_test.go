@@ -0,0 +1,174 @@
+package dataset
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"yggdrasil/sim-words/internal/word"
+)
+
+func readAll(t *testing.T, input string, opts Options) []word.RawRecord {
+	t.Helper()
+
+	var records []word.RawRecord
+	err := Read(strings.NewReader(input), opts, func(record word.RawRecord) error {
+		records = append(records, record)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("read failed: %s", err)
+	}
+	return records
+}
+
+func TestReadFormats(t *testing.T) {
+	want := []word.RawRecord{
+		{Index: 1, Word: "apple", Frequency: 30},
+		{Index: 2, Word: "pear", Frequency: 20},
+	}
+
+	cases := []struct {
+		name  string
+		input string
+		opts  Options
+	}{
+		{"tsv", "1\tapple\t30\n2\tpear\t20\n", Options{Format: FormatTSV}},
+		{"default format", "1\tapple\t30\n\n2\tpear\t20\n", Options{}},
+		{"csv", "index,word,frequency\n1,apple,30\n2,pear,20\n", Options{Format: FormatCSV}},
+		{"csv with mapping", "Word,Count,Rank\napple,30,1\npear,20,2\n", Options{
+			Format:          FormatCSV,
+			WordColumn:      "Word",
+			FrequencyColumn: "count",
+			IndexColumn:     "rank",
+		}},
+		{"tsv by position", "apple\tx\t30\npear\ty\t20\n", Options{
+			Format:          FormatTSV,
+			WordColumn:      "1",
+			FrequencyColumn: "3",
+			IndexColumn:     "-",
+		}},
+		{"jsonl", `{"word":"apple","frequency":30,"index":1}` + "\n" + `{"word":"pear","frequency":20.0,"index":"2"}` + "\n", Options{Format: FormatJSONL}},
+		{"jsonl with mapping", `{"w":"apple","n":30}` + "\n" + `{"w":"pear","n":20}` + "\n", Options{
+			Format:          FormatJSONL,
+			WordColumn:      "w",
+			FrequencyColumn: "n",
+		}},
+	}
+
+	for _, c := range cases {
+		got := readAll(t, c.input, c.opts)
+		if !slices.Equal(got, want) {
+			t.Errorf("%s: expected %v, got %v", c.name, want, got)
+		}
+	}
+}
+
+func TestReadLines(t *testing.T) {
+	got := readAll(t, "apple\n\n  pear \n", Options{Format: FormatLines})
+	want := []word.RawRecord{
+		{Index: 1, Word: "apple", Frequency: 1},
+		{Index: 3, Word: "pear", Frequency: 1},
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+}
+
+func TestReadCSVWithoutOptionalColumns(t *testing.T) {
+	got := readAll(t, "word\napple\npear\n", Options{Format: FormatCSV})
+	want := []word.RawRecord{
+		{Index: 1, Word: "apple", Frequency: 1},
+		{Index: 2, Word: "pear", Frequency: 1},
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+}
+
+func TestReadErrors(t *testing.T) {
+	cases := []struct {
+		name  string
+		input string
+		opts  Options
+	}{
+		{"short tsv line", "1\tapple\n", Options{Format: FormatTSV}},
+		{"bad frequency", "1\tapple\tmany\n", Options{Format: FormatTSV}},
+		{"missing word column", "term,frequency\napple,1\n", Options{Format: FormatCSV}},
+		{"bad json", "{word\n", Options{Format: FormatJSONL}},
+		{"unknown format", "apple\n", Options{Format: "xml"}},
+	}
+
+	for _, c := range cases {
+		err := Read(strings.NewReader(c.input), c.opts, func(word.RawRecord) error { return nil })
+		if err == nil {
+			t.Errorf("%s: expected an error", c.name)
+		}
+	}
+}
+
+func TestDetectFormat(t *testing.T) {
+	cases := map[string]Format{
+		"words.tsv":       FormatTSV,
+		"words.tsv.gz":    FormatTSV,
+		"words.CSV":       FormatCSV,
+		"words.csv.gz":    FormatCSV,
+		"words.jsonl":     FormatJSONL,
+		"words.ndjson.gz": FormatJSONL,
+		"words.txt":       FormatLines,
+		"-":               FormatTSV,
+	}
+	for path, want := range cases {
+		if got := DetectFormat(path); got != want {
+			t.Errorf("%s: expected %s, got %s", path, want, got)
+		}
+	}
+}
+
+func TestOpenGzip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "words.txt.gz")
+	file, _ := os.Create(path)
+	gz := gzip.NewWriter(file)
+	gz.Write([]byte("apple\npear\n"))
+	gz.Close()
+	file.Close()
+
+	r, err := Open(path)
+	if err != nil {
+		t.Fatalf("open failed: %s", err)
+	}
+	defer r.Close()
+
+	content, _ := io.ReadAll(r)
+	if string(content) != "apple\npear\n" {
+		t.Errorf("unexpected content %q", content)
+	}
+}
+
+func TestOpenStdin(t *testing.T) {
+	reader, writer, _ := os.Pipe()
+	stdin := os.Stdin
+	os.Stdin = reader
+	defer func() { os.Stdin = stdin }()
+
+	writer.Write([]byte("1\tapple\t3\n"))
+	writer.Close()
+
+	r, err := Open("-")
+	if err != nil {
+		t.Fatalf("open failed: %s", err)
+	}
+	defer r.Close()
+
+	var records []word.RawRecord
+	Read(r, Options{}, func(record word.RawRecord) error {
+		records = append(records, record)
+		return nil
+	})
+	if len(records) != 1 || records[0].Word != "apple" {
+		t.Errorf("unexpected records %v", records)
+	}
+}
@@ -0,0 +1,242 @@
+package dataset
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"yggdrasil/sim-words/internal/word"
+)
+
+// Read 逐条读取记录交给 fn。文件中没有下标时以行号（从 1 开始，不含表头）代替，
+// 没有频次时记为 1
+func Read(r io.Reader, opts Options, fn func(word.RawRecord) error) error {
+	switch opts.Format {
+	case FormatTSV, "":
+		return readDelimited(r, '\t', opts, columnSpec{"1", "2", "3"}, fn)
+	case FormatCSV:
+		return readDelimited(r, ',', opts, columnSpec{"index", "word", "frequency"}, fn)
+	case FormatJSONL:
+		return readJSONL(r, opts, fn)
+	case FormatLines:
+		return readLines(r, fn)
+	default:
+		return fmt.Errorf("unknown input format %s", opts.Format)
+	}
+}
+
+type columnSpec struct {
+	index     string
+	word      string
+	frequency string
+}
+
+// resolve 用 Options 中的列覆盖默认列，- 表示不读取该列
+func (c columnSpec) resolve(opts Options) columnSpec {
+	override := func(column *string, value string) {
+		switch value {
+		case "":
+		case "-":
+			*column = ""
+		default:
+			*column = value
+		}
+	}
+	override(&c.index, opts.IndexColumn)
+	override(&c.word, opts.WordColumn)
+	override(&c.frequency, opts.FrequencyColumn)
+	return c
+}
+
+func (c columnSpec) byName() bool {
+	for _, spec := range []string{c.index, c.word, c.frequency} {
+		if _, err := strconv.Atoi(spec); spec != "" && err != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// columnIndex 把列转换为从 0 开始的下标，找不到时返回 -1
+func columnIndex(spec string, header []string) (int, error) {
+	if spec == "" {
+		return -1, nil
+	}
+	if n, err := strconv.Atoi(spec); err == nil {
+		if n < 1 {
+			return 0, fmt.Errorf("column %d out of range, columns start from 1", n)
+		}
+		return n - 1, nil
+	}
+	for i, name := range header {
+		if strings.EqualFold(strings.TrimSpace(name), spec) {
+			return i, nil
+		}
+	}
+	return -1, nil
+}
+
+func readDelimited(r io.Reader, delimiter rune, opts Options, defaults columnSpec, fn func(word.RawRecord) error) error {
+	columns := defaults.resolve(opts)
+
+	nextRow := rowReader(r, delimiter)
+
+	var header []string
+	if columns.byName() {
+		row, err := nextRow()
+		if err != nil {
+			return fmt.Errorf("unable to read header: %w", err)
+		}
+		header = append([]string{}, row...)
+	}
+
+	indexCol, err := columnIndex(columns.index, header)
+	if err != nil {
+		return err
+	}
+	wordCol, err := columnIndex(columns.word, header)
+	if err != nil {
+		return err
+	}
+	if columns.word == "" || wordCol < 0 {
+		return fmt.Errorf("word column %s not found in header %v", columns.word, header)
+	}
+	frequencyCol, err := columnIndex(columns.frequency, header)
+	if err != nil {
+		return err
+	}
+
+	for line := 1; ; line++ {
+		row, err := nextRow()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if len(row) == 1 && row[0] == "" {
+			continue
+		}
+
+		needed := max(indexCol, wordCol, frequencyCol) + 1
+		if len(row) < needed {
+			return fmt.Errorf("invalid line %d: expected at least %d columns, got %q", line, needed, strings.Join(row, string(delimiter)))
+		}
+
+		record := word.RawRecord{Index: line, Word: row[wordCol], Frequency: 1}
+		if indexCol >= 0 {
+			record.Index, err = strconv.Atoi(strings.TrimSpace(row[indexCol]))
+			if err != nil {
+				return fmt.Errorf("invalid index on line %d: %w", line, err)
+			}
+		}
+		if frequencyCol >= 0 {
+			record.Frequency, err = strconv.Atoi(strings.TrimSpace(row[frequencyCol]))
+			if err != nil {
+				return fmt.Errorf("invalid frequency on line %d: %w", line, err)
+			}
+		}
+
+		if err := fn(record); err != nil {
+			return err
+		}
+	}
+}
+
+// rowReader 返回逐行读取字段的函数，读完时返回 io.EOF。
+// TSV 按制表符直接切分，引号没有特殊含义；CSV 按标准规则解析
+func rowReader(r io.Reader, delimiter rune) func() ([]string, error) {
+	if delimiter != '\t' {
+		reader := csv.NewReader(r)
+		reader.Comma = delimiter
+		reader.FieldsPerRecord = -1
+		return reader.Read
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	return func() ([]string, error) {
+		if !scanner.Scan() {
+			if err := scanner.Err(); err != nil {
+				return nil, err
+			}
+			return nil, io.EOF
+		}
+		return strings.Split(strings.TrimRight(scanner.Text(), "\r"), "\t"), nil
+	}
+}
+
+func readJSONL(r io.Reader, opts Options, fn func(word.RawRecord) error) error {
+	keys := columnSpec{"index", "word", "frequency"}.resolve(opts)
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+
+		decoder := json.NewDecoder(strings.NewReader(text))
+		decoder.UseNumber()
+		var object map[string]any
+		if err := decoder.Decode(&object); err != nil {
+			return fmt.Errorf("invalid json on line %d: %w", line, err)
+		}
+
+		w, ok := object[keys.word].(string)
+		if !ok {
+			return fmt.Errorf("line %d has no string field %s", line, keys.word)
+		}
+		record := word.RawRecord{Index: line, Word: w, Frequency: 1}
+
+		var err error
+		if value, ok := object[keys.index]; ok {
+			if record.Index, err = jsonInt(value); err != nil {
+				return fmt.Errorf("invalid index on line %d: %w", line, err)
+			}
+		}
+		if value, ok := object[keys.frequency]; ok {
+			if record.Frequency, err = jsonInt(value); err != nil {
+				return fmt.Errorf("invalid frequency on line %d: %w", line, err)
+			}
+		}
+
+		if err := fn(record); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+func jsonInt(value any) (int, error) {
+	switch v := value.(type) {
+	case json.Number:
+		if n, err := v.Int64(); err == nil {
+			return int(n), nil
+		}
+		f, err := v.Float64()
+		return int(f), err
+	case string:
+		return strconv.Atoi(v)
+	default:
+		return 0, fmt.Errorf("unexpected value %v", value)
+	}
+}
+
+func readLines(r io.Reader, fn func(word.RawRecord) error) error {
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		if err := fn(word.RawRecord{Index: line, Word: text, Frequency: 1}); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
@@ -3,9 +3,9 @@ package embedding
 import (
 	"encoding/json"
 	"fmt"
-	"io"
 	"net/http"
 	"strings"
+	"sync/atomic"
 )
 
 type EmbeddingRequest struct {
@@ -22,24 +22,56 @@ type EmbeddingResponse struct {
 	Value   EmbeddingResponseValue `json:"value"`
 }
 
-const baseUrl = "http://localhost:8000"
+const DefaultBaseUrl = "http://localhost:8000"
 
-func Embedding(texts []string) (EmbeddingResponseValue, error) {
-	url := strings.Join([]string{baseUrl, "/api/v1/embd/batch"}, "")
-	requestBody, err := json.Marshal(EmbeddingRequest{Texts: texts})
+// ServiceEmbedder 调用 /api/v1/embd/batch 接口的嵌入服务
+type ServiceEmbedder struct {
+	BaseUrl   string
+	ModelName string
+	Options   ClientOptions
+
+	// 并发调用时由返回结果更新
+	dimension atomic.Int64
+}
+
+func NewServiceEmbedder(baseUrl string, modelName string, options ClientOptions) *ServiceEmbedder {
+	if baseUrl == "" {
+		baseUrl = DefaultBaseUrl
+	}
+	return &ServiceEmbedder{BaseUrl: baseUrl, ModelName: modelName, Options: options}
+}
+
+func (e *ServiceEmbedder) Embed(texts []string) ([][]float64, error) {
+	value, err := e.embedding(texts)
 	if err != nil {
-		return EmbeddingResponseValue{}, err
+		return nil, err
+	}
+	if err := validateEmbeddings(value.Embeddings, len(texts), int(e.dimension.Load())); err != nil {
+		return nil, err
+	}
+	if len(value.Embeddings) > 0 {
+		// 服务不提供维度信息，以首次返回结果为准
+		e.dimension.Store(int64(len(value.Embeddings[0])))
 	}
+	return value.Embeddings, nil
+}
+
+func (e *ServiceEmbedder) Dimension() int {
+	return int(e.dimension.Load())
+}
 
-	resp, err := http.Post(url, "application/json", strings.NewReader(string(requestBody)))
+func (e *ServiceEmbedder) Model() string {
+	return e.ModelName
+}
+
+func (e *ServiceEmbedder) embedding(texts []string) (EmbeddingResponseValue, error) {
+	url := strings.Join([]string{strings.TrimRight(e.BaseUrl, "/"), "/api/v1/embd/batch"}, "")
+	requestBody, err := json.Marshal(EmbeddingRequest{Texts: texts})
 	if err != nil {
 		return EmbeddingResponseValue{}, err
 	}
 
-	if resp.StatusCode != http.StatusOK {
-		return EmbeddingResponseValue{}, fmt.Errorf("http error: status code = %d", resp.StatusCode)
-	}
-	bodyBytes, err := io.ReadAll(resp.Body)
+	bodyBytes, err := postJSON(e.Options, url, nil, requestBody, parseServiceError)
 	if err != nil {
 		return EmbeddingResponseValue{}, err
 	}
@@ -49,6 +81,28 @@ func Embedding(texts []string) (EmbeddingResponseValue, error) {
 	if err != nil {
 		return EmbeddingResponseValue{}, fmt.Errorf("unable to unmarshal %s: %s", string(bodyBytes), err.Error())
 	}
+	if !isSuccessCode(body.Code) {
+		return EmbeddingResponseValue{}, &ServiceError{StatusCode: http.StatusOK, Code: body.Code, Message: body.Message}
+	}
 
 	return body.Value, nil
 }
+
+// parseServiceError 从非 200 响应中提取 code 与 message
+func parseServiceError(statusCode int, bodyBytes []byte) error {
+	var body EmbeddingResponse
+	if err := json.Unmarshal(bodyBytes, &body); err != nil || (body.Code == "" && body.Message == "") {
+		return nil
+	}
+	return &ServiceError{StatusCode: statusCode, Code: body.Code, Message: body.Message}
+}
+
+// isSuccessCode 服务以空、0、200、ok 或 success 表示成功
+func isSuccessCode(code string) bool {
+	switch strings.ToLower(code) {
+	case "", "0", "200", "ok", "success":
+		return true
+	default:
+		return false
+	}
+}
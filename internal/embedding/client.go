@@ -0,0 +1,165 @@
+package embedding
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+)
+
+var (
+	// ErrCountMismatch 返回的向量数与输入文本数不一致
+	ErrCountMismatch = errors.New("embedding count mismatch")
+	// ErrDimensionMismatch 返回的向量维度不一致或与预期不符
+	ErrDimensionMismatch = errors.New("embedding dimension mismatch")
+)
+
+// ServiceError 嵌入服务返回的错误，Code 与 Message 来自响应体
+type ServiceError struct {
+	StatusCode int
+	Code       string
+	Message    string
+}
+
+func (e *ServiceError) Error() string {
+	if e.Code == "" && e.Message == "" {
+		return fmt.Sprintf("embedding service error: status code = %d", e.StatusCode)
+	}
+	return fmt.Sprintf("embedding service error: status code = %d, code = %s, message = %s", e.StatusCode, e.Code, e.Message)
+}
+
+// Temporary 5xx 与 429 视为可重试
+func (e *ServiceError) Temporary() bool {
+	return e.StatusCode >= 500 || e.StatusCode == http.StatusTooManyRequests
+}
+
+// ClientOptions HTTP 嵌入服务共用的超时与重试参数
+type ClientOptions struct {
+	// Timeout 单次请求超时，0 表示不限制
+	Timeout time.Duration
+	// MaxRetries 失败后的最大重试次数
+	MaxRetries int
+	// Backoff 首次重试前的等待时间，之后每次翻倍，不超过 MaxBackoff
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	Client     *http.Client
+}
+
+func DefaultClientOptions() ClientOptions {
+	return ClientOptions{
+		Timeout:    30 * time.Second,
+		MaxRetries: 3,
+		Backoff:    500 * time.Millisecond,
+		MaxBackoff: 10 * time.Second,
+		Client:     http.DefaultClient,
+	}
+}
+
+// postJSON 发送 JSON 请求并返回响应体，对连接错误和可重试的状态码按指数退避重试。
+// parseError 用于从非 200 响应体中解析服务的错误信息，可为 nil
+func postJSON(
+	opts ClientOptions,
+	url string,
+	headers map[string]string,
+	body []byte,
+	parseError func(statusCode int, body []byte) error,
+) ([]byte, error) {
+	client := opts.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	backoff := opts.Backoff
+	var lastErr error
+	for attempt := 0; attempt <= opts.MaxRetries; attempt++ {
+		if attempt > 0 {
+			log.Printf("embedding request failed (%s), retry #%d in %s", lastErr, attempt, backoff)
+			time.Sleep(backoff)
+			backoff = min(backoff*2, opts.MaxBackoff)
+		}
+
+		respBody, err := doPost(client, opts.Timeout, url, headers, body, parseError)
+		if err == nil {
+			return respBody, nil
+		}
+		lastErr = err
+
+		var serviceErr *ServiceError
+		if errors.As(err, &serviceErr) && !serviceErr.Temporary() {
+			// 4xx 等错误重试也不会成功
+			return nil, err
+		}
+	}
+
+	return nil, fmt.Errorf("giving up after %d retries: %w", opts.MaxRetries, lastErr)
+}
+
+func doPost(
+	client *http.Client,
+	timeout time.Duration,
+	url string,
+	headers map[string]string,
+	body []byte,
+	parseError func(statusCode int, body []byte) error,
+) ([]byte, error) {
+	ctx := context.Background()
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		if parseError != nil {
+			if err := parseError(resp.StatusCode, respBody); err != nil {
+				return nil, err
+			}
+		}
+		return nil, &ServiceError{StatusCode: resp.StatusCode, Message: string(respBody)}
+	}
+
+	return respBody, nil
+}
+
+// validateEmbeddings 检查向量数与输入数一致、维度一致，dimension 大于 0 时还需与其相等
+func validateEmbeddings(embeddings [][]float64, count int, dimension int) error {
+	if len(embeddings) != count {
+		return fmt.Errorf("%w: expected %d, got %d", ErrCountMismatch, count, len(embeddings))
+	}
+	for i, embd := range embeddings {
+		if len(embd) == 0 {
+			return fmt.Errorf("%w: embedding #%d is empty", ErrDimensionMismatch, i)
+		}
+		if dimension == 0 {
+			dimension = len(embd)
+		}
+		if len(embd) != dimension {
+			return fmt.Errorf("%w: embedding #%d has dimension %d, expected %d", ErrDimensionMismatch, i, len(embd), dimension)
+		}
+	}
+	return nil
+}
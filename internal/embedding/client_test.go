@@ -0,0 +1,177 @@
+package embedding
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// flakyServer 前 failures 次请求返回 status，之后返回 body
+func flakyServer(t *testing.T, failures int32, status int, body string) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+
+	var attempts atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if attempts.Add(1) <= failures {
+			w.WriteHeader(status)
+			w.Write([]byte(`{"code":"busy","message":"try later"}`))
+			return
+		}
+		w.Write([]byte(body))
+	}))
+	t.Cleanup(server.Close)
+	return server, &attempts
+}
+
+const twoEmbeddings = `{"code":"0","message":"ok","value":{"embeddings":[[1,0],[0,1]]}}`
+
+func TestServiceEmbedderRetries(t *testing.T) {
+	for _, status := range []int{http.StatusInternalServerError, http.StatusServiceUnavailable, http.StatusTooManyRequests} {
+		server, attempts := flakyServer(t, 2, status, twoEmbeddings)
+
+		e := NewServiceEmbedder(server.URL, "", testClientOptions())
+		embeddings, err := e.Embed([]string{"a", "b"})
+		if err != nil {
+			t.Fatalf("status %d: embed failed: %s", status, err)
+		}
+		if attempts.Load() != 3 {
+			t.Errorf("status %d: expected 3 attempts, got %d", status, attempts.Load())
+		}
+		if len(embeddings) != 2 {
+			t.Errorf("status %d: expected 2 embeddings, got %d", status, len(embeddings))
+		}
+	}
+}
+
+func TestServiceEmbedderGivesUp(t *testing.T) {
+	server, attempts := flakyServer(t, 100, http.StatusBadGateway, twoEmbeddings)
+
+	options := testClientOptions()
+	options.MaxRetries = 2
+	_, err := NewServiceEmbedder(server.URL, "", options).Embed([]string{"a", "b"})
+
+	var serviceErr *ServiceError
+	if !errors.As(err, &serviceErr) || serviceErr.StatusCode != http.StatusBadGateway {
+		t.Fatalf("expected ServiceError with 502, got %v", err)
+	}
+	if serviceErr.Code != "busy" || serviceErr.Message != "try later" {
+		t.Errorf("code and message should come from the body, got %+v", serviceErr)
+	}
+	if attempts.Load() != 3 {
+		t.Errorf("expected 3 attempts, got %d", attempts.Load())
+	}
+}
+
+func TestServiceEmbedderNoRetryOn4xx(t *testing.T) {
+	server, attempts := flakyServer(t, 1, http.StatusBadRequest, twoEmbeddings)
+
+	_, err := NewServiceEmbedder(server.URL, "", testClientOptions()).Embed([]string{"a", "b"})
+
+	var serviceErr *ServiceError
+	if !errors.As(err, &serviceErr) || serviceErr.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected ServiceError with 400, got %v", err)
+	}
+	if attempts.Load() != 1 {
+		t.Errorf("4xx should not be retried, got %d attempts", attempts.Load())
+	}
+}
+
+func TestServiceEmbedderTimeout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(300 * time.Millisecond):
+		case <-r.Context().Done():
+		}
+	}))
+	defer server.Close()
+
+	options := testClientOptions()
+	options.Timeout = 20 * time.Millisecond
+	options.MaxRetries = 1
+
+	start := time.Now()
+	_, err := NewServiceEmbedder(server.URL, "", options).Embed([]string{"a"})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 250*time.Millisecond {
+		t.Errorf("timeout not applied, took %s", elapsed)
+	}
+}
+
+func TestServiceEmbedderErrorCode(t *testing.T) {
+	server, _ := flakyServer(t, 0, 0, `{"code":"E42","message":"model not loaded"}`)
+
+	_, err := NewServiceEmbedder(server.URL, "", testClientOptions()).Embed([]string{"a"})
+
+	var serviceErr *ServiceError
+	if !errors.As(err, &serviceErr) || serviceErr.Code != "E42" || serviceErr.Message != "model not loaded" {
+		t.Fatalf("expected ServiceError E42, got %v", err)
+	}
+}
+
+func TestServiceEmbedderValidation(t *testing.T) {
+	server, _ := flakyServer(t, 0, 0, `{"code":"0","value":{"embeddings":[[1,0]]}}`)
+	_, err := NewServiceEmbedder(server.URL, "", testClientOptions()).Embed([]string{"a", "b"})
+	if !errors.Is(err, ErrCountMismatch) {
+		t.Errorf("expected ErrCountMismatch, got %v", err)
+	}
+
+	server, _ = flakyServer(t, 0, 0, `{"code":"0","value":{"embeddings":[[1,0],[1,0,0]]}}`)
+	_, err = NewServiceEmbedder(server.URL, "", testClientOptions()).Embed([]string{"a", "b"})
+	if !errors.Is(err, ErrDimensionMismatch) {
+		t.Errorf("expected ErrDimensionMismatch, got %v", err)
+	}
+}
+
+func TestServiceEmbedderDimensionChange(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			w.Write([]byte(`{"value":{"embeddings":[[1,0]]}}`))
+			return
+		}
+		w.Write([]byte(`{"value":{"embeddings":[[1,0,0]]}}`))
+	}))
+	defer server.Close()
+
+	e := NewServiceEmbedder(server.URL, "", testClientOptions())
+	if _, err := e.Embed([]string{"a"}); err != nil {
+		t.Fatalf("embed failed: %s", err)
+	}
+	if _, err := e.Embed([]string{"a"}); !errors.Is(err, ErrDimensionMismatch) {
+		t.Errorf("expected ErrDimensionMismatch after the dimension changed, got %v", err)
+	}
+}
+
+func TestValidateEmbeddings(t *testing.T) {
+	cases := []struct {
+		name       string
+		embeddings [][]float64
+		count      int
+		dimension  int
+		want       error
+	}{
+		{"ok", [][]float64{{1, 0}, {0, 1}}, 2, 0, nil},
+		{"expected dimension", [][]float64{{1, 0}}, 1, 2, nil},
+		{"short", [][]float64{{1, 0}}, 2, 0, ErrCountMismatch},
+		{"long", [][]float64{{1, 0}, {0, 1}}, 1, 0, ErrCountMismatch},
+		{"empty vector", [][]float64{{1, 0}, {}}, 2, 0, ErrDimensionMismatch},
+		{"ragged", [][]float64{{1, 0}, {1}}, 2, 0, ErrDimensionMismatch},
+		{"wrong dimension", [][]float64{{1, 0}}, 1, 3, ErrDimensionMismatch},
+	}
+
+	for _, c := range cases {
+		err := validateEmbeddings(c.embeddings, c.count, c.dimension)
+		if c.want == nil && err != nil {
+			t.Errorf("%s: unexpected error %s", c.name, err)
+		}
+		if c.want != nil && !errors.Is(err, c.want) {
+			t.Errorf("%s: expected %v, got %v", c.name, c.want, err)
+		}
+	}
+}
@@ -1 +1,11 @@
 package embedding
+
+// Embedder 将一批文本嵌入化为向量，不同的嵌入服务实现该接口以便按环境替换
+type Embedder interface {
+	// Embed 按输入顺序返回每个文本的向量
+	Embed(texts []string) ([][]float64, error)
+	// Dimension 返回向量维度，未知时返回 0
+	Dimension() int
+	// Model 返回模型名称
+	Model() string
+}
@@ -0,0 +1,75 @@
+package embedding
+
+import (
+	"fmt"
+	"hash/fnv"
+	"strings"
+)
+
+const DefaultHashDimension = 256
+
+// HashEmbedder 基于字符 n-gram 特征哈希的离线嵌入，结果只与输入文本有关，
+// 用于测试和无法访问嵌入服务的环境
+type HashEmbedder struct {
+	dimension int
+	minN      int
+	maxN      int
+}
+
+func NewHashEmbedder(dimension int) *HashEmbedder {
+	if dimension <= 0 {
+		dimension = DefaultHashDimension
+	}
+	return &HashEmbedder{dimension: dimension, minN: 2, maxN: 4}
+}
+
+func (e *HashEmbedder) Embed(texts []string) ([][]float64, error) {
+	embeddings := make([][]float64, len(texts))
+	for i, text := range texts {
+		embeddings[i] = e.embed(text)
+	}
+	return embeddings, nil
+}
+
+func (e *HashEmbedder) Dimension() int {
+	return e.dimension
+}
+
+func (e *HashEmbedder) Model() string {
+	return fmt.Sprintf("hash-%d-%d-%d", e.minN, e.maxN, e.dimension)
+}
+
+func (e *HashEmbedder) embed(text string) []float64 {
+	vec := make([]float64, e.dimension)
+	tokens := strings.Fields(strings.ToLower(text))
+	if len(tokens) == 0 {
+		// 空文本也给出非零向量，避免归一化时除以零
+		e.add(vec, "<>", 1)
+	}
+	for _, token := range tokens {
+		// 整词特征
+		e.add(vec, "w:"+token, 1)
+
+		// 加上边界符，使前后缀与词中片段区分开
+		runes := []rune("<" + token + ">")
+		for n := e.minN; n <= e.maxN; n++ {
+			for start := 0; start+n <= len(runes); start++ {
+				e.add(vec, string(runes[start:start+n]), 1)
+			}
+		}
+	}
+	return vec
+}
+
+func (e *HashEmbedder) add(vec []float64, feature string, weight float64) {
+	h := fnv.New64a()
+	h.Write([]byte(feature))
+	sum := h.Sum64()
+
+	// 低位决定下标，最高位决定符号，降低哈希冲突带来的偏差
+	index := int(sum % uint64(e.dimension))
+	if sum>>63 == 1 {
+		weight = -weight
+	}
+	vec[index] += weight
+}
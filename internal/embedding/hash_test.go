@@ -0,0 +1,66 @@
+package embedding
+
+import (
+	"math"
+	"slices"
+	"testing"
+)
+
+func cosine(a, b []float64) float64 {
+	var dot, normA, normB float64
+	for i := range a {
+		dot += a[i] * b[i]
+		normA += a[i] * a[i]
+		normB += b[i] * b[i]
+	}
+	return dot / (math.Sqrt(normA) * math.Sqrt(normB))
+}
+
+func TestHashEmbedderDeterministic(t *testing.T) {
+	texts := []string{"apple", "I like apple", ""}
+
+	first, err := NewHashEmbedder(0).Embed(texts)
+	if err != nil {
+		t.Fatalf("embed failed: %s", err)
+	}
+	second, err := NewHashEmbedder(0).Embed(texts)
+	if err != nil {
+		t.Fatalf("embed failed: %s", err)
+	}
+
+	for i := range texts {
+		if !slices.Equal(first[i], second[i]) {
+			t.Errorf("embedding of %q is not deterministic", texts[i])
+		}
+	}
+}
+
+func TestHashEmbedderDimension(t *testing.T) {
+	for _, dim := range []int{0, 64, 1000} {
+		e := NewHashEmbedder(dim)
+		want := dim
+		if dim == 0 {
+			want = DefaultHashDimension
+		}
+		if e.Dimension() != want {
+			t.Errorf("expected dimension %d, got %d", want, e.Dimension())
+		}
+
+		embeddings, _ := e.Embed([]string{"apple", ""})
+		for _, embd := range embeddings {
+			if len(embd) != want {
+				t.Errorf("expected vector length %d, got %d", want, len(embd))
+			}
+			if slices.Max(embd) == 0 && slices.Min(embd) == 0 {
+				t.Errorf("vector should not be all zero")
+			}
+		}
+	}
+}
+
+func TestHashEmbedderSimilarity(t *testing.T) {
+	embeddings, _ := NewHashEmbedder(0).Embed([]string{"apple", "apples", "network"})
+	if cosine(embeddings[0], embeddings[1]) <= cosine(embeddings[0], embeddings[2]) {
+		t.Errorf("apple should be closer to apples than to network")
+	}
+}
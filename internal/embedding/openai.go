@@ -0,0 +1,125 @@
+package embedding
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync/atomic"
+)
+
+type OpenAIEmbeddingRequest struct {
+	Input      []string `json:"input"`
+	Model      string   `json:"model"`
+	Dimensions int      `json:"dimensions,omitempty"`
+}
+
+type OpenAIEmbeddingData struct {
+	Index     int       `json:"index"`
+	Embedding []float64 `json:"embedding"`
+}
+
+type OpenAIEmbeddingResponse struct {
+	Data  []OpenAIEmbeddingData `json:"data"`
+	Model string                `json:"model"`
+}
+
+type OpenAIErrorResponse struct {
+	Error struct {
+		Message string `json:"message"`
+		Type    string `json:"type"`
+		Code    any    `json:"code"`
+	} `json:"error"`
+}
+
+// OpenAIEmbedder 调用兼容 OpenAI /v1/embeddings 协议的嵌入服务
+type OpenAIEmbedder struct {
+	BaseUrl   string
+	ModelName string
+	ApiKey    string
+	// Dimensions 大于 0 时要求服务返回该维度的向量
+	Dimensions int
+	Options    ClientOptions
+
+	// 并发调用时由返回结果更新
+	dimension atomic.Int64
+}
+
+func NewOpenAIEmbedder(baseUrl string, modelName string, apiKey string, dimensions int, options ClientOptions) *OpenAIEmbedder {
+	e := &OpenAIEmbedder{
+		BaseUrl:    baseUrl,
+		ModelName:  modelName,
+		ApiKey:     apiKey,
+		Dimensions: dimensions,
+		Options:    options,
+	}
+	e.dimension.Store(int64(dimensions))
+	return e
+}
+
+func (e *OpenAIEmbedder) Embed(texts []string) ([][]float64, error) {
+	url := strings.TrimRight(e.BaseUrl, "/") + "/v1/embeddings"
+	requestBody, err := json.Marshal(OpenAIEmbeddingRequest{
+		Input:      texts,
+		Model:      e.ModelName,
+		Dimensions: e.Dimensions,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	headers := map[string]string{}
+	if e.ApiKey != "" {
+		headers["Authorization"] = "Bearer " + e.ApiKey
+	}
+
+	bodyBytes, err := postJSON(e.Options, url, headers, requestBody, parseOpenAIError)
+	if err != nil {
+		return nil, err
+	}
+
+	var body OpenAIEmbeddingResponse
+	err = json.Unmarshal(bodyBytes, &body)
+	if err != nil {
+		return nil, fmt.Errorf("unable to unmarshal %s: %s", string(bodyBytes), err.Error())
+	}
+
+	// 按 index 还原输入顺序
+	embeddings := make([][]float64, len(texts))
+	for _, d := range body.Data {
+		if d.Index < 0 || d.Index >= len(texts) {
+			return nil, fmt.Errorf("embedding index %d out of range [0, %d)", d.Index, len(texts))
+		}
+		embeddings[d.Index] = d.Embedding
+	}
+	if len(body.Data) != len(texts) {
+		return nil, fmt.Errorf("%w: expected %d, got %d", ErrCountMismatch, len(texts), len(body.Data))
+	}
+	if err := validateEmbeddings(embeddings, len(texts), int(e.dimension.Load())); err != nil {
+		return nil, err
+	}
+	if len(embeddings) > 0 {
+		e.dimension.Store(int64(len(embeddings[0])))
+	}
+
+	return embeddings, nil
+}
+
+func (e *OpenAIEmbedder) Dimension() int {
+	return int(e.dimension.Load())
+}
+
+func (e *OpenAIEmbedder) Model() string {
+	return e.ModelName
+}
+
+func parseOpenAIError(statusCode int, bodyBytes []byte) error {
+	var body OpenAIErrorResponse
+	if err := json.Unmarshal(bodyBytes, &body); err != nil || body.Error.Message == "" {
+		return nil
+	}
+	code := body.Error.Type
+	if body.Error.Code != nil {
+		code = fmt.Sprint(body.Error.Code)
+	}
+	return &ServiceError{StatusCode: statusCode, Code: code, Message: body.Error.Message}
+}
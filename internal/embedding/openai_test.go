@@ -0,0 +1,109 @@
+package embedding
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func testClientOptions() ClientOptions {
+	options := DefaultClientOptions()
+	options.Backoff = time.Millisecond
+	options.MaxBackoff = time.Millisecond
+	return options
+}
+
+func TestOpenAIEmbedderRequestAndOrder(t *testing.T) {
+	var gotAuth string
+	var gotBody map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/embeddings" {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+		gotAuth = r.Header.Get("Authorization")
+		json.NewDecoder(r.Body).Decode(&gotBody)
+
+		// 故意打乱返回顺序
+		w.Write([]byte(`{"data":[
+			{"index":1,"embedding":[0,1]},
+			{"index":0,"embedding":[1,0]}
+		],"model":"m"}`))
+	}))
+	defer server.Close()
+
+	e := NewOpenAIEmbedder(server.URL, "m", "secret", 0, testClientOptions())
+	embeddings, err := e.Embed([]string{"a", "b"})
+	if err != nil {
+		t.Fatalf("embed failed: %s", err)
+	}
+
+	if embeddings[0][0] != 1 || embeddings[1][1] != 1 {
+		t.Errorf("embeddings not reordered by index: %v", embeddings)
+	}
+	if gotAuth != "Bearer secret" {
+		t.Errorf("unexpected authorization header %q", gotAuth)
+	}
+	if _, ok := gotBody["dimensions"]; ok {
+		t.Errorf("dimensions should be omitted when 0, got %v", gotBody)
+	}
+	if gotBody["model"] != "m" {
+		t.Errorf("unexpected model %v", gotBody["model"])
+	}
+	if e.Dimension() != 2 {
+		t.Errorf("expected dimension 2, got %d", e.Dimension())
+	}
+}
+
+func TestOpenAIEmbedderDimensions(t *testing.T) {
+	var gotBody map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&gotBody)
+		w.Write([]byte(`{"data":[{"index":0,"embedding":[1,0,0]}]}`))
+	}))
+	defer server.Close()
+
+	e := NewOpenAIEmbedder(server.URL, "m", "", 3, testClientOptions())
+	if _, err := e.Embed([]string{"a"}); err != nil {
+		t.Fatalf("embed failed: %s", err)
+	}
+	if gotBody["dimensions"] != float64(3) {
+		t.Errorf("expected dimensions 3, got %v", gotBody["dimensions"])
+	}
+}
+
+func TestOpenAIEmbedderShortResponse(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"data":[{"index":0,"embedding":[1,0]}]}`))
+	}))
+	defer server.Close()
+
+	e := NewOpenAIEmbedder(server.URL, "m", "", 0, testClientOptions())
+	_, err := e.Embed([]string{"a", "b"})
+	if !errors.Is(err, ErrCountMismatch) {
+		t.Fatalf("expected ErrCountMismatch, got %v", err)
+	}
+}
+
+func TestOpenAIEmbedderErrorBody(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"error":{"message":"model not found","type":"invalid_request_error","code":"model_not_found"}}`))
+	}))
+	defer server.Close()
+
+	e := NewOpenAIEmbedder(server.URL, "m", "", 0, testClientOptions())
+	_, err := e.Embed([]string{"a"})
+
+	var serviceErr *ServiceError
+	if !errors.As(err, &serviceErr) {
+		t.Fatalf("expected ServiceError, got %v", err)
+	}
+	if serviceErr.StatusCode != http.StatusBadRequest ||
+		serviceErr.Code != "model_not_found" ||
+		serviceErr.Message != "model not found" {
+		t.Errorf("unexpected service error %+v", serviceErr)
+	}
+}
@@ -0,0 +1,130 @@
+package embedding
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// PoolOptions 批量并发嵌入化参数
+type PoolOptions struct {
+	BatchSize   int
+	Concurrency int
+	// RequestsPerSecond 每秒最多发出的批次数，0 表示不限制
+	RequestsPerSecond float64
+	// TextsPerSecond 每秒最多嵌入化的文本数，0 表示不限制
+	TextsPerSecond float64
+	// OnBatch 每个批次完成后串行调用，start 为该批次在 texts 中的起始下标，
+	// 返回错误视为该批次失败。设置后 EmbedAll 不保留也不返回向量
+	OnBatch func(start int, embeddings [][]float64) error
+}
+
+// EmbedAll 将 texts 分批后由多个 worker 并发嵌入化，结果与输入顺序一致；
+// 设置了 OnBatch 时由调用方逐批处理，返回 nil。
+// 任一批次失败后不再派发新的批次，返回第一个错误
+func EmbedAll(embedder Embedder, texts []string, opts PoolOptions) ([][]float64, error) {
+	batchSize := max(opts.BatchSize, 1)
+	concurrency := max(opts.Concurrency, 1)
+	requestLimiter := newRateLimiter(opts.RequestsPerSecond)
+	textLimiter := newRateLimiter(opts.TextsPerSecond)
+
+	var embeddings [][]float64
+	if opts.OnBatch == nil {
+		embeddings = make([][]float64, len(texts))
+	}
+	batches := (len(texts) + batchSize - 1) / batchSize // ceil(len/size)
+	log.Printf("got %d batches, %d workers", batches, concurrency)
+
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var firstErr error
+	done := 0
+
+	for range concurrency {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for b := range jobs {
+				start := b * batchSize
+				end := min(start+batchSize, len(texts))
+
+				requestLimiter.wait(1)
+				textLimiter.wait(end - start)
+
+				batchEmbd, err := embedder.Embed(texts[start:end])
+				if err == nil && len(batchEmbd) != end-start {
+					err = fmt.Errorf("%w: expected %d, got %d", ErrCountMismatch, end-start, len(batchEmbd))
+				}
+
+				mu.Lock()
+				if err == nil && opts.OnBatch != nil {
+					err = opts.OnBatch(start, batchEmbd)
+				}
+				if err != nil {
+					if firstErr == nil {
+						firstErr = fmt.Errorf("batch #%d (%d - %d): %w", b, start, end, err)
+					}
+				} else {
+					// 各批次写入互不重叠的区间，按下标还原顺序
+					if embeddings != nil {
+						copy(embeddings[start:end], batchEmbd)
+					}
+					done++
+					log.Printf("batch #%d: %d - %d done (%d / %d)", b, start, end, done, batches)
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+	for b := range batches {
+		mu.Lock()
+		failed := firstErr != nil
+		mu.Unlock()
+		if failed {
+			break
+		}
+		jobs <- b
+	}
+	close(jobs)
+	wg.Wait()
+
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	return embeddings, nil
+}
+
+// rateLimiter 按固定间隔排队放行，允许一次申请多个令牌
+type rateLimiter struct {
+	mu       sync.Mutex
+	interval time.Duration
+	next     time.Time
+}
+
+// newRateLimiter perSecond 不大于 0 时返回 nil，表示不限制
+func newRateLimiter(perSecond float64) *rateLimiter {
+	if perSecond <= 0 {
+		return nil
+	}
+	return &rateLimiter{interval: time.Duration(float64(time.Second) / perSecond)}
+}
+
+func (l *rateLimiter) wait(n int) {
+	if l == nil {
+		return
+	}
+
+	l.mu.Lock()
+	now := time.Now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	wakeAt := l.next
+	l.next = l.next.Add(time.Duration(n) * l.interval)
+	l.mu.Unlock()
+
+	time.Sleep(time.Until(wakeAt))
+}
@@ -0,0 +1,161 @@
+package embedding
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// indexEmbedder 把文本解析为整数作为向量，并可在指定文本上失败
+type indexEmbedder struct {
+	failOn string
+	delay  time.Duration
+	calls  atomic.Int32
+}
+
+func (e *indexEmbedder) Embed(texts []string) ([][]float64, error) {
+	e.calls.Add(1)
+	time.Sleep(e.delay)
+	result := make([][]float64, len(texts))
+	for i, text := range texts {
+		if text == e.failOn {
+			return nil, fmt.Errorf("failed on %s", text)
+		}
+		n, _ := strconv.Atoi(text)
+		result[i] = []float64{float64(n)}
+	}
+	return result, nil
+}
+
+func (e *indexEmbedder) Dimension() int { return 1 }
+
+func (e *indexEmbedder) Model() string { return "index" }
+
+func numberTexts(n int) []string {
+	texts := make([]string, n)
+	for i := range texts {
+		texts[i] = strconv.Itoa(i)
+	}
+	return texts
+}
+
+func TestEmbedAllKeepsOrder(t *testing.T) {
+	texts := numberTexts(103)
+	e := &indexEmbedder{}
+
+	embeddings, err := EmbedAll(e, texts, PoolOptions{BatchSize: 10, Concurrency: 4})
+	if err != nil {
+		t.Fatalf("embed failed: %s", err)
+	}
+
+	if len(embeddings) != len(texts) {
+		t.Fatalf("expected %d embeddings, got %d", len(texts), len(embeddings))
+	}
+	for i, embd := range embeddings {
+		if embd[0] != float64(i) {
+			t.Fatalf("embedding #%d is %v", i, embd)
+		}
+	}
+	if e.calls.Load() != 11 {
+		t.Errorf("expected 11 batches, got %d", e.calls.Load())
+	}
+}
+
+func TestEmbedAllStopsAfterFirstError(t *testing.T) {
+	texts := numberTexts(1000)
+	e := &indexEmbedder{failOn: "15", delay: time.Millisecond}
+
+	_, err := EmbedAll(e, texts, PoolOptions{BatchSize: 10, Concurrency: 2})
+	if err == nil {
+		t.Fatalf("expected an error")
+	}
+	// 失败后只会有已派发的少量批次继续执行
+	if calls := e.calls.Load(); calls > 10 {
+		t.Errorf("expected dispatch to stop soon after the failure, got %d batches", calls)
+	}
+}
+
+func TestRateLimiter(t *testing.T) {
+	if newRateLimiter(0) != nil {
+		t.Errorf("non-positive rate should disable the limiter")
+	}
+	// nil 限流器不阻塞
+	var limiter *rateLimiter
+	limiter.wait(100)
+
+	limiter = newRateLimiter(100)
+	start := time.Now()
+	var wg sync.WaitGroup
+	for range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			limiter.wait(5)
+		}()
+	}
+	wg.Wait()
+
+	// 20 个令牌，第一次申请立即放行，最后一次需等待 15 个令牌的时间
+	if elapsed := time.Since(start); elapsed < 140*time.Millisecond {
+		t.Errorf("expected at least 150ms, got %s", elapsed)
+	}
+}
+
+func TestEmbedAllRequestsPerSecond(t *testing.T) {
+	start := time.Now()
+	_, err := EmbedAll(&indexEmbedder{}, numberTexts(5), PoolOptions{
+		BatchSize:         1,
+		Concurrency:       5,
+		RequestsPerSecond: 50,
+	})
+	if err != nil {
+		t.Fatalf("embed failed: %s", err)
+	}
+	if elapsed := time.Since(start); elapsed < 75*time.Millisecond {
+		t.Errorf("expected 5 requests at 50 rps to take at least 80ms, got %s", elapsed)
+	}
+}
+
+func TestEmbedAllOnBatch(t *testing.T) {
+	texts := numberTexts(25)
+	seen := make([]bool, len(texts))
+
+	embeddings, err := EmbedAll(&indexEmbedder{}, texts, PoolOptions{
+		BatchSize:   10,
+		Concurrency: 3,
+		OnBatch: func(start int, batch [][]float64) error {
+			for i, embd := range batch {
+				if embd[0] != float64(start+i) {
+					return fmt.Errorf("embedding #%d is %v", start+i, embd)
+				}
+				seen[start+i] = true
+			}
+			return nil
+		},
+	})
+	if err != nil {
+		t.Fatalf("embed failed: %s", err)
+	}
+	if embeddings != nil {
+		t.Errorf("results should not be retained when OnBatch is set")
+	}
+	for i, ok := range seen {
+		if !ok {
+			t.Errorf("embedding #%d not passed to OnBatch", i)
+		}
+	}
+
+	_, err = EmbedAll(&indexEmbedder{}, texts, PoolOptions{
+		BatchSize:   10,
+		Concurrency: 1,
+		OnBatch: func(start int, batch [][]float64) error {
+			return fmt.Errorf("disk full")
+		},
+	})
+	if err == nil {
+		t.Errorf("OnBatch error should fail EmbedAll")
+	}
+}
@@ -0,0 +1,72 @@
+package hnsw
+
+import (
+	"bufio"
+	"encoding/gob"
+	"fmt"
+	"os"
+	"slices"
+)
+
+// fileVersion 索引文件格式版本，结构变化时递增
+const fileVersion = 1
+
+type fileHeader struct {
+	Version int
+}
+
+// Save 把索引写入文件，先写临时文件再改名，避免中断时留下不完整的索引
+func (idx *Index) Save(path string) error {
+	tmp := path + ".tmp"
+	file, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+
+	w := bufio.NewWriter(file)
+	encoder := gob.NewEncoder(w)
+	err = encoder.Encode(fileHeader{Version: fileVersion})
+	if err == nil {
+		err = encoder.Encode(idx)
+	}
+	if err == nil {
+		err = w.Flush()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// Load 从文件读取索引
+func Load(path string) (*Index, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	decoder := gob.NewDecoder(bufio.NewReader(file))
+	var header fileHeader
+	if err := decoder.Decode(&header); err != nil {
+		return nil, fmt.Errorf("unable to read index header: %w", err)
+	}
+	if header.Version != fileVersion {
+		return nil, fmt.Errorf("unsupported index version %d, rebuild the index", header.Version)
+	}
+
+	var idx Index
+	if err := decoder.Decode(&idx); err != nil {
+		return nil, fmt.Errorf("unable to read index: %w", err)
+	}
+	return &idx, nil
+}
+
+// Matches 判断索引的节点是否与给定的单词 ID 一一对应
+func (idx *Index) Matches(ids []uint) bool {
+	return slices.Equal(idx.IDs, ids)
+}
@@ -0,0 +1,229 @@
+package hnsw
+
+import (
+	"container/heap"
+	"math"
+	"math/rand"
+	"sort"
+)
+
+// Vectors 索引中节点的向量，节点编号即行号，向量应已归一化
+type Vectors interface {
+	Len() int
+	Row(i int) []float32
+}
+
+// Neighbor 查询结果，Similarity 为内积，向量归一化时即余弦相似度
+type Neighbor struct {
+	Node       int
+	Similarity float64
+}
+
+// Index 分层可导航小世界图（HNSW）。只保存图结构和节点对应的单词 ID，向量由 Vectors 提供
+type Index struct {
+	// M 每层每个节点的最大邻居数，第 0 层为 2*M
+	M int
+	// EfConstruction 建图时每层搜索的候选数
+	EfConstruction int
+	// Entry 入口节点，MaxLevel 为其所在的最高层
+	Entry    int
+	MaxLevel int
+	// IDs 每个节点对应的单词 ID，用于检查索引是否过期
+	IDs []uint
+	// Links Links[node][level] 为节点在该层的邻居
+	Links [][][]int32
+}
+
+// Build 依次插入全部节点建图，seed 决定节点层数的随机序列
+func Build(vectors Vectors, ids []uint, m int, efConstruction int, seed int64) *Index {
+	idx := &Index{
+		M:              m,
+		EfConstruction: efConstruction,
+		Entry:          -1,
+		IDs:            ids,
+		Links:          make([][][]int32, vectors.Len()),
+	}
+	r := rand.New(rand.NewSource(seed))
+	levelMult := 1 / math.Log(float64(max(m, 2)))
+	for node := range vectors.Len() {
+		level := int(-math.Log(1-r.Float64()) * levelMult)
+		idx.insert(vectors, node, level)
+	}
+	return idx
+}
+
+func (idx *Index) maxLinks(level int) int {
+	if level == 0 {
+		return 2 * idx.M
+	}
+	return idx.M
+}
+
+func (idx *Index) insert(vectors Vectors, node int, level int) {
+	idx.Links[node] = make([][]int32, level+1)
+	if idx.Entry < 0 {
+		idx.Entry = node
+		idx.MaxLevel = level
+		return
+	}
+
+	query := vectors.Row(node)
+	entry := idx.greedy(vectors, query, idx.Entry, idx.MaxLevel, level)
+	visited := newBitset(vectors.Len())
+	for l := min(level, idx.MaxLevel); l >= 0; l-- {
+		visited.clear()
+		candidates := idx.searchLayer(vectors, query, []int{entry}, idx.EfConstruction, l, visited)
+		neighbors := candidates[:min(idx.M, len(candidates))]
+
+		idx.Links[node][l] = make([]int32, len(neighbors))
+		for i, n := range neighbors {
+			idx.Links[node][l][i] = int32(n.Node)
+			idx.connect(vectors, n.Node, node, l)
+		}
+		entry = candidates[0].Node
+	}
+
+	if level > idx.MaxLevel {
+		idx.Entry = node
+		idx.MaxLevel = level
+	}
+}
+
+// connect 给 from 增加指向 to 的边，超出上限时只保留与 from 最相似的邻居
+func (idx *Index) connect(vectors Vectors, from int, to int, level int) {
+	links := append(idx.Links[from][level], int32(to))
+	if len(links) > idx.maxLinks(level) {
+		base := vectors.Row(from)
+		sort.Slice(links, func(i, j int) bool {
+			return dot32(base, vectors.Row(int(links[i]))) > dot32(base, vectors.Row(int(links[j])))
+		})
+		links = links[:idx.maxLinks(level)]
+	}
+	idx.Links[from][level] = links
+}
+
+// greedy 从 entry 出发在 top 到 bottom+1 层逐层贪心走向最相似的节点
+func (idx *Index) greedy(vectors Vectors, query []float32, entry int, top int, bottom int) int {
+	best := dot32(query, vectors.Row(entry))
+	for l := top; l > bottom; l-- {
+		for changed := true; changed; {
+			changed = false
+			for _, n := range idx.Links[entry][l] {
+				if sim := dot32(query, vectors.Row(int(n))); sim > best {
+					best = sim
+					entry = int(n)
+					changed = true
+				}
+			}
+		}
+	}
+	return entry
+}
+
+// searchLayer 在指定层做宽度为 ef 的最佳优先搜索，按相似度降序返回
+func (idx *Index) searchLayer(vectors Vectors, query []float32, entries []int, ef int, level int, visited bitset) []Neighbor {
+	candidates := &maxHeap{}
+	results := &minHeap{}
+	for _, e := range entries {
+		visited.set(e)
+		n := Neighbor{e, dot32(query, vectors.Row(e))}
+		heap.Push(candidates, n)
+		heap.Push(results, n)
+	}
+
+	for candidates.Len() > 0 {
+		c := heap.Pop(candidates).(Neighbor)
+		if results.Len() >= ef && c.Similarity < (*results)[0].Similarity {
+			break
+		}
+		if level >= len(idx.Links[c.Node]) {
+			continue
+		}
+		for _, link := range idx.Links[c.Node][level] {
+			n := int(link)
+			if visited.has(n) {
+				continue
+			}
+			visited.set(n)
+
+			sim := dot32(query, vectors.Row(n))
+			if results.Len() < ef || sim > (*results)[0].Similarity {
+				heap.Push(candidates, Neighbor{n, sim})
+				heap.Push(results, Neighbor{n, sim})
+				if results.Len() > ef {
+					heap.Pop(results)
+				}
+			}
+		}
+	}
+
+	sorted := make([]Neighbor, results.Len())
+	for i := len(sorted) - 1; i >= 0; i-- {
+		sorted[i] = heap.Pop(results).(Neighbor)
+	}
+	return sorted
+}
+
+// Search 返回与 query 最相似的 n 个节点，ef 越大召回越高、越慢，小于 n 时按 n 计
+func (idx *Index) Search(vectors Vectors, query []float32, n int, ef int) []Neighbor {
+	if idx.Entry < 0 || n <= 0 {
+		return nil
+	}
+	entry := idx.greedy(vectors, query, idx.Entry, idx.MaxLevel, 0)
+	results := idx.searchLayer(vectors, query, []int{entry}, max(ef, n), 0, newBitset(vectors.Len()))
+	return results[:min(n, len(results))]
+}
+
+func dot32(a, b []float32) float64 {
+	var sum float32
+	for i := range a {
+		sum += a[i] * b[i]
+	}
+	return float64(sum)
+}
+
+type bitset []uint64
+
+func newBitset(n int) bitset {
+	return make(bitset, (n+63)/64)
+}
+
+func (b bitset) set(i int) {
+	b[i/64] |= 1 << (i % 64)
+}
+
+func (b bitset) has(i int) bool {
+	return b[i/64]&(1<<(i%64)) != 0
+}
+
+func (b bitset) clear() {
+	clear(b)
+}
+
+// maxHeap 按相似度从高到低弹出
+type maxHeap []Neighbor
+
+func (h maxHeap) Len() int           { return len(h) }
+func (h maxHeap) Less(i, j int) bool { return h[i].Similarity > h[j].Similarity }
+func (h maxHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *maxHeap) Push(x any)        { *h = append(*h, x.(Neighbor)) }
+func (h *maxHeap) Pop() any {
+	old := *h
+	n := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return n
+}
+
+// minHeap 按相似度从低到高弹出，堆顶为当前结果中最差的一个
+type minHeap []Neighbor
+
+func (h minHeap) Len() int           { return len(h) }
+func (h minHeap) Less(i, j int) bool { return h[i].Similarity < h[j].Similarity }
+func (h minHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *minHeap) Push(x any)        { *h = append(*h, x.(Neighbor)) }
+func (h *minHeap) Pop() any {
+	old := *h
+	n := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return n
+}
@@ -0,0 +1,128 @@
+package hnsw
+
+import (
+	"math"
+	"math/rand"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+// testVectors 行优先存放的归一化随机向量
+type testVectors struct {
+	dim  int
+	data []float32
+}
+
+func (v *testVectors) Len() int            { return len(v.data) / v.dim }
+func (v *testVectors) Row(i int) []float32 { return v.data[i*v.dim : (i+1)*v.dim] }
+
+func randomVectors(r *rand.Rand, n int, dim int) *testVectors {
+	v := &testVectors{dim: dim, data: make([]float32, n*dim)}
+	for i := range n {
+		row := v.Row(i)
+		var norm float64
+		for d := range row {
+			row[d] = float32(r.NormFloat64())
+			norm += float64(row[d] * row[d])
+		}
+		for d := range row {
+			row[d] /= float32(math.Sqrt(norm))
+		}
+	}
+	return v
+}
+
+func bruteForce(vectors Vectors, query []float32, n int) []int {
+	nodes := make([]int, vectors.Len())
+	for i := range nodes {
+		nodes[i] = i
+	}
+	sort.Slice(nodes, func(i, j int) bool {
+		return dot32(query, vectors.Row(nodes[i])) > dot32(query, vectors.Row(nodes[j]))
+	})
+	return nodes[:n]
+}
+
+func recall(idx *Index, vectors Vectors, queries *testVectors, n int, ef int) float64 {
+	found := 0
+	for q := range queries.Len() {
+		truth := map[int]bool{}
+		for _, node := range bruteForce(vectors, queries.Row(q), n) {
+			truth[node] = true
+		}
+		for _, neighbor := range idx.Search(vectors, queries.Row(q), n, ef) {
+			if truth[neighbor.Node] {
+				found++
+			}
+		}
+	}
+	return float64(found) / float64(n*queries.Len())
+}
+
+func TestSearchRecall(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	vectors := randomVectors(r, 2000, 16)
+	queries := randomVectors(r, 50, 16)
+
+	idx := Build(vectors, nil, 16, 100, 1)
+	if got := recall(idx, vectors, queries, 10, 100); got < 0.95 {
+		t.Errorf("expected recall@10 >= 0.95 with ef=100, got %.3f", got)
+	}
+	if low, high := recall(idx, vectors, queries, 10, 10), recall(idx, vectors, queries, 10, 200); low > high {
+		t.Errorf("recall should not drop with larger ef: %.3f > %.3f", low, high)
+	}
+}
+
+func TestSearchFindsItself(t *testing.T) {
+	vectors := randomVectors(rand.New(rand.NewSource(2)), 500, 8)
+	idx := Build(vectors, nil, 8, 50, 1)
+
+	for i := range vectors.Len() {
+		results := idx.Search(vectors, vectors.Row(i), 1, 50)
+		if len(results) != 1 || results[0].Node != i {
+			t.Fatalf("node %d not found, got %+v", i, results)
+		}
+	}
+}
+
+func TestSaveLoad(t *testing.T) {
+	vectors := randomVectors(rand.New(rand.NewSource(3)), 300, 8)
+	ids := make([]uint, vectors.Len())
+	for i := range ids {
+		ids[i] = uint(i + 10)
+	}
+	idx := Build(vectors, ids, 8, 50, 1)
+
+	path := filepath.Join(t.TempDir(), "index.hnsw")
+	if err := idx.Save(path); err != nil {
+		t.Fatalf("save failed: %s", err)
+	}
+	loaded, err := Load(path)
+	if err != nil {
+		t.Fatalf("load failed: %s", err)
+	}
+
+	if !loaded.Matches(ids) || loaded.Matches(ids[1:]) {
+		t.Errorf("loaded index should match exactly the saved ids")
+	}
+	query := vectors.Row(42)
+	expected := idx.Search(vectors, query, 5, 20)
+	got := loaded.Search(vectors, query, 5, 20)
+	for i := range expected {
+		if got[i] != expected[i] {
+			t.Fatalf("result #%d differs: expected %+v, got %+v", i, expected[i], got[i])
+		}
+	}
+
+	if _, err := Load(filepath.Join(t.TempDir(), "missing.hnsw")); err == nil {
+		t.Error("expected an error for missing file")
+	}
+}
+
+func TestEmptyIndex(t *testing.T) {
+	idx := Build(&testVectors{dim: 2}, nil, 4, 10, 1)
+	if results := idx.Search(&testVectors{dim: 2}, []float32{1, 0}, 3, 10); len(results) != 0 {
+		t.Errorf("expected no results, got %+v", results)
+	}
+}
@@ -0,0 +1,22 @@
+package job
+
+import "yggdrasil/sim-words/internal/base"
+
+const (
+	StatusRunning  = "running"
+	StatusEmbedded = "embedded"
+	StatusDone     = "done"
+	StatusFailed   = "failed"
+)
+
+// LoadJob 记录一次 load 的进度，用于中断后续跑
+type LoadJob struct {
+	base.BaseModel
+	Input  string
+	Model  string `gorm:"index"`
+	Status string
+	// Total 本次需要嵌入化的单词数，不含续跑时已嵌入的单词
+	Total    int
+	Embedded int
+	Error    string
+}
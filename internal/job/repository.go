@@ -0,0 +1,41 @@
+package job
+
+import (
+	"errors"
+
+	"gorm.io/gorm"
+)
+
+func CreateJob(db *gorm.DB, job *LoadJob) error {
+	db.AutoMigrate(&LoadJob{})
+	return db.Create(job).Error
+}
+
+func UpdateJob(db *gorm.DB, job *LoadJob) error {
+	return db.Save(job).Error
+}
+
+// FindUnfinished 返回同一输入和模型最近一次未完成的任务，不存在时返回 nil
+func FindUnfinished(db *gorm.DB, input string, model string) (*LoadJob, error) {
+	db.AutoMigrate(&LoadJob{})
+
+	var job LoadJob
+	err := db.
+		Where("input = ? AND model = ? AND status <> ?", input, model, StatusDone).
+		Order("id DESC").
+		First(&job).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// FinishJob 将同一输入和模型的未完成任务标记为完成
+func FinishJob(db *gorm.DB, input string, model string) error {
+	return db.Model(&LoadJob{}).
+		Where("input = ? AND model = ? AND status <> ?", input, model, StatusDone).
+		Update("status", StatusDone).Error
+}
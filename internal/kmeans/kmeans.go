@@ -1,56 +1,443 @@
 package kmeans
 
 import (
+	"fmt"
 	"log"
 	"math"
 	"math/rand"
 	"runtime"
+	"sort"
 	"yggdrasil/sim-words/internal/base"
 	"yggdrasil/sim-words/internal/word"
 )
 
-func KMeans(words []word.WordEmbedding, k int, maxIter int) ([][]float64, []uint) {
+// Init 初始中心的选取方式
+type Init string
+
+const (
+	// InitRandom 随机选取 k 个不同的单词
+	InitRandom Init = "random"
+	// InitPlusPlus k-means++：按与已选中心距离的平方加权依次抽样
+	InitPlusPlus Init = "kmeans++"
+	// InitParallel k-means||：每轮并行过采样约 2k 个候选，再在加权候选上做 k-means++，适合单词很多时
+	InitParallel Init = "kmeans||"
+)
+
+// ParseInit 解析初始化方式
+func ParseInit(s string) (Init, error) {
+	switch init := Init(s); init {
+	case InitRandom, InitPlusPlus, InitParallel:
+		return init, nil
+	}
+	return "", fmt.Errorf("unknown k-means init %s, expected random, kmeans++ or kmeans||", s)
+}
+
+// Algorithm 聚类算法
+type Algorithm string
+
+const (
+	// Lloyd 按欧氏距离分配，中心取均值
+	Lloyd Algorithm = "lloyd"
+	// Spherical 球面 k-means：按与中心的点积分配，每轮把中心重新归一化，与按余弦相似度查询一致
+	Spherical Algorithm = "spherical"
+)
+
+// ParseAlgorithm 解析聚类算法
+func ParseAlgorithm(s string) (Algorithm, error) {
+	switch algorithm := Algorithm(s); algorithm {
+	case Lloyd, Spherical:
+		return algorithm, nil
+	}
+	return "", fmt.Errorf("unknown clustering algorithm %s, expected lloyd or spherical", s)
+}
+
+// parallelRounds k-means|| 的过采样轮数
+const parallelRounds = 5
+
+// Options k-means 参数
+type Options struct {
+	K         int
+	MaxIter   int
+	Init      Init
+	Algorithm Algorithm
+	// Seed 随机种子，相同的种子与输入得到相同的结果
+	Seed int64
+	// Restarts 以不同的初始中心重复运行的次数，保留惯性最小的结果，不足 1 时视为 1
+	Restarts int
+
+	// BatchSize 大于 0 时使用 mini-batch k-means，每批抽取这么多个单词
+	BatchSize int
+	// Schedule mini-batch 的学习率方式
+	Schedule Schedule
+	// LearningRate ScheduleDecay 的初始学习率
+	LearningRate float64
+	// Tolerance 一轮（mini-batch 为一批）内最大中心移动距离的平方不超过此值时结束
+	Tolerance float64
+	// Patience mini-batch 批次惯性连续这么多批没有下降时结束，0 表示不检查
+	Patience int
+}
+
+// Result 一次聚类的结果与收敛情况
+type Result struct {
+	Centers [][]float64
+	// Assignments 每个单词所属中心的下标
+	Assignments []uint
+	// Inertia 每个单词到所属中心距离平方之和
+	Inertia float64
+	// History 每轮分配后的惯性；mini-batch 为每批的平均惯性的滑动平均
+	History []float64
+	// Iterations 迭代轮数或 mini-batch 批次数
+	Iterations int
+	// Converged 是否在达到最大轮数之前收敛
+	Converged bool
+	// Sizes 每个簇的单词数
+	Sizes []int
+	// Reseeded 因为空簇重新选取中心的次数
+	Reseeded int
+}
+
+func KMeans(words []word.WordEmbedding, opts Options) Result {
+	r := rand.New(rand.NewSource(opts.Seed))
+
+	var best Result
+	best.Inertia = math.Inf(1)
+	for restart := range max(opts.Restarts, 1) {
+		var result Result
+		if opts.BatchSize > 0 {
+			result = runMiniBatch(words, opts, r)
+		} else {
+			result = run(words, opts, r)
+		}
+		result.Inertia = Inertia(words, result.Centers, result.Assignments)
+		result.Sizes = sizes(result.Assignments, opts.K)
+		log.Printf("k-means run %d: inertia %.6g after %d iterations, converged %t", restart, result.Inertia, result.Iterations, result.Converged)
+		if result.Inertia < best.Inertia {
+			best = result
+		}
+	}
+	return best
+}
+
+// run 从一组新的初始中心开始运行一次 k-means。没有单词改变所属的簇，
+// 或全部中心移动距离的平方都不超过 Tolerance 时结束
+func run(words []word.WordEmbedding, opts Options, r *rand.Rand) Result {
 	n := len(words)
 	dim := len(words[0].NormalizedEmbedding)
 
 	// 1. 初始化中心
-	centers := initCenters(words, k)
+	centers := initCenters(words, opts.K, opts.Init, r)
+	if opts.Algorithm == Spherical {
+		for _, c := range centers {
+			normalize(c)
+		}
+	}
 
-	clusterIDs := make([]uint, n)
+	result := Result{Centers: centers, Assignments: make([]uint, n)}
+	clusterIDs := result.Assignments
+	dists := make([]float64, n)
+	previous := make([][]float64, len(centers))
+	for i := range previous {
+		previous[i] = make([]float64, dim)
+	}
 
-	for itr := range maxIter {
-		log.Printf("k-means iteration %d / %d", itr, maxIter)
+	for itr := range opts.MaxIter {
+		if itr%10 == 0 {
+			log.Printf("k-means iteration %d / %d", itr, opts.MaxIter)
+		}
+		result.Iterations = itr + 1
 
 		// 2. 分配阶段
-		changed := assignClusters(words, centers, clusterIDs)
+		changed := assignClusters(words, centers, clusterIDs, dists, opts.Algorithm)
+		var inertia float64
+		for _, d := range dists {
+			inertia += d
+		}
+		result.History = append(result.History, inertia)
+
+		// 空簇以离所属中心最远的单词重新开始
+		if reseeded := reseedEmpty(words, centers, clusterIDs, dists); reseeded > 0 {
+			result.Reseeded += reseeded
+			changed = true
+		}
 
 		// 3. 更新中心
+		for i := range centers {
+			copy(previous[i], centers[i])
+		}
 		updateCenters(words, centers, clusterIDs, dim)
+		var shift float64
+		for i, c := range centers {
+			if opts.Algorithm == Spherical {
+				normalize(c)
+			}
+			shift = max(shift, base.Distance(c, previous[i]))
+		}
 
-		if !changed {
-			log.Println("k-means reached convergence")
+		if !changed || shift <= opts.Tolerance {
+			log.Printf("k-means reached convergence after %d iterations", itr+1)
+			result.Converged = true
 			break
 		}
 	}
 
-	return centers, clusterIDs
+	return result
 }
 
-func initCenters(words []word.WordEmbedding, k int) [][]float64 {
-	n := len(words)
-	centers := make([][]float64, k)
+// reseedEmpty 把空簇的中心设为离所属中心最远的单词，并把该单词移入空簇，返回重新选取的簇数。
+// 只从单词数多于 1 的簇中选取，不会产生新的空簇；单词不足 k 个时部分簇仍为空
+func reseedEmpty(words []word.WordEmbedding, centers [][]float64, clusterIDs []uint, dists []float64) int {
+	counts := sizes(clusterIDs, len(centers))
+	var empty []int
+	for c, count := range counts {
+		if count == 0 {
+			empty = append(empty, c)
+		}
+	}
+	if len(empty) == 0 {
+		return 0
+	}
 
-	for i := range k {
-		idx := rand.Intn(n)
+	order := make([]int, len(words))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return dists[order[i]] > dists[order[j]]
+	})
+
+	reseeded := 0
+	next := 0
+	for _, c := range empty {
+		for next < len(order) && counts[clusterIDs[order[next]]] <= 1 {
+			next++
+		}
+		if next == len(order) {
+			break
+		}
+		i := order[next]
+		next++
+
+		counts[clusterIDs[i]]--
+		counts[c]++
+		clusterIDs[i] = uint(c)
+		dists[i] = 0
+		copy(centers[c], words[i].NormalizedEmbedding)
+		reseeded++
+	}
+	return reseeded
+}
+
+// sizes 每个簇的单词数
+func sizes(clusterIDs []uint, k int) []int {
+	counts := make([]int, k)
+	for _, c := range clusterIDs {
+		counts[c]++
+	}
+	return counts
+}
+
+// Inertia 每个单词到所属中心距离平方之和。单词与球面 k-means 的中心都是单位向量，
+// 此时距离平方等于 2-2cos，与余弦目标的排序一致
+func Inertia(words []word.WordEmbedding, centers [][]float64, clusterIDs []uint) float64 {
+	var sum float64
+	for i, w := range words {
+		sum += base.Distance(w.NormalizedEmbedding, centers[clusterIDs[i]])
+	}
+	return sum
+}
+
+func initCenters(words []word.WordEmbedding, k int, init Init, r *rand.Rand) [][]float64 {
+	var picked []int
+	switch init {
+	case InitPlusPlus:
+		picked = initPlusPlus(words, k, r)
+	case InitParallel:
+		picked = initParallel(words, k, r)
+	default:
+		// 不重复地选取，单词不足 k 个时允许重复
+		for len(picked) < k {
+			picked = append(picked, r.Perm(len(words))[:min(k-len(picked), len(words))]...)
+		}
+	}
+
+	centers := make([][]float64, k)
+	for i, idx := range picked {
 		vec := make([]float64, len(words[idx].NormalizedEmbedding))
 		copy(vec, words[idx].NormalizedEmbedding)
 		centers[i] = vec
 	}
-
 	return centers
 }
 
-func assignClusters(words []word.WordEmbedding, centers [][]float64, clusterIDs []uint) bool {
+// initPlusPlus 第一个中心均匀抽取，之后每个中心按到最近已选中心距离的平方加权抽取
+func initPlusPlus(words []word.WordEmbedding, k int, r *rand.Rand) []int {
+	n := len(words)
+	picked := []int{r.Intn(n)}
+	dists := make([]float64, n)
+	for i := range dists {
+		dists[i] = math.MaxFloat64
+	}
+	for len(picked) < k {
+		updateDistances(words, words[picked[len(picked)-1]].NormalizedEmbedding, dists)
+		picked = append(picked, sample(dists, r))
+	}
+	return picked
+}
+
+// initParallel k-means||：每轮以概率 l*d²/Σd² 独立地选取候选，
+// 结束后按离每个候选最近的单词数为候选加权，再在候选上做 k-means++
+func initParallel(words []word.WordEmbedding, k int, r *rand.Rand) []int {
+	n := len(words)
+	oversampling := 2 * float64(k)
+	candidates := []int{r.Intn(n)}
+	dists := make([]float64, n)
+	for i := range dists {
+		dists[i] = math.MaxFloat64
+	}
+	updateDistances(words, words[candidates[0]].NormalizedEmbedding, dists)
+
+	for range parallelRounds {
+		var total float64
+		for _, d := range dists {
+			total += d
+		}
+		if total == 0 {
+			break
+		}
+		var chosen []int
+		for i, d := range dists {
+			if r.Float64() < oversampling*d/total {
+				chosen = append(chosen, i)
+			}
+		}
+		for _, i := range chosen {
+			updateDistances(words, words[i].NormalizedEmbedding, dists)
+		}
+		candidates = append(candidates, chosen...)
+	}
+	if len(candidates) <= k {
+		// 候选不足时用 k-means++ 补齐
+		return initPlusPlus(words, k, r)
+	}
+
+	// 候选的权重为离它最近的单词数
+	candidateWords := make([]word.WordEmbedding, len(candidates))
+	for i, idx := range candidates {
+		candidateWords[i] = words[idx]
+	}
+	weights := make([]float64, len(candidates))
+	nearest := make([]uint, n)
+	assignClusters(words, embeddings(candidateWords), nearest, nil, Lloyd)
+	for _, c := range nearest {
+		weights[c]++
+	}
+
+	// 在加权候选上做 k-means++
+	picked := []int{sample(weights, r)}
+	dists = make([]float64, len(candidates))
+	for i := range dists {
+		dists[i] = math.MaxFloat64
+	}
+	for len(picked) < k {
+		updateDistances(candidateWords, candidateWords[picked[len(picked)-1]].NormalizedEmbedding, dists)
+		scores := make([]float64, len(candidates))
+		for i := range scores {
+			scores[i] = weights[i] * dists[i]
+		}
+		picked = append(picked, sample(scores, r))
+	}
+	for i, c := range picked {
+		picked[i] = candidates[c]
+	}
+	return picked
+}
+
+func embeddings(words []word.WordEmbedding) [][]float64 {
+	vectors := make([][]float64, len(words))
+	for i, w := range words {
+		vectors[i] = w.NormalizedEmbedding
+	}
+	return vectors
+}
+
+// updateDistances 并行地把 dists 更新为到最近已选中心距离的平方
+func updateDistances(words []word.WordEmbedding, center []float64, dists []float64) {
+	parallel(len(words), func(start, end int) {
+		for i := start; i < end; i++ {
+			dists[i] = min(dists[i], base.Distance(words[i].NormalizedEmbedding, center))
+		}
+	})
+}
+
+// sample 按权重抽取一个下标，权重全为 0 时均匀抽取
+func sample(weights []float64, r *rand.Rand) int {
+	var total float64
+	for _, w := range weights {
+		total += w
+	}
+	if total == 0 {
+		return r.Intn(len(weights))
+	}
+	target := r.Float64() * total
+	for i, w := range weights {
+		target -= w
+		if target < 0 {
+			return i
+		}
+	}
+	// 浮点误差时取最后一个权重非零的下标
+	for i := len(weights) - 1; ; i-- {
+		if weights[i] > 0 {
+			return i
+		}
+	}
+}
+
+// parallel 把 [0, n) 按 CPU 数分块并行执行
+func parallel(n int, fn func(start, end int)) {
+	numWorkers := runtime.NumCPU()
+	chunkSize := (n + numWorkers - 1) / numWorkers
+	done := make(chan struct{}, numWorkers)
+	for w := range numWorkers {
+		start := min(w*chunkSize, n)
+		end := min(start+chunkSize, n)
+		go func() {
+			fn(start, end)
+			done <- struct{}{}
+		}()
+	}
+	for range numWorkers {
+		<-done
+	}
+}
+
+// normalize 原地归一化中心，零向量保持不变
+func normalize(v []float64) {
+	var sum float64
+	for _, f := range v {
+		sum += f * f
+	}
+	if sum == 0 {
+		return
+	}
+	norm := math.Sqrt(sum)
+	for d := range v {
+		v[d] /= norm
+	}
+}
+
+// dot 向量内积
+func dot(a, b []float64) float64 {
+	var sum float64
+	for i := range a {
+		sum += a[i] * b[i]
+	}
+	return sum
+}
+
+// assignClusters 把每个单词分到最近的中心：Lloyd 按欧氏距离，Spherical 按点积。
+// dists 不为空时记录每个单词到所属中心距离的平方
+func assignClusters(words []word.WordEmbedding, centers [][]float64, clusterIDs []uint, dists []float64, algorithm Algorithm) bool {
 	n := len(words)
 	changed := false
 	numWorkers := runtime.NumCPU()
@@ -58,9 +445,8 @@ func assignClusters(words []word.WordEmbedding, centers [][]float64, clusterIDs
 	ch := make(chan bool, numWorkers)
 
 	for w := range numWorkers {
-		start := w * chunkSize
+		start := min(w*chunkSize, n)
 		end := min(start+chunkSize, n)
-		log.Printf("launch chunk %d - %d", start, end)
 
 		go func(start, end int) {
 			localChanged := false
@@ -68,12 +454,20 @@ func assignClusters(words []word.WordEmbedding, centers [][]float64, clusterIDs
 				minDist := math.MaxFloat64
 				var bestCluster uint = 0
 				for j, center := range centers {
-					dist := base.Distance(words[i].NormalizedEmbedding, center)
+					var dist float64
+					if algorithm == Spherical {
+						dist = -dot(words[i].NormalizedEmbedding, center)
+					} else {
+						dist = base.Distance(words[i].NormalizedEmbedding, center)
+					}
 					if dist < minDist {
 						minDist = dist
 						bestCluster = uint(j)
 					}
 				}
+				if dists != nil {
+					dists[i] = base.Distance(words[i].NormalizedEmbedding, centers[bestCluster])
+				}
 				if clusterIDs[i] != bestCluster {
 					clusterIDs[i] = bestCluster
 					localChanged = true
@@ -113,18 +507,15 @@ func updateCenters(words []word.WordEmbedding, centers [][]float64, clusterIDs [
 		}
 	}
 
-	// 求均值
+	// 求均值并替换
 	for i := range k {
 		if counts[i] == 0 {
+			// 无法重新选取的空簇保留原来的中心
 			continue
 		}
 		for d := range dim {
 			newCenters[i][d] /= float64(counts[i])
 		}
-	}
-
-	// 替换
-	for i := range k {
 		copy(centers[i], newCenters[i])
 	}
 }
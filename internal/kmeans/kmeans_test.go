@@ -0,0 +1,334 @@
+package kmeans
+
+import (
+	"math"
+	"math/rand"
+	"slices"
+	"testing"
+	"yggdrasil/sim-words/internal/base"
+	"yggdrasil/sim-words/internal/word"
+)
+
+func testWords(vectors ...[]float64) []word.WordEmbedding {
+	words := make([]word.WordEmbedding, len(vectors))
+	for i, v := range vectors {
+		words[i].NormalizedEmbedding = v
+	}
+	return words
+}
+
+func TestKMeansAssignsNearestCenter(t *testing.T) {
+	words := testWords(
+		[]float64{0, 0}, []float64{0.1, 0}, []float64{0, 0.1},
+		[]float64{5, 5}, []float64{5.1, 5}, []float64{5, 5.1},
+		[]float64{10, 0}, []float64{10.1, 0},
+	)
+	k := 3
+
+	result := KMeans(words, Options{K: k, MaxIter: 100, Init: InitPlusPlus, Seed: 1})
+	centers, clusterIDs := result.Centers, result.Assignments
+	if len(centers) != k {
+		t.Fatalf("expected %d centers, got %d", k, len(centers))
+	}
+	if len(clusterIDs) != len(words) {
+		t.Fatalf("expected %d assignments, got %d", len(words), len(clusterIDs))
+	}
+
+	for i, w := range words {
+		if int(clusterIDs[i]) >= k {
+			t.Fatalf("cluster id %d out of range", clusterIDs[i])
+		}
+		assigned := base.Distance(w.NormalizedEmbedding, centers[clusterIDs[i]])
+		for j, c := range centers {
+			if d := base.Distance(w.NormalizedEmbedding, c); d < assigned-1e-12 {
+				t.Errorf("word #%d assigned to %d but center %d is closer", i, clusterIDs[i], j)
+			}
+		}
+	}
+}
+
+func TestKMeansCentersAreMeans(t *testing.T) {
+	words := testWords([]float64{0, 0}, []float64{2, 0}, []float64{10, 10}, []float64{10, 12})
+
+	result := KMeans(words, Options{K: 2, MaxIter: 100, Init: InitPlusPlus, Seed: 1})
+	centers, clusterIDs := result.Centers, result.Assignments
+
+	for c := range centers {
+		sum := []float64{0, 0}
+		count := 0
+		for i, w := range words {
+			if int(clusterIDs[i]) == c {
+				sum[0] += w.NormalizedEmbedding[0]
+				sum[1] += w.NormalizedEmbedding[1]
+				count++
+			}
+		}
+		if count == 0 {
+			continue
+		}
+		if base.Distance(centers[c], []float64{sum[0] / float64(count), sum[1] / float64(count)}) > 1e-12 {
+			t.Errorf("center %d = %v is not the mean of its words", c, centers[c])
+		}
+	}
+}
+
+// randomWords 生成 groups 组围绕不同中心的二维点
+func randomWords(groups int, perGroup int, seed int64) []word.WordEmbedding {
+	r := rand.New(rand.NewSource(seed))
+	var vectors [][]float64
+	for g := range groups {
+		for range perGroup {
+			vectors = append(vectors, []float64{float64(g*10) + r.Float64(), float64(g%3*10) + r.Float64()})
+		}
+	}
+	return testWords(vectors...)
+}
+
+func TestInitCentersAreDistinct(t *testing.T) {
+	// k 等于单词数时，每个单词都应恰好被选中一次
+	words := randomWords(1, 8, 1)
+	for _, init := range []Init{InitRandom, InitPlusPlus, InitParallel} {
+		for seed := range int64(20) {
+			centers := initCenters(words, len(words), init, rand.New(rand.NewSource(seed)))
+			for i := range centers {
+				for j := range i {
+					if slices.Equal(centers[i], centers[j]) {
+						t.Fatalf("%s seed %d: centers %d and %d are the same word", init, seed, i, j)
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestKMeansIsReproducible(t *testing.T) {
+	words := randomWords(5, 40, 1)
+	for _, init := range []Init{InitRandom, InitPlusPlus, InitParallel} {
+		opts := Options{K: 5, MaxIter: 50, Init: init, Seed: 42}
+		first := KMeans(words, opts)
+		centers1, ids1 := first.Centers, first.Assignments
+		second := KMeans(words, opts)
+		centers2, ids2 := second.Centers, second.Assignments
+		if !slices.Equal(ids1, ids2) {
+			t.Fatalf("%s: assignments differ with the same seed", init)
+		}
+		for i := range centers1 {
+			if !slices.Equal(centers1[i], centers2[i]) {
+				t.Fatalf("%s: center %d differs with the same seed", init, i)
+			}
+		}
+	}
+}
+
+func TestKMeansPlusPlusFindsSeparatedGroups(t *testing.T) {
+	words := randomWords(5, 40, 2)
+	for _, init := range []Init{InitPlusPlus, InitParallel} {
+		ids := KMeans(words, Options{K: 5, MaxIter: 50, Init: init, Seed: 1, Restarts: 3}).Assignments
+		// 同组单词分到同一个簇，不同组分到不同的簇
+		seen := map[uint]bool{}
+		for g := range 5 {
+			id := ids[g*40]
+			if seen[id] {
+				t.Fatalf("%s: groups share cluster %d", init, id)
+			}
+			seen[id] = true
+			for i := g * 40; i < (g+1)*40; i++ {
+				if ids[i] != id {
+					t.Fatalf("%s: group %d is split", init, g)
+				}
+			}
+		}
+	}
+}
+
+func TestKMeansRestartsKeepLowestInertia(t *testing.T) {
+	words := randomWords(6, 20, 3)
+	// 第一次运行与单次运行的随机序列相同，多次重启的惯性不会更大
+	single := Options{K: 6, MaxIter: 50, Init: InitRandom, Seed: 7}
+	result := KMeans(words, single)
+	centers, ids := result.Centers, result.Assignments
+	restarted := single
+	restarted.Restarts = 5
+	best := KMeans(words, restarted)
+	if best.Inertia > Inertia(words, centers, ids) {
+		t.Fatalf("restarts should not increase inertia")
+	}
+}
+
+func TestParseInit(t *testing.T) {
+	if init, err := ParseInit("kmeans||"); err != nil || init != InitParallel {
+		t.Fatalf("expected kmeans||, got %s, %v", init, err)
+	}
+	if _, err := ParseInit("best"); err == nil {
+		t.Fatal("expected an error for an unknown init")
+	}
+}
+
+func TestSphericalKMeans(t *testing.T) {
+	// 方向相同但长度不同的向量属于同一个簇
+	words := testWords(
+		[]float64{1, 0.1}, []float64{3, 0.2}, []float64{0.5, 0.06},
+		[]float64{0.1, 1}, []float64{0.2, 4}, []float64{0.05, 0.6},
+	)
+	result := KMeans(words, Options{K: 2, MaxIter: 50, Init: InitPlusPlus, Algorithm: Spherical, Seed: 1})
+	centers, ids := result.Centers, result.Assignments
+
+	for c, center := range centers {
+		if norm := dot(center, center); math.Abs(norm-1) > 1e-9 {
+			t.Fatalf("center %d has squared norm %f", c, norm)
+		}
+	}
+	if ids[0] != ids[1] || ids[0] != ids[2] || ids[3] != ids[4] || ids[3] != ids[5] || ids[0] == ids[3] {
+		t.Fatalf("unexpected assignments %v", ids)
+	}
+	for i, w := range words {
+		for j, c := range centers {
+			if dot(w.NormalizedEmbedding, c) > dot(w.NormalizedEmbedding, centers[ids[i]])+1e-12 {
+				t.Errorf("word #%d assigned to %d but center %d has a larger dot product", i, ids[i], j)
+			}
+		}
+	}
+}
+
+func TestParseAlgorithm(t *testing.T) {
+	if algorithm, err := ParseAlgorithm("spherical"); err != nil || algorithm != Spherical {
+		t.Fatalf("expected spherical, got %s, %v", algorithm, err)
+	}
+	if _, err := ParseAlgorithm("dbscan"); err == nil {
+		t.Fatal("expected an error for an unknown algorithm")
+	}
+}
+
+func TestMiniBatchKMeans(t *testing.T) {
+	words := randomWords(5, 200, 4)
+	for _, schedule := range []Schedule{ScheduleCount, ScheduleDecay} {
+		opts := Options{
+			K: 5, MaxIter: 200, Init: InitPlusPlus, Seed: 1, Restarts: 2,
+			BatchSize: 64, Schedule: schedule, LearningRate: 0.5, Patience: 20,
+		}
+		result := KMeans(words, opts)
+		centers, ids := result.Centers, result.Assignments
+		if len(centers) != 5 || len(ids) != len(words) {
+			t.Fatalf("%s: unexpected result shape", schedule)
+		}
+		seen := map[uint]bool{}
+		for g := range 5 {
+			id := ids[g*200]
+			if seen[id] {
+				t.Fatalf("%s: groups share cluster %d", schedule, id)
+			}
+			seen[id] = true
+			for i := g * 200; i < (g+1)*200; i++ {
+				if ids[i] != id {
+					t.Fatalf("%s: group %d is split", schedule, g)
+				}
+			}
+		}
+
+		// 结果与全量 k-means 的惯性相近
+		fullOpts := opts
+		fullOpts.BatchSize = 0
+		full := KMeans(words, fullOpts)
+		if result.Inertia > 1.1*full.Inertia {
+			t.Errorf("%s: mini-batch inertia %f too far from %f", schedule, result.Inertia, full.Inertia)
+		}
+
+		again := KMeans(words, opts).Assignments
+		if !slices.Equal(ids, again) {
+			t.Errorf("%s: assignments differ with the same seed", schedule)
+		}
+	}
+}
+
+func TestMiniBatchStopsOnTolerance(t *testing.T) {
+	// 一组完全相同的点，中心第一批后不再移动
+	words := testWords([]float64{1, 0}, []float64{1, 0}, []float64{1, 0}, []float64{1, 0})
+	result := KMeans(words, Options{K: 1, MaxIter: 1000, Init: InitRandom, BatchSize: 2, Tolerance: 1e-12})
+	centers, ids := result.Centers, result.Assignments
+	if !slices.Equal(centers[0], []float64{1, 0}) || !slices.Equal(ids, []uint{0, 0, 0, 0}) {
+		t.Fatalf("unexpected result %v, %v", centers, ids)
+	}
+}
+
+func TestParseSchedule(t *testing.T) {
+	if schedule, err := ParseSchedule("decay"); err != nil || schedule != ScheduleDecay {
+		t.Fatalf("expected decay, got %s, %v", schedule, err)
+	}
+	if _, err := ParseSchedule("adam"); err == nil {
+		t.Fatal("expected an error for an unknown schedule")
+	}
+}
+
+func TestKMeansReseedsEmptyClusters(t *testing.T) {
+	// 两个初始中心相同时其中一个簇为空，应由离中心最远的单词重新开始
+	words := testWords(
+		[]float64{0, 0}, []float64{0.1, 0}, []float64{0, 0.1},
+		[]float64{10, 10}, []float64{10.1, 10},
+	)
+	centers := [][]float64{{0, 0}, {0, 0}}
+	clusterIDs := make([]uint, len(words))
+	dists := make([]float64, len(words))
+	assignClusters(words, centers, clusterIDs, dists, Lloyd)
+	if reseeded := reseedEmpty(words, centers, clusterIDs, dists); reseeded != 1 {
+		t.Fatalf("expected 1 reseeded cluster, got %d", reseeded)
+	}
+	if !slices.Equal(centers[1], []float64{10.1, 10}) || clusterIDs[4] != 1 {
+		t.Fatalf("expected the farthest word to seed cluster 1, got %v, %v", centers, clusterIDs)
+	}
+
+	// 单词不足 k 个时不会出现 panic，多出的簇保持为空
+	result := KMeans(words[:2], Options{K: 3, MaxIter: 10, Init: InitRandom})
+	if len(result.Sizes) != 3 || result.Sizes[0]+result.Sizes[1]+result.Sizes[2] != 2 {
+		t.Fatalf("unexpected sizes %v", result.Sizes)
+	}
+
+	// 无法重新选取的空簇保留原来的中心，而不是变成零向量
+	centers = [][]float64{{0, 0.05}, {10, 10}, {5, 5}}
+	updateCenters(words, centers, []uint{0, 0, 0, 1, 1}, 2)
+	if !slices.Equal(centers[2], []float64{5, 5}) {
+		t.Fatalf("expected the empty cluster to keep its center, got %v", centers[2])
+	}
+	if !slices.Equal(centers[1], []float64{10.05, 10}) {
+		t.Fatalf("expected the mean of cluster 1, got %v", centers[1])
+	}
+}
+
+func TestKMeansResult(t *testing.T) {
+	words := randomWords(4, 30, 5)
+	result := KMeans(words, Options{K: 4, MaxIter: 100, Init: InitPlusPlus, Seed: 1})
+
+	if !result.Converged || result.Iterations == 0 || len(result.History) != result.Iterations {
+		t.Fatalf("unexpected convergence: %d iterations, history %v, converged %t",
+			result.Iterations, result.History, result.Converged)
+	}
+	for i := 1; i < len(result.History); i++ {
+		if result.History[i] > result.History[i-1]+1e-9 {
+			t.Fatalf("inertia increased at iteration %d: %v", i, result.History)
+		}
+	}
+	total := 0
+	for _, size := range result.Sizes {
+		if size == 0 {
+			t.Fatalf("unexpected empty cluster: %v", result.Sizes)
+		}
+		total += size
+	}
+	if total != len(words) {
+		t.Fatalf("sizes %v do not add up to %d", result.Sizes, len(words))
+	}
+	if math.Abs(result.Inertia-Inertia(words, result.Centers, result.Assignments)) > 1e-9 {
+		t.Fatalf("inertia %f does not match the assignments", result.Inertia)
+	}
+}
+
+func TestKMeansStopsOnTolerance(t *testing.T) {
+	words := randomWords(4, 30, 6)
+	exact := KMeans(words, Options{K: 4, MaxIter: 100, Init: InitRandom, Seed: 3})
+	loose := KMeans(words, Options{K: 4, MaxIter: 100, Init: InitRandom, Seed: 3, Tolerance: 1e3})
+	if loose.Iterations != 1 || !loose.Converged {
+		t.Fatalf("expected to stop after 1 iteration, got %d", loose.Iterations)
+	}
+	if exact.Iterations < loose.Iterations {
+		t.Fatalf("tolerance should not add iterations")
+	}
+}
@@ -0,0 +1,125 @@
+package kmeans
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"math/rand"
+	"yggdrasil/sim-words/internal/base"
+	"yggdrasil/sim-words/internal/word"
+)
+
+// Schedule mini-batch k-means 中心更新的学习率
+type Schedule string
+
+const (
+	// ScheduleCount 每个中心的学习率为 1/该中心累计分到的样本数，中心是这些样本的滑动均值
+	ScheduleCount Schedule = "count"
+	// ScheduleDecay 全部中心共用学习率 LearningRate/√(1+t)，t 为批次序号
+	ScheduleDecay Schedule = "decay"
+)
+
+// ParseSchedule 解析学习率方式
+func ParseSchedule(s string) (Schedule, error) {
+	switch schedule := Schedule(s); schedule {
+	case ScheduleCount, ScheduleDecay:
+		return schedule, nil
+	}
+	return "", fmt.Errorf("unknown learning rate schedule %s, expected count or decay", s)
+}
+
+// runMiniBatch 每批随机抽取 BatchSize 个单词更新中心，MaxIter 为最大批次数。
+// 最大中心移动距离低于 Tolerance，或批次惯性的滑动平均连续 Patience 批没有下降时提前结束，
+// 最后对全部单词做一次分配，空簇以离所属中心最远的单词重新选取中心
+func runMiniBatch(words []word.WordEmbedding, opts Options, r *rand.Rand) Result {
+	n := len(words)
+	k := opts.K
+
+	centers := initCenters(words, k, opts.Init, r)
+	if opts.Algorithm == Spherical {
+		for _, c := range centers {
+			normalize(c)
+		}
+	}
+
+	batchSize := min(opts.BatchSize, n)
+	batch := make([]word.WordEmbedding, batchSize)
+	batchIDs := make([]uint, batchSize)
+	counts := make([]float64, k)
+	previous := make([][]float64, k)
+	for i := range previous {
+		previous[i] = make([]float64, len(centers[i]))
+	}
+
+	// 批次惯性的指数滑动平均，平滑系数与 batch 占全体的比例相当
+	alpha := min(2*float64(batchSize)/float64(n+1), 1)
+	ewa, best := math.NaN(), math.Inf(1)
+	noImprovement := 0
+	result := Result{Centers: centers}
+
+	for itr := range opts.MaxIter {
+		for i := range batch {
+			batch[i] = words[r.Intn(n)]
+		}
+		result.Iterations = itr + 1
+		assignClusters(batch, centers, batchIDs, nil, opts.Algorithm)
+		for i := range centers {
+			copy(previous[i], centers[i])
+		}
+
+		// 按分配前的中心计算批次惯性，再逐个样本把中心拉向样本
+		var inertia float64
+		for i, w := range batch {
+			inertia += base.Distance(w.NormalizedEmbedding, centers[batchIDs[i]])
+		}
+		inertia /= float64(batchSize)
+		rate := opts.LearningRate / math.Sqrt(1+float64(itr))
+		for i, w := range batch {
+			c := batchIDs[i]
+			counts[c]++
+			if opts.Schedule != ScheduleDecay {
+				rate = 1 / counts[c]
+			}
+			for d, f := range w.NormalizedEmbedding {
+				centers[c][d] += rate * (f - centers[c][d])
+			}
+		}
+
+		var shift float64
+		for i, c := range centers {
+			if opts.Algorithm == Spherical {
+				normalize(c)
+			}
+			shift = max(shift, base.Distance(c, previous[i]))
+		}
+
+		if math.IsNaN(ewa) {
+			ewa = inertia
+		} else {
+			ewa = alpha*inertia + (1-alpha)*ewa
+		}
+		result.History = append(result.History, ewa)
+		if itr%100 == 0 {
+			log.Printf("mini-batch k-means batch %d / %d: inertia %.6g, center shift %.3g", itr, opts.MaxIter, ewa, shift)
+		}
+
+		if shift <= opts.Tolerance {
+			log.Printf("mini-batch k-means converged after %d batches", itr+1)
+			result.Converged = true
+			break
+		}
+		if ewa < best {
+			best, noImprovement = ewa, 0
+		} else if noImprovement++; opts.Patience > 0 && noImprovement >= opts.Patience {
+			log.Printf("mini-batch k-means stopped after %d batches without improvement", itr+1)
+			result.Converged = true
+			break
+		}
+	}
+
+	result.Assignments = make([]uint, n)
+	dists := make([]float64, n)
+	assignClusters(words, centers, result.Assignments, dists, opts.Algorithm)
+	result.Reseeded = reseedEmpty(words, centers, result.Assignments, dists)
+	return result
+}
@@ -0,0 +1,208 @@
+package kmeans
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"math/rand"
+	"yggdrasil/sim-words/internal/base"
+	"yggdrasil/sim-words/internal/word"
+)
+
+// Criterion 自动选择 k 的依据
+type Criterion string
+
+const (
+	// CriterionSilhouette 轮廓系数最大
+	CriterionSilhouette Criterion = "silhouette"
+	// CriterionDaviesBouldin Davies–Bouldin 指数最小
+	CriterionDaviesBouldin Criterion = "davies-bouldin"
+	// CriterionElbow 惯性曲线的拐点：归一化后离首尾连线最远的点
+	CriterionElbow Criterion = "elbow"
+)
+
+// ParseCriterion 解析选择 k 的依据
+func ParseCriterion(s string) (Criterion, error) {
+	switch criterion := Criterion(s); criterion {
+	case CriterionSilhouette, CriterionDaviesBouldin, CriterionElbow:
+		return criterion, nil
+	}
+	return "", fmt.Errorf("unknown criterion %s, expected silhouette, davies-bouldin or elbow", s)
+}
+
+// Score 一个 k 的聚类质量
+type Score struct {
+	K          int
+	Inertia    float64
+	Silhouette float64
+	// DaviesBouldin 越小越好
+	DaviesBouldin float64
+	Iterations    int
+}
+
+// Tune 对每个 k 聚类并计算惯性、抽样轮廓系数与 Davies–Bouldin 指数。
+// 轮廓系数只在抽取的 silhouetteSample 个单词之间计算，0 表示使用全部单词
+func Tune(words []word.WordEmbedding, ks []int, opts Options, silhouetteSample int) ([]Score, error) {
+	r := rand.New(rand.NewSource(opts.Seed))
+	sample := r.Perm(len(words))
+	if silhouetteSample > 0 {
+		sample = sample[:min(silhouetteSample, len(words))]
+	}
+
+	scores := make([]Score, 0, len(ks))
+	for _, k := range ks {
+		if k < 2 || k > len(words) {
+			return nil, fmt.Errorf("k=%d is out of range [2, %d]", k, len(words))
+		}
+		opts.K = k
+		result := KMeans(words, opts)
+		score := Score{
+			K:             k,
+			Inertia:       result.Inertia,
+			Silhouette:    Silhouette(words, result.Assignments, sample),
+			DaviesBouldin: DaviesBouldin(words, result.Centers, result.Assignments),
+			Iterations:    result.Iterations,
+		}
+		log.Printf("k=%d: inertia %.6g, silhouette %.4f, davies-bouldin %.4f", k, score.Inertia, score.Silhouette, score.DaviesBouldin)
+		scores = append(scores, score)
+	}
+	return scores, nil
+}
+
+// Choose 按依据从 scores 中选出最好的 k
+func Choose(scores []Score, criterion Criterion) int {
+	best := 0
+	switch criterion {
+	case CriterionDaviesBouldin:
+		for i, s := range scores {
+			if s.DaviesBouldin < scores[best].DaviesBouldin {
+				best = i
+			}
+		}
+	case CriterionElbow:
+		best = elbow(scores)
+	default:
+		for i, s := range scores {
+			if s.Silhouette > scores[best].Silhouette {
+				best = i
+			}
+		}
+	}
+	return scores[best].K
+}
+
+// elbow 把 k 与惯性都缩放到 [0, 1]，返回惯性曲线在首尾连线下方最远的点
+func elbow(scores []Score) int {
+	first, last := scores[0], scores[len(scores)-1]
+	if len(scores) < 3 || first.K == last.K || first.Inertia == last.Inertia {
+		return 0
+	}
+
+	best, bestGap := 0, math.Inf(-1)
+	for i, s := range scores {
+		x := float64(s.K-first.K) / float64(last.K-first.K)
+		y := (s.Inertia - last.Inertia) / (first.Inertia - last.Inertia)
+		// 连线为 y = 1 - x
+		if gap := 1 - x - y; gap > bestGap {
+			best, bestGap = i, gap
+		}
+	}
+	return best
+}
+
+// Silhouette 在 sample 指定的单词之间计算平均轮廓系数 (b-a)/max(a,b)，
+// a 为到同簇单词的平均距离，b 为到其他簇单词平均距离的最小值；单独成簇的单词计为 0
+func Silhouette(words []word.WordEmbedding, clusterIDs []uint, sample []int) float64 {
+	if len(sample) < 2 {
+		return 0
+	}
+	k := 0
+	for _, i := range sample {
+		k = max(k, int(clusterIDs[i])+1)
+	}
+	counts := make([]int, k)
+	for _, i := range sample {
+		counts[clusterIDs[i]]++
+	}
+
+	values := make([]float64, len(sample))
+	parallel(len(sample), func(start, end int) {
+		sums := make([]float64, k)
+		for s := start; s < end; s++ {
+			i := sample[s]
+			clear(sums)
+			for _, j := range sample {
+				if j != i {
+					sums[clusterIDs[j]] += math.Sqrt(base.Distance(words[i].NormalizedEmbedding, words[j].NormalizedEmbedding))
+				}
+			}
+
+			own := clusterIDs[i]
+			if counts[own] <= 1 {
+				continue
+			}
+			a := sums[own] / float64(counts[own]-1)
+			b := math.Inf(1)
+			for c, sum := range sums {
+				if uint(c) != own && counts[c] > 0 {
+					b = min(b, sum/float64(counts[c]))
+				}
+			}
+			if math.IsInf(b, 1) || max(a, b) == 0 {
+				continue
+			}
+			values[s] = (b - a) / max(a, b)
+		}
+	})
+
+	var sum float64
+	for _, v := range values {
+		sum += v
+	}
+	return sum / float64(len(values))
+}
+
+// DaviesBouldin 每个簇与其最相似的簇的 (s_i+s_j)/d(c_i,c_j) 的平均值，
+// s 为簇内单词到中心的平均距离，空簇不参与计算
+func DaviesBouldin(words []word.WordEmbedding, centers [][]float64, clusterIDs []uint) float64 {
+	k := len(centers)
+	spread := make([]float64, k)
+	counts := make([]int, k)
+	for i, w := range words {
+		c := clusterIDs[i]
+		spread[c] += math.Sqrt(base.Distance(w.NormalizedEmbedding, centers[c]))
+		counts[c]++
+	}
+
+	var sum float64
+	nonEmpty := 0
+	for i := range k {
+		if counts[i] == 0 {
+			continue
+		}
+		spread[i] /= float64(counts[i])
+	}
+	for i := range k {
+		if counts[i] == 0 {
+			continue
+		}
+		nonEmpty++
+		var worst float64
+		for j := range k {
+			if j == i || counts[j] == 0 {
+				continue
+			}
+			dist := math.Sqrt(base.Distance(centers[i], centers[j]))
+			if dist == 0 {
+				worst = math.Inf(1)
+				continue
+			}
+			worst = max(worst, (spread[i]+spread[j])/dist)
+		}
+		sum += worst
+	}
+	if nonEmpty == 0 {
+		return 0
+	}
+	return sum / float64(nonEmpty)
+}
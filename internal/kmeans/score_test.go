@@ -0,0 +1,70 @@
+package kmeans
+
+import (
+	"math"
+	"testing"
+)
+
+func TestSilhouetteAndDaviesBouldin(t *testing.T) {
+	words := testWords(
+		[]float64{0, 0}, []float64{0, 1},
+		[]float64{10, 0}, []float64{10, 1},
+	)
+	centers := [][]float64{{0, 0.5}, {10, 0.5}}
+	ids := []uint{0, 0, 1, 1}
+
+	// a=1，b=(10+√101)/2
+	b := (10 + math.Sqrt(101)) / 2
+	expected := (b - 1) / b
+	if got := Silhouette(words, ids, []int{0, 1, 2, 3}); math.Abs(got-expected) > 1e-9 {
+		t.Fatalf("expected silhouette %f, got %f", expected, got)
+	}
+	// s=0.5，中心距离为 10
+	if got := DaviesBouldin(words, centers, ids); math.Abs(got-0.1) > 1e-9 {
+		t.Fatalf("expected davies-bouldin 0.1, got %f", got)
+	}
+
+	// 单独成簇的单词计为 0，空簇不参与计算
+	if got := Silhouette(words, []uint{0, 1, 1, 1}, []int{0, 1, 2, 3}); got >= expected {
+		t.Fatalf("worse clustering should have lower silhouette, got %f", got)
+	}
+	if got := DaviesBouldin(words, append(centers, []float64{5, 5}), ids); math.Abs(got-0.1) > 1e-9 {
+		t.Fatalf("empty cluster should be ignored, got %f", got)
+	}
+}
+
+func TestTuneChoosesSeparatedGroups(t *testing.T) {
+	words := randomWords(4, 30, 7)
+	scores, err := Tune(words, []int{2, 3, 4, 5, 6, 8}, Options{MaxIter: 50, Init: InitPlusPlus, Seed: 1, Restarts: 2}, 60)
+	if err != nil {
+		t.Fatalf("unable to tune: %s", err)
+	}
+	if len(scores) != 6 {
+		t.Fatalf("expected 6 scores, got %d", len(scores))
+	}
+	for _, criterion := range []Criterion{CriterionSilhouette, CriterionDaviesBouldin, CriterionElbow} {
+		if k := Choose(scores, criterion); k != 4 {
+			t.Errorf("%s: expected k=4, got %d (%+v)", criterion, k, scores)
+		}
+	}
+
+	if _, err := Tune(words, []int{1}, Options{MaxIter: 10}, 0); err == nil {
+		t.Fatal("expected an error for k=1")
+	}
+}
+
+func TestElbow(t *testing.T) {
+	scores := []Score{{K: 1, Inertia: 100}, {K: 2, Inertia: 40}, {K: 3, Inertia: 10}, {K: 4, Inertia: 8}, {K: 5, Inertia: 7}}
+	if k := Choose(scores, CriterionElbow); k != 3 {
+		t.Fatalf("expected elbow at 3, got %d", k)
+	}
+}
+
+func TestParseCriterion(t *testing.T) {
+	if criterion, err := ParseCriterion("davies-bouldin"); err != nil || criterion != CriterionDaviesBouldin {
+		t.Fatalf("expected davies-bouldin, got %s, %v", criterion, err)
+	}
+	if _, err := ParseCriterion("gap"); err == nil {
+		t.Fatal("expected an error for an unknown criterion")
+	}
+}
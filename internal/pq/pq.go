@@ -0,0 +1,161 @@
+package pq
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"yggdrasil/sim-words/internal/base"
+)
+
+// Codebook 乘积量化码本。向量按维度均分为 M 段，每段用 Ks 个中心之一的下标（1 字节）表示。
+// 训练数据为单词向量与其所属簇中心的残差，与簇中心一起构成 IVF-PQ
+type Codebook struct {
+	base.BaseModel
+	M   int
+	Ks  int
+	Dim int
+	// Centroids 按 [段][中心][段内维度] 展开存放
+	Centroids base.Float64Slice `gorm:"type:json"`
+}
+
+func (Codebook) TableName() string {
+	return "pq_codebooks"
+}
+
+// SubDim 每段的维度
+func (c *Codebook) SubDim() int {
+	return c.Dim / c.M
+}
+
+// centroid 第 m 段的第 j 个中心
+func (c *Codebook) centroid(m int, j int) []float64 {
+	sub := c.SubDim()
+	start := (m*c.Ks + j) * sub
+	return c.Centroids[start : start+sub]
+}
+
+// Train 在每一段上分别做 k-means 得到码本，ks 不超过 256 和样本数
+func Train(vectors [][]float64, m int, ks int, iters int, seed int64) (*Codebook, error) {
+	if len(vectors) == 0 {
+		return nil, fmt.Errorf("no vectors to train")
+	}
+	dim := len(vectors[0])
+	if m <= 0 || dim%m != 0 {
+		return nil, fmt.Errorf("dimension %d is not divisible by %d subspaces", dim, m)
+	}
+	ks = min(ks, 256, len(vectors))
+
+	c := &Codebook{M: m, Ks: ks, Dim: dim}
+	sub := c.SubDim()
+	c.Centroids = make(base.Float64Slice, m*ks*sub)
+	r := rand.New(rand.NewSource(seed))
+
+	assignments := make([]int, len(vectors))
+	for s := range m {
+		subvector := func(i int) []float64 {
+			return vectors[i][s*sub : (s+1)*sub]
+		}
+
+		// 随机选取不重复的样本作为初始中心
+		for j, i := range r.Perm(len(vectors))[:ks] {
+			copy(c.centroid(s, j), subvector(i))
+		}
+
+		for range iters {
+			changed := false
+			for i := range vectors {
+				best := c.nearest(s, subvector(i))
+				if best != assignments[i] {
+					assignments[i] = best
+					changed = true
+				}
+			}
+
+			sums := make([]float64, ks*sub)
+			counts := make([]int, ks)
+			for i := range vectors {
+				j := assignments[i]
+				counts[j]++
+				for d, f := range subvector(i) {
+					sums[j*sub+d] += f
+				}
+			}
+			for j := range ks {
+				// 空的中心保持不变
+				if counts[j] == 0 {
+					continue
+				}
+				centroid := c.centroid(s, j)
+				for d := range centroid {
+					centroid[d] = sums[j*sub+d] / float64(counts[j])
+				}
+			}
+
+			if !changed {
+				break
+			}
+		}
+	}
+	return c, nil
+}
+
+// nearest 返回第 m 段中与 sub 欧氏距离最近的中心下标
+func (c *Codebook) nearest(m int, sub []float64) int {
+	best, bestDist := 0, math.MaxFloat64
+	for j := range c.Ks {
+		if dist := base.Distance(sub, c.centroid(m, j)); dist < bestDist {
+			best, bestDist = j, dist
+		}
+	}
+	return best
+}
+
+// Encode 把向量编码为 M 个字节
+func (c *Codebook) Encode(v []float64) []byte {
+	sub := c.SubDim()
+	code := make([]byte, c.M)
+	for m := range c.M {
+		code[m] = byte(c.nearest(m, v[m*sub:(m+1)*sub]))
+	}
+	return code
+}
+
+// Decode 按码本重建向量
+func (c *Codebook) Decode(code []byte) []float64 {
+	v := make([]float64, 0, c.Dim)
+	for m, j := range code {
+		v = append(v, c.centroid(m, int(j))...)
+	}
+	return v
+}
+
+// Table 查询向量与每段每个中心的内积，用于非对称距离计算（ADC）
+type Table [][]float64
+
+// NewTable 为查询向量预先计算内积表，每个查询只需计算一次
+func (c *Codebook) NewTable(query []float64) Table {
+	sub := c.SubDim()
+	table := make(Table, c.M)
+	for m := range c.M {
+		table[m] = make([]float64, c.Ks)
+		q := query[m*sub : (m+1)*sub]
+		for j := range c.Ks {
+			for d, f := range c.centroid(m, j) {
+				table[m][j] += q[d] * f
+			}
+		}
+	}
+	return table
+}
+
+// Score 查询向量与编码所表示残差的近似内积，编码长度不符时返回负无穷
+func (t Table) Score(code []byte) float64 {
+	if len(code) != len(t) {
+		return math.Inf(-1)
+	}
+	var sum float64
+	for m, j := range code {
+		sum += t[m][j]
+	}
+	return sum
+}
@@ -0,0 +1,92 @@
+package pq
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func randomVectors(n int, dim int, seed int64) [][]float64 {
+	r := rand.New(rand.NewSource(seed))
+	vectors := make([][]float64, n)
+	for i := range vectors {
+		vectors[i] = make([]float64, dim)
+		for d := range vectors[i] {
+			vectors[i][d] = r.NormFloat64()
+		}
+	}
+	return vectors
+}
+
+func TestTrainRequiresDivisibleDimension(t *testing.T) {
+	if _, err := Train(randomVectors(10, 6, 1), 4, 8, 5, 1); err == nil {
+		t.Fatal("expected an error when the dimension is not divisible")
+	}
+	if _, err := Train(nil, 2, 8, 5, 1); err == nil {
+		t.Fatal("expected an error without vectors")
+	}
+}
+
+func TestEncodeDecode(t *testing.T) {
+	vectors := randomVectors(200, 8, 1)
+	c, err := Train(vectors, 4, 16, 10, 1)
+	if err != nil {
+		t.Fatalf("unable to train: %s", err)
+	}
+	if c.SubDim() != 2 || c.Ks != 16 {
+		t.Fatalf("unexpected codebook shape: m=%d ks=%d sub=%d", c.M, c.Ks, c.SubDim())
+	}
+
+	// 重建误差应明显小于向量本身的范数
+	var errSum, normSum float64
+	for _, v := range vectors {
+		code := c.Encode(v)
+		if len(code) != 4 {
+			t.Fatalf("expected 4 bytes, got %d", len(code))
+		}
+		decoded := c.Decode(code)
+		for d := range v {
+			errSum += (v[d] - decoded[d]) * (v[d] - decoded[d])
+			normSum += v[d] * v[d]
+		}
+	}
+	if errSum > normSum/2 {
+		t.Fatalf("reconstruction error %.3f too large for norm %.3f", errSum, normSum)
+	}
+}
+
+func TestTrainCapsCentroids(t *testing.T) {
+	c, err := Train(randomVectors(5, 4, 1), 2, 256, 5, 1)
+	if err != nil {
+		t.Fatalf("unable to train: %s", err)
+	}
+	if c.Ks != 5 {
+		t.Fatalf("expected ks capped at 5 samples, got %d", c.Ks)
+	}
+}
+
+func TestTableScore(t *testing.T) {
+	vectors := randomVectors(100, 8, 2)
+	c, err := Train(vectors, 2, 8, 10, 1)
+	if err != nil {
+		t.Fatalf("unable to train: %s", err)
+	}
+
+	// ADC 结果等于查询向量与重建向量的内积
+	query := randomVectors(1, 8, 3)[0]
+	table := c.NewTable(query)
+	for _, v := range vectors[:10] {
+		code := c.Encode(v)
+		var expected float64
+		for d, f := range c.Decode(code) {
+			expected += query[d] * f
+		}
+		if got := table.Score(code); math.Abs(got-expected) > 1e-9 {
+			t.Fatalf("expected score %f, got %f", expected, got)
+		}
+	}
+
+	if !math.IsInf(table.Score([]byte{0}), -1) {
+		t.Fatal("expected -Inf for a code of wrong length")
+	}
+}
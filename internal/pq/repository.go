@@ -0,0 +1,37 @@
+package pq
+
+import (
+	"errors"
+
+	"gorm.io/gorm"
+)
+
+// SaveCodebook 替换已有的码本
+func SaveCodebook(db *gorm.DB, c *Codebook) error {
+	if err := DeleteCodebook(db); err != nil {
+		return err
+	}
+	return db.Create(c).Error
+}
+
+// GetCodebook 返回码本，未训练时返回 nil
+func GetCodebook(db *gorm.DB) (*Codebook, error) {
+	if !db.Migrator().HasTable(&Codebook{}) {
+		return nil, nil
+	}
+	var c Codebook
+	err := db.Last(&c).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// DeleteCodebook 删除码本
+func DeleteCodebook(db *gorm.DB) error {
+	db.AutoMigrate(&Codebook{})
+	return db.Unscoped().Where("1 = 1").Delete(&Codebook{}).Error
+}
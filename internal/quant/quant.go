@@ -0,0 +1,186 @@
+package quant
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"math/bits"
+	"yggdrasil/sim-words/internal/base"
+)
+
+// Scheme 量化方式
+type Scheme string
+
+const (
+	// None 不量化
+	None Scheme = "none"
+	// Int8 每个向量一个缩放系数的 int8 标量量化
+	Int8 Scheme = "int8"
+	// Int8PerDim 每个维度一个缩放系数的 int8 标量量化，系数由全部单词统计得到
+	Int8PerDim Scheme = "int8-dim"
+	// Binary 每个维度只保留符号位，按汉明距离打分
+	Binary Scheme = "binary"
+)
+
+// ParseScheme 解析命令行中的量化方式
+func ParseScheme(name string) (Scheme, error) {
+	switch scheme := Scheme(name); scheme {
+	case None, Int8, Int8PerDim, Binary:
+		return scheme, nil
+	default:
+		return "", fmt.Errorf("unknown quantization scheme %s", name)
+	}
+}
+
+// Params 量化参数，整个数据库只保存一份
+type Params struct {
+	base.BaseModel
+	Scheme Scheme
+	Dim    int
+	// Scales Int8PerDim 时每个维度的缩放系数
+	Scales base.Float64Slice `gorm:"type:json"`
+}
+
+func (Params) TableName() string {
+	return "quant_params"
+}
+
+// Train 根据全部向量计算量化参数
+func Train(scheme Scheme, vectors [][]float64) (*Params, error) {
+	params := &Params{Scheme: scheme}
+	for _, v := range vectors {
+		if err := params.Fit(v); err != nil {
+			return nil, err
+		}
+	}
+	return params, nil
+}
+
+// Fit 统计一个向量，可以分批调用，向量维度必须与第一个向量相同。
+// 只有 Int8PerDim 需要统计每个维度的最大绝对值
+func (p *Params) Fit(v []float64) error {
+	if p.Dim == 0 {
+		p.Dim = len(v)
+	}
+	if len(v) != p.Dim {
+		return fmt.Errorf("vector of dimension %d does not match dimension %d", len(v), p.Dim)
+	}
+	if p.Scheme != Int8PerDim {
+		return nil
+	}
+
+	if p.Scales == nil {
+		p.Scales = make(base.Float64Slice, p.Dim)
+	}
+	for d, f := range v {
+		p.Scales[d] = max(p.Scales[d], math.Abs(f)/127)
+	}
+	return nil
+}
+
+// Encode 量化一个向量。Int8 的编码以 4 字节小端 float32 缩放系数开头，
+// Binary 的编码为按 64 位分组的小端符号位。Int8PerDim 时维度与缩放系数不符的向量返回 nil
+func (p *Params) Encode(v []float64) []byte {
+	switch p.Scheme {
+	case Int8:
+		var maxAbs float64
+		for _, f := range v {
+			maxAbs = max(maxAbs, math.Abs(f))
+		}
+		scale := maxAbs / 127
+		code := make([]byte, 4+len(v))
+		binary.LittleEndian.PutUint32(code, math.Float32bits(float32(scale)))
+		for d, f := range v {
+			code[4+d] = byte(quantizeInt8(f, scale))
+		}
+		return code
+	case Int8PerDim:
+		if len(v) != len(p.Scales) {
+			return nil
+		}
+		code := make([]byte, len(v))
+		for d, f := range v {
+			code[d] = byte(quantizeInt8(f, p.Scales[d]))
+		}
+		return code
+	case Binary:
+		return packSigns(v)
+	default:
+		return nil
+	}
+}
+
+func quantizeInt8(f float64, scale float64) int8 {
+	if scale == 0 {
+		return 0
+	}
+	return int8(max(-127, min(127, math.Round(f/scale))))
+}
+
+func packSigns(v []float64) []byte {
+	code := make([]byte, 8*((len(v)+63)/64))
+	for d, f := range v {
+		if f > 0 {
+			code[d/8] |= 1 << (d % 8)
+		}
+	}
+	return code
+}
+
+// Scorer 用量化后的向量近似计算与查询向量的内积，分数只用于排序
+type Scorer func(code []byte) float64
+
+// NewScorer 为查询向量创建打分函数。int8 为非对称计算，查询向量保持全精度；
+// Binary 同样量化查询向量，分数为相同符号位的个数减去不同的个数
+func (p *Params) NewScorer(query []float64) Scorer {
+	switch p.Scheme {
+	case Int8:
+		return func(code []byte) float64 {
+			if len(code) != 4+len(query) {
+				return math.Inf(-1)
+			}
+			scale := float64(math.Float32frombits(binary.LittleEndian.Uint32(code)))
+			var dot float64
+			for d, c := range code[4:] {
+				dot += query[d] * float64(int8(c))
+			}
+			return dot * scale
+		}
+	case Int8PerDim:
+		// 维度不符时与其他方式一样给所有编码最低分
+		if len(query) != len(p.Scales) {
+			return func(code []byte) float64 {
+				return math.Inf(-1)
+			}
+		}
+		// 把每个维度的缩放系数预先乘进查询向量
+		scaled := make([]float64, len(query))
+		for d := range query {
+			scaled[d] = query[d] * p.Scales[d]
+		}
+		return func(code []byte) float64 {
+			if len(code) != len(scaled) {
+				return math.Inf(-1)
+			}
+			var dot float64
+			for d, c := range code {
+				dot += scaled[d] * float64(int8(c))
+			}
+			return dot
+		}
+	case Binary:
+		queryCode := packSigns(query)
+		return func(code []byte) float64 {
+			if len(code) != len(queryCode) {
+				return math.Inf(-1)
+			}
+			diff := 0
+			for i := 0; i < len(code); i += 8 {
+				diff += bits.OnesCount64(binary.LittleEndian.Uint64(code[i:]) ^ binary.LittleEndian.Uint64(queryCode[i:]))
+			}
+			return float64(len(query) - 2*diff)
+		}
+	default:
+		return nil
+	}
+}
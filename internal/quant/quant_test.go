@@ -0,0 +1,136 @@
+package quant
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func randomUnitVectors(r *rand.Rand, n int, dim int) [][]float64 {
+	vectors := make([][]float64, n)
+	for i := range vectors {
+		v := make([]float64, dim)
+		var norm float64
+		for d := range v {
+			v[d] = r.NormFloat64()
+			norm += v[d] * v[d]
+		}
+		for d := range v {
+			v[d] /= math.Sqrt(norm)
+		}
+		vectors[i] = v
+	}
+	return vectors
+}
+
+func dot(a, b []float64) float64 {
+	var sum float64
+	for i := range a {
+		sum += a[i] * b[i]
+	}
+	return sum
+}
+
+func train(t *testing.T, scheme Scheme, vectors [][]float64) *Params {
+	t.Helper()
+
+	params, err := Train(scheme, vectors)
+	if err != nil {
+		t.Fatalf("%s: unable to train: %s", scheme, err)
+	}
+	return params
+}
+
+func TestInt8ScoresApproximateDot(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	vectors := randomUnitVectors(r, 200, 64)
+	query := randomUnitVectors(r, 1, 64)[0]
+
+	for _, scheme := range []Scheme{Int8, Int8PerDim} {
+		params := train(t, scheme, vectors)
+		scorer := params.NewScorer(query)
+		for _, v := range vectors {
+			exact := dot(query, v)
+			if approx := scorer(params.Encode(v)); math.Abs(approx-exact) > 0.02 {
+				t.Fatalf("%s: expected %g, got %g", scheme, exact, approx)
+			}
+		}
+	}
+}
+
+func TestBinaryScores(t *testing.T) {
+	params := train(t, Binary, [][]float64{{1, -1, 1}})
+	scorer := params.NewScorer([]float64{0.5, -0.2, 0.1})
+
+	if got := scorer(params.Encode([]float64{0.3, -0.1, 0.9})); got != 3 {
+		t.Errorf("same signs should score 3, got %g", got)
+	}
+	if got := scorer(params.Encode([]float64{-0.3, 0.1, -0.9})); got != -3 {
+		t.Errorf("opposite signs should score -3, got %g", got)
+	}
+	if got := scorer(params.Encode([]float64{0.3, 0.1, 0.9})); got != 1 {
+		t.Errorf("one different sign should score 1, got %g", got)
+	}
+	if len(params.Encode(make([]float64, 65))) != 16 {
+		t.Errorf("65 dims should be packed into 2 words")
+	}
+}
+
+// 量化后的排序应当与精确排序大体一致
+func TestQuantizedRanking(t *testing.T) {
+	r := rand.New(rand.NewSource(2))
+	vectors := randomUnitVectors(r, 500, 128)
+	query := randomUnitVectors(r, 1, 128)[0]
+
+	best := 0
+	for i := range vectors {
+		if dot(query, vectors[i]) > dot(query, vectors[best]) {
+			best = i
+		}
+	}
+
+	for _, scheme := range []Scheme{Int8, Int8PerDim, Binary} {
+		params := train(t, scheme, vectors)
+		scorer := params.NewScorer(query)
+		bestScore := scorer(params.Encode(vectors[best]))
+
+		// 精确最近邻在量化打分中应排在前 10%
+		better := 0
+		for _, v := range vectors {
+			if scorer(params.Encode(v)) > bestScore {
+				better++
+			}
+		}
+		if better > len(vectors)/10 {
+			t.Errorf("%s: true nearest neighbour ranked %d", scheme, better+1)
+		}
+	}
+}
+
+func TestScorerRejectsWrongLength(t *testing.T) {
+	params := train(t, Int8, [][]float64{{1, 0}})
+	if score := params.NewScorer([]float64{1, 0})(nil); !math.IsInf(score, -1) {
+		t.Errorf("expected -Inf for missing code, got %g", score)
+	}
+
+	// 每个维度一个缩放系数时维度不符的向量不能统计、编码或打分
+	if _, err := Train(Int8PerDim, [][]float64{{1, 0}, {1, 0, 0}}); err == nil {
+		t.Error("expected an error for vectors of different dimensions")
+	}
+	params = train(t, Int8PerDim, [][]float64{{1, 0}, {0, 1}})
+	if code := params.Encode([]float64{1, 0, 0}); code != nil {
+		t.Errorf("expected no code for a vector of dimension 3, got %v", code)
+	}
+	if score := params.NewScorer([]float64{1, 0, 0})(params.Encode([]float64{1, 0})); !math.IsInf(score, -1) {
+		t.Errorf("expected -Inf for a query of dimension 3, got %g", score)
+	}
+}
+
+func TestParseScheme(t *testing.T) {
+	if _, err := ParseScheme("int4"); err == nil {
+		t.Error("expected an error for unknown scheme")
+	}
+	if scheme, err := ParseScheme("int8-dim"); err != nil || scheme != Int8PerDim {
+		t.Errorf("unexpected scheme %s %v", scheme, err)
+	}
+}
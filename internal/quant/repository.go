@@ -0,0 +1,37 @@
+package quant
+
+import (
+	"errors"
+
+	"gorm.io/gorm"
+)
+
+// SaveParams 替换已有的量化参数
+func SaveParams(db *gorm.DB, params *Params) error {
+	if err := DeleteParams(db); err != nil {
+		return err
+	}
+	return db.Create(params).Error
+}
+
+// GetParams 返回量化参数，未量化时返回 nil
+func GetParams(db *gorm.DB) (*Params, error) {
+	if !db.Migrator().HasTable(&Params{}) {
+		return nil, nil
+	}
+	var params Params
+	err := db.Last(&params).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &params, nil
+}
+
+// DeleteParams 删除量化参数
+func DeleteParams(db *gorm.DB) error {
+	db.AutoMigrate(&Params{})
+	return db.Unscoped().Where("1 = 1").Delete(&Params{}).Error
+}
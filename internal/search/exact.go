@@ -0,0 +1,88 @@
+package search
+
+import (
+	"container/heap"
+	"math"
+	"runtime"
+	"sort"
+	"sync"
+	"yggdrasil/sim-words/internal/base"
+)
+
+// QueryExact 对全部单词打分，返回最相似的 L 个单词，作为簇探查和 HNSW 的参照。
+// 与 kmeans.assignClusters 一样按 CPU 数分块并行
+func (m *Matrix) QueryExact(query base.Float64Slice, L int, includeSelf bool) ([]SearchResult, error) {
+	q, err := m.normalizeQuery(query)
+	if err != nil {
+		return nil, err
+	}
+	if L <= 0 {
+		return nil, nil
+	}
+
+	n := m.Len()
+	numWorkers := runtime.NumCPU()
+	chunkSize := (n + numWorkers - 1) / numWorkers
+	chunks := make([]rowHeap, numWorkers)
+	const epsilon = 1e-6
+
+	var wg sync.WaitGroup
+	for w := range numWorkers {
+		start := w * chunkSize
+		end := min(start+chunkSize, n)
+
+		wg.Add(1)
+		go func(w, start, end int) {
+			defer wg.Done()
+			// 每块只保留最相似的 L 个
+			top := rowHeap{}
+			for row := start; row < end; row++ {
+				if m.removed[row] {
+					continue
+				}
+				sim := m.dot(q, row)
+				if !includeSelf && math.Abs(sim-1.0) < epsilon {
+					continue
+				}
+				if len(top) < L {
+					heap.Push(&top, scoredRow{row, sim})
+				} else if sim > top[0].sim {
+					top[0] = scoredRow{row, sim}
+					heap.Fix(&top, 0)
+				}
+			}
+			chunks[w] = top
+		}(w, start, end)
+	}
+	wg.Wait()
+
+	var results []SearchResult
+	for _, top := range chunks {
+		for _, r := range top {
+			results = append(results, m.result(r.row, r.sim))
+		}
+	}
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].Similarity > results[j].Similarity
+	})
+	return results[:min(L, len(results))], nil
+}
+
+type scoredRow struct {
+	row int
+	sim float64
+}
+
+// rowHeap 按相似度从低到高的小顶堆，堆顶为当前保留的最差结果
+type rowHeap []scoredRow
+
+func (h rowHeap) Len() int           { return len(h) }
+func (h rowHeap) Less(i, j int) bool { return h[i].sim < h[j].sim }
+func (h rowHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *rowHeap) Push(x any)        { *h = append(*h, x.(scoredRow)) }
+func (h *rowHeap) Pop() any {
+	old := *h
+	r := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return r
+}
@@ -0,0 +1,58 @@
+package search
+
+import (
+	"math/rand"
+	"sort"
+	"testing"
+	"yggdrasil/sim-words/internal/base"
+	"yggdrasil/sim-words/internal/word"
+)
+
+func TestQueryExactMatchesSort(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	m := &Matrix{}
+	for i := range 1000 {
+		v := base.Float64Slice{r.NormFloat64(), r.NormFloat64(), r.NormFloat64()}
+		m.Append(word.WordEmbedding{Word: string(rune('a'+i%26)) + string(rune(i)), Embedding: base.Embedding{NormalizedEmbedding: word.L2Normalize(v)}})
+	}
+	query := base.Float64Slice{0.2, -1, 0.5}
+
+	results, err := m.QueryExact(query, 20, true)
+	if err != nil {
+		t.Fatalf("query failed: %s", err)
+	}
+
+	q, _ := m.normalizeQuery(query)
+	rows := make([]int, m.Len())
+	for i := range rows {
+		rows[i] = i
+	}
+	sort.Slice(rows, func(i, j int) bool { return m.dot(q, rows[i]) > m.dot(q, rows[j]) })
+
+	if len(results) != 20 {
+		t.Fatalf("expected 20 results, got %d", len(results))
+	}
+	for i, r := range results {
+		if r.Word != m.Words[rows[i]] {
+			t.Errorf("result #%d: expected %s, got %s", i, m.Words[rows[i]], r.Word)
+		}
+	}
+}
+
+func TestQueryExactExcludesSelf(t *testing.T) {
+	db, _ := openTestDB(t)
+	m, _ := LoadMatrix(db, 0)
+
+	results, err := m.QueryExact(base.Float64Slice{0, 1}, 10, false)
+	if err != nil {
+		t.Fatalf("query failed: %s", err)
+	}
+	got := []string{}
+	for _, r := range results {
+		got = append(got, r.Word)
+	}
+	// cat 被排除，其余按相似度降序
+	if len(got) != 3 || got[0] != "dog" || got[2] != "apple" {
+		t.Errorf("expected dog, pear, apple, got %v", got)
+	}
+}
@@ -0,0 +1,262 @@
+package search
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"sort"
+	"yggdrasil/sim-words/internal/base"
+	"yggdrasil/sim-words/internal/cluster"
+	"yggdrasil/sim-words/internal/hnsw"
+	"yggdrasil/sim-words/internal/word"
+
+	"gorm.io/gorm"
+)
+
+// ErrMemoryBudget 单词向量超出内存预算
+var ErrMemoryBudget = errors.New("vectors exceed memory budget")
+
+// matrixRowOverhead 估算内存时每个单词除向量外的开销（单词、频率、簇 ID 等）
+const matrixRowOverhead = 64
+
+// Matrix 常驻内存的单词向量，全部 NormalizedEmbedding 按行连续存放为 float32，
+// 按簇记录行号，查询时不再访问数据库
+type Matrix struct {
+	Dim         int
+	Data        []float32
+	IDs         []uint
+	Words       []string
+	Frequencies []int
+	ClusterIDs  []uint
+
+	rowsByCluster map[uint][]int
+	// removed 已删除的行，行号不变以免 HNSW 索引失效
+	removed map[int]bool
+}
+
+// EstimateMatrixBytes 估算 n 个 dim 维单词载入内存所需的字节数
+func EstimateMatrixBytes(n int64, dim int) int64 {
+	return n * (int64(dim)*4 + matrixRowOverhead)
+}
+
+// LoadMatrix 把全部单词载入内存，估算大小超过 maxBytes 时返回 ErrMemoryBudget，maxBytes 为 0 时不限制
+func LoadMatrix(db *gorm.DB, maxBytes int64) (*Matrix, error) {
+	count, err := word.Count(db, "")
+	if err != nil {
+		return nil, fmt.Errorf("unable to count words: %w", err)
+	}
+
+	m := &Matrix{rowsByCluster: map[uint][]int{}}
+	err = word.FindInBatches(db, "", 1000, func(words []word.WordEmbedding) error {
+		for _, w := range words {
+			if m.Dim == 0 {
+				m.Dim = len(w.NormalizedEmbedding)
+				need := EstimateMatrixBytes(count, m.Dim)
+				if maxBytes > 0 && need > maxBytes {
+					return fmt.Errorf("%w: %d words of dimension %d need about %d MiB, budget is %d MiB",
+						ErrMemoryBudget, count, m.Dim, need>>20, maxBytes>>20)
+				}
+				m.Data = make([]float32, 0, int(count)*m.Dim)
+			}
+			m.Append(w)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Append 追加一个单词，维度不符时忽略
+func (m *Matrix) Append(w word.WordEmbedding) {
+	if m.rowsByCluster == nil {
+		m.rowsByCluster = map[uint][]int{}
+	}
+	if m.Dim == 0 {
+		m.Dim = len(w.NormalizedEmbedding)
+	}
+	if len(w.NormalizedEmbedding) != m.Dim {
+		return
+	}
+
+	row := len(m.Words)
+	for _, f := range w.NormalizedEmbedding {
+		m.Data = append(m.Data, float32(f))
+	}
+	m.IDs = append(m.IDs, w.ID)
+	m.Words = append(m.Words, w.Word)
+	m.Frequencies = append(m.Frequencies, w.Frequency)
+	m.ClusterIDs = append(m.ClusterIDs, w.ClusterID)
+	m.rowsByCluster[w.ClusterID] = append(m.rowsByCluster[w.ClusterID], row)
+}
+
+// Remove 删除指定 ID 的单词，其所在行不再出现在查询结果中
+func (m *Matrix) Remove(ids []uint) {
+	if m.removed == nil {
+		m.removed = map[int]bool{}
+	}
+	remove := make(map[uint]bool, len(ids))
+	for _, id := range ids {
+		remove[id] = true
+	}
+	for row, id := range m.IDs {
+		if !remove[id] || m.removed[row] {
+			continue
+		}
+		m.removed[row] = true
+		clusterID := m.ClusterIDs[row]
+		m.rowsByCluster[clusterID] = slices.DeleteFunc(m.rowsByCluster[clusterID], func(r int) bool {
+			return r == row
+		})
+	}
+}
+
+// Len 返回单词数
+func (m *Matrix) Len() int {
+	return len(m.Words)
+}
+
+// Row 返回第 i 个单词的向量
+func (m *Matrix) Row(i int) []float32 {
+	return m.Data[i*m.Dim : (i+1)*m.Dim]
+}
+
+// dot 行向量已归一化，与归一化后的查询向量的内积即余弦相似度
+func (m *Matrix) dot(query []float64, row int) float64 {
+	var sum float64
+	for d, f := range m.Row(row) {
+		sum += query[d] * float64(f)
+	}
+	return sum
+}
+
+// checkDim 查询向量维度不符时返回错误
+func (m *Matrix) checkDim(query base.Float64Slice) error {
+	if len(query) != m.Dim {
+		return fmt.Errorf("query has dimension %d, expected %d", len(query), m.Dim)
+	}
+	return nil
+}
+
+// normalizeQuery 归一化查询向量，维度不符时返回错误
+func (m *Matrix) normalizeQuery(query base.Float64Slice) ([]float64, error) {
+	if err := m.checkDim(query); err != nil {
+		return nil, err
+	}
+	var norm float64
+	for _, f := range query {
+		norm += f * f
+	}
+	normalized := make([]float64, len(query))
+	if norm == 0 {
+		return normalized, nil
+	}
+	norm = math.Sqrt(norm)
+	for d, f := range query {
+		normalized[d] = f / norm
+	}
+	return normalized, nil
+}
+
+// QueryWords 与 QueryWords 相同的簇探查方式，但在内存中的矩阵上计算
+func (m *Matrix) QueryWords(
+	query base.Float64Slice,
+	clusters []cluster.Cluster,
+	topK int,
+	L int,
+	includeSelf bool,
+) ([]SearchResult, error) {
+	if err := m.checkDim(query); err != nil {
+		return nil, err
+	}
+	return m.queryClusters(query, clusters, probeClusters(query, clusters, topK), L, includeSelf)
+}
+
+// queryClusters 从 probed 指定的每个簇中选相似度最高的 L 个单词
+func (m *Matrix) queryClusters(
+	query base.Float64Slice,
+	clusters []cluster.Cluster,
+	probed []int,
+	L int,
+	includeSelf bool,
+) ([]SearchResult, error) {
+	q, err := m.normalizeQuery(query)
+	if err != nil {
+		return nil, err
+	}
+
+	var results []SearchResult
+	const epsilon = 1e-6
+	for _, ci := range probed {
+		rows := m.rowsByCluster[clusters[ci].ID]
+		sims := make([]float64, len(rows))
+		order := make([]int, len(rows))
+		for i, row := range rows {
+			sims[i] = m.dot(q, row)
+			order[i] = i
+		}
+		sort.Slice(order, func(i, j int) bool {
+			return sims[order[i]] > sims[order[j]]
+		})
+
+		count := 0
+		for _, i := range order {
+			if count >= L {
+				break
+			}
+			// float32 存储带来约 1e-7 的误差，仍在阈值内
+			if !includeSelf && math.Abs(sims[i]-1.0) < epsilon {
+				continue
+			}
+			results = append(results, m.result(rows[i], sims[i]))
+			count++
+		}
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].Similarity > results[j].Similarity
+	})
+	return results, nil
+}
+
+func (m *Matrix) result(row int, sim float64) SearchResult {
+	return SearchResult{
+		Word:       m.Words[row],
+		Similarity: sim,
+		Frequency:  m.Frequencies[row],
+	}
+}
+
+// QueryHNSW 在 HNSW 索引上查询与 query 最相似的 L 个单词，不经过簇。ef 为搜索宽度
+func (m *Matrix) QueryHNSW(idx *hnsw.Index, query base.Float64Slice, L int, ef int, includeSelf bool) ([]SearchResult, error) {
+	q, err := m.normalizeQuery(query)
+	if err != nil {
+		return nil, err
+	}
+	q32 := make([]float32, len(q))
+	for d, f := range q {
+		q32[d] = float32(f)
+	}
+
+	// 多取一个以便排除查询词自身，另外多取已删除的行数
+	neighbors := idx.Search(m, q32, L+1+len(m.removed), ef)
+	results := make([]SearchResult, 0, len(neighbors))
+	const epsilon = 1e-6
+	for _, n := range neighbors {
+		if m.removed[n.Node] {
+			continue
+		}
+		sim := m.dot(q, n.Node)
+		if !includeSelf && math.Abs(sim-1.0) < epsilon {
+			continue
+		}
+		results = append(results, m.result(n.Node, sim))
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].Similarity > results[j].Similarity
+	})
+	return results[:min(L, len(results))], nil
+}
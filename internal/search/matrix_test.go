@@ -0,0 +1,106 @@
+package search
+
+import (
+	"errors"
+	"math"
+	"testing"
+	"yggdrasil/sim-words/internal/base"
+	"yggdrasil/sim-words/internal/hnsw"
+)
+
+func TestMatrixMatchesQueryWords(t *testing.T) {
+	db, clusters := openTestDB(t)
+
+	m, err := LoadMatrix(db, 0)
+	if err != nil {
+		t.Fatalf("unable to load matrix: %s", err)
+	}
+	if m.Len() != 4 || m.Dim != 2 {
+		t.Fatalf("unexpected matrix of %d words and dimension %d", m.Len(), m.Dim)
+	}
+
+	for _, query := range []base.Float64Slice{{1, 0.05}, {0.3, 2}, {1, 0}} {
+		for _, includeSelf := range []bool{false, true} {
+			expected, err := QueryWords(db, query, clusters, 1, 5, includeSelf)
+			if err != nil {
+				t.Fatalf("query failed: %s", err)
+			}
+			results, err := m.QueryWords(query, clusters, 1, 5, includeSelf)
+			if err != nil {
+				t.Fatalf("matrix query failed: %s", err)
+			}
+
+			if len(results) != len(expected) {
+				t.Fatalf("query %v: expected %+v, got %+v", query, expected, results)
+			}
+			for i := range expected {
+				if results[i].Word != expected[i].Word ||
+					results[i].Frequency != expected[i].Frequency ||
+					math.Abs(results[i].Similarity-expected[i].Similarity) > 1e-6 {
+					t.Errorf("query %v: expected %+v, got %+v", query, expected[i], results[i])
+				}
+			}
+		}
+	}
+}
+
+func TestMatrixMemoryBudget(t *testing.T) {
+	db, _ := openTestDB(t)
+
+	if _, err := LoadMatrix(db, EstimateMatrixBytes(4, 2)-1); !errors.Is(err, ErrMemoryBudget) {
+		t.Fatalf("expected ErrMemoryBudget, got %v", err)
+	}
+	if _, err := LoadMatrix(db, EstimateMatrixBytes(4, 2)); err != nil {
+		t.Fatalf("expected the budget to be enough, got %s", err)
+	}
+}
+
+func TestMatrixDimensionMismatch(t *testing.T) {
+	db, clusters := openTestDB(t)
+	m, _ := LoadMatrix(db, 0)
+
+	if _, err := m.QueryWords(base.Float64Slice{1, 0, 0}, clusters, 1, 5, false); err == nil {
+		t.Error("expected an error for wrong query dimension")
+	}
+}
+
+func TestMatrixQueryHNSW(t *testing.T) {
+	db, _ := openTestDB(t)
+	m, _ := LoadMatrix(db, 0)
+	idx := hnsw.Build(m, m.IDs, 4, 10, 1)
+
+	results, err := m.QueryHNSW(idx, base.Float64Slice{1, 0}, 2, 10, false)
+	if err != nil {
+		t.Fatalf("query failed: %s", err)
+	}
+	if len(results) != 2 || results[0].Word != "pear" || results[1].Word != "dog" {
+		t.Fatalf("expected pear and dog, got %+v", results)
+	}
+
+	results, _ = m.QueryHNSW(idx, base.Float64Slice{1, 0}, 2, 10, true)
+	if len(results) != 2 || results[0].Word != "apple" || results[0].Frequency != 10 {
+		t.Fatalf("expected apple first, got %+v", results)
+	}
+}
+
+func TestMatrixRemove(t *testing.T) {
+	db, clusters := openTestDB(t)
+	m, _ := LoadMatrix(db, 0)
+	idx := hnsw.Build(m, m.IDs, 4, 10, 1)
+
+	// pear 为 {1, 0} 除自身外最相似的单词
+	m.Remove([]uint{m.IDs[1]})
+
+	results, _ := m.QueryWords(base.Float64Slice{1, 0}, clusters, 2, 5, false)
+	if len(results) != 2 || results[0].Word != "dog" {
+		t.Errorf("expected dog and cat, got %+v", results)
+	}
+	results, _ = m.QueryExact(base.Float64Slice{1, 0}, 1, false)
+	if len(results) != 1 || results[0].Word != "dog" {
+		t.Errorf("expected dog, got %+v", results)
+	}
+	results, _ = m.QueryHNSW(idx, base.Float64Slice{1, 0}, 2, 10, false)
+	if len(results) != 2 || results[0].Word != "dog" || results[1].Word != "cat" {
+		t.Errorf("expected dog and cat, got %+v", results)
+	}
+}
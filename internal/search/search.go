@@ -10,11 +10,24 @@ import (
 	"yggdrasil/sim-words/internal/cluster"
 	"yggdrasil/sim-words/internal/common"
 	"yggdrasil/sim-words/internal/embedding"
+	"yggdrasil/sim-words/internal/pq"
+	"yggdrasil/sim-words/internal/quant"
 	"yggdrasil/sim-words/internal/word"
 
 	"gorm.io/gorm"
 )
 
+// RescoreFactor 已量化时每个簇先按量化向量初筛出 L 的这么多倍个候选，再用全精度向量重新打分；
+// 为 0 时不使用量化向量
+var RescoreFactor = 4
+
+// PQRerank 有 PQ 码本时每个簇按近似相似度取出 L 的这么多倍个候选，再用全精度向量重新排序；
+// 为 0 时直接返回近似相似度，小于 0 时不使用 PQ 编码
+var PQRerank = 4
+
+// TemplateAnchors 模板查询时每个簇最多套入模板的代表词数，簇的分数为这些代表词与查询相似度的平均值
+var TemplateAnchors = 3
+
 type SearchResult struct {
 	Word       string
 	Similarity float64
@@ -43,84 +56,231 @@ func QueryWords(
 	L int,
 	includeSelf bool,
 ) ([]SearchResult, error) {
+	// 按与簇中心的相似度找 top-K（最相似）和 bottom-K（最远）
+	return queryClusters(db, query, clusters, probeClusters(query, clusters, topK), L, includeSelf)
+}
 
-	type clusterScore struct {
-		ClusterIndex int
-		Score        float64
+// queryClusters 从 probed 指定的每个簇中选相似度最高的 L 个单词
+func queryClusters(
+	db *gorm.DB,
+	query base.Float64Slice,
+	clusters []cluster.Cluster,
+	probed []int,
+	L int,
+	includeSelf bool,
+) ([]SearchResult, error) {
+	// 每个簇内选出 L 个单词的方式：乘积量化、标量量化初筛或逐个计算全精度相似度
+	rankCluster, err := newClusterRanker(db, query, L, includeSelf)
+	if err != nil {
+		return nil, err
 	}
 
-	// 计算 query 与簇中心相似度
-	scores := make([]clusterScore, len(clusters))
-	for i, c := range clusters {
-		scores[i] = clusterScore{
-			ClusterIndex: i,
-			Score:        CosineSimilarity(query, c.Embedding.NormalizedEmbedding),
+	var results []SearchResult
+	for _, ci := range probed {
+		c := clusters[ci]
+		clusterResults, err := rankCluster(c)
+		if err != nil {
+			return nil, fmt.Errorf("unable to load words in cluster %d: %s", c.ID, err)
 		}
+		results = append(results, clusterResults...)
 	}
 
-	//排序找 top-K（最相似）和 bottom-K（最远）
-	sort.Slice(scores, func(i, j int) bool {
-		return scores[i].Score > scores[j].Score
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].Similarity > results[j].Similarity
+	})
+	return results, nil
+}
+
+// newClusterRanker 按数据库中是否有 PQ 码本、标量量化参数选择簇内的查询方式
+func newClusterRanker(
+	db *gorm.DB,
+	query base.Float64Slice,
+	L int,
+	includeSelf bool,
+) (func(c cluster.Cluster) ([]SearchResult, error), error) {
+	codebook, err := pq.GetCodebook(db)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read PQ codebook: %s", err)
+	}
+	if codebook != nil && PQRerank >= 0 {
+		normalized := word.L2Normalize(query)
+		table := codebook.NewTable(normalized)
+		return func(c cluster.Cluster) ([]SearchResult, error) {
+			return rankPQ(db, query, normalized, c, table, L, includeSelf)
+		}, nil
+	}
+
+	params, err := quant.GetParams(db)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read quantization params: %s", err)
+	}
+	var scorer quant.Scorer
+	if params != nil && RescoreFactor > 0 {
+		scorer = params.NewScorer(query)
+	}
+	return func(c cluster.Cluster) ([]SearchResult, error) {
+		// 在簇内所有单词或量化初筛出的候选中计算相似度
+		words, err := selectCandidates(db, c.ID, scorer, L)
+		if err != nil {
+			return nil, err
+		}
+		return topL(query, words, L, includeSelf), nil
+	}, nil
+}
+
+// topL 按全精度相似度返回最相似的 L 个单词
+func topL(query base.Float64Slice, words []word.WordEmbedding, L int, includeSelf bool) []SearchResult {
+	sims := make([]float64, len(words))
+	order := make([]int, len(words))
+	for i, w := range words {
+		sims[i] = CosineSimilarity(query, w.NormalizedEmbedding)
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return sims[order[i]] > sims[order[j]]
 	})
-	topClusters := scores[:topK]
-	bottomClusters := scores[len(scores)-topK:] // 同样取 topK 个最远
 
-	// 从 topClusters 中选相似度最高的 L 个单词
 	var results []SearchResult
 	const epsilon = 1e-6
-	selectTopL := func(clist []clusterScore) error {
-		for _, cs := range clist {
-			c := clusters[cs.ClusterIndex]
-			// 在簇内所有单词计算相似度
-			words, err := word.SelectByClusterID(db, c.ID)
-			if err != nil {
-				return fmt.Errorf("unable to load words in cluster %d: %s", c.ID, err)
-			}
-			sort.Slice(words, func(i, j int) bool {
-				return CosineSimilarity(query, words[i].NormalizedEmbedding) >
-					CosineSimilarity(query, words[j].NormalizedEmbedding)
-			})
-
-			count := 0
-			for i := 0; count < L && i < len(words); i++ {
-				sim := CosineSimilarity(query, words[i].NormalizedEmbedding)
-
-				if !includeSelf {
-					// 不允许包含自己，则判断是不是自己
-					if math.Abs(sim-1.0) < epsilon {
-						// 当差值很小时，视作自己
-						continue
-					}
-				}
-
-				results = append(results, SearchResult{
-					Word:       words[i].Word,
-					Similarity: sim,
-					Frequency:  words[i].Frequency,
-				})
-				count++
+	for _, i := range order {
+		if len(results) >= L {
+			break
+		}
+		if !includeSelf {
+			// 不允许包含自己，则判断是不是自己
+			if math.Abs(sims[i]-1.0) < epsilon {
+				// 当差值很小时，视作自己
+				continue
 			}
 		}
-		return nil
-	}
 
-	err := selectTopL(topClusters)
-	if err != nil {
-		return nil, fmt.Errorf("unable to load from top clusters: %s", err)
+		results = append(results, SearchResult{
+			Word:       words[i].Word,
+			Similarity: sims[i],
+			Frequency:  words[i].Frequency,
+		})
 	}
-	err = selectTopL(bottomClusters)
+	return results
+}
+
+// rankPQ 用非对称距离计算簇内单词的近似相似度：簇中心的内积加上残差编码查表的内积。
+// PQRerank 大于 0 时读取前 L*PQRerank 个候选的全精度向量重新排序，否则直接返回近似相似度
+func rankPQ(
+	db *gorm.DB,
+	query base.Float64Slice,
+	normalized base.Float64Slice,
+	c cluster.Cluster,
+	table pq.Table,
+	L int,
+	includeSelf bool,
+) ([]SearchResult, error) {
+	words, err := word.SelectPQByClusterID(db, c.ID)
 	if err != nil {
-		return nil, fmt.Errorf("unable to load from bottom clusters: %s", err)
+		return nil, err
 	}
 
-	sort.Slice(results, func(i, j int) bool {
-		return results[i].Similarity > results[j].Similarity
+	var centerSim float64
+	for d, f := range c.NormalizedEmbedding {
+		centerSim += normalized[d] * f
+	}
+	sims := make([]float64, len(words))
+	order := make([]int, len(words))
+	for i, w := range words {
+		sims[i] = centerSim + table.Score(w.PQCode)
+		order[i] = i
+	}
+	sort.Slice(order, func(i, j int) bool {
+		return sims[order[i]] > sims[order[j]]
 	})
+
+	if PQRerank > 0 {
+		// 多留一个位置给可能被排除的查询词自身
+		shortlist := order[:min(len(order), L*PQRerank+1)]
+		candidates, err := word.SelectByIDs(db, common.Map(shortlist, func(i int) uint {
+			return words[i].ID
+		}))
+		if err != nil {
+			return nil, err
+		}
+		return topL(query, candidates, L, includeSelf), nil
+	}
+
+	// 近似相似度无法可靠地识别查询词自身，这里不做排除
+	results := make([]SearchResult, 0, L)
+	for _, i := range order[:min(len(order), L)] {
+		results = append(results, SearchResult{
+			Word:       words[i].Word,
+			Similarity: sims[i],
+			Frequency:  words[i].Frequency,
+		})
+	}
 	return results, nil
 }
 
+// probeClusters 返回与查询向量最相似的 topK 个簇和最不相似的 topK 个簇的下标，
+// 簇数不足 2*topK 时不重复探查同一个簇。层次聚类时只探查叶子簇
+func probeClusters(query base.Float64Slice, clusters []cluster.Cluster, topK int) []int {
+	scores := make([]float64, len(clusters))
+	order := LeafIndexes(clusters)
+	for _, i := range order {
+		scores[i] = CosineSimilarity(query, clusters[i].NormalizedEmbedding)
+	}
+	sort.Slice(order, func(i, j int) bool {
+		return scores[order[i]] > scores[order[j]]
+	})
+
+	return probeEnds(order, topK)
+}
+
+// probeEnds 返回按相似度降序排列的 sorted 的前 topK 个与后 topK 个，不足 2*topK 个时全部返回，不会重复
+func probeEnds[T any](sorted []T, topK int) []T {
+	topK = max(topK, 0)
+	if 2*topK >= len(sorted) {
+		return sorted
+	}
+	return append(sorted[:topK:topK], sorted[len(sorted)-topK:]...)
+}
+
+// selectCandidates scorer 为空时返回簇内全部单词；否则只读取量化向量打分，
+// 返回分数最高的 L*RescoreFactor 个单词的全精度向量
+func selectCandidates(db *gorm.DB, clusterID uint, scorer quant.Scorer, L int) ([]word.WordEmbedding, error) {
+	if scorer == nil {
+		return word.SelectByClusterID(db, clusterID)
+	}
+
+	words, err := word.SelectQuantizedByClusterID(db, clusterID)
+	if err != nil {
+		return nil, err
+	}
+	// 多留一个位置给可能被排除的查询词自身
+	shortlist := L*RescoreFactor + 1
+	if len(words) > shortlist {
+		scores := make([]float64, len(words))
+		for i, w := range words {
+			scores[i] = scorer(w.Quantized)
+		}
+		order := make([]int, len(words))
+		for i := range order {
+			order[i] = i
+		}
+		sort.Slice(order, func(i, j int) bool {
+			return scores[order[i]] > scores[order[j]]
+		})
+		words = common.Map(order[:shortlist], func(i int) word.WordEmbedding {
+			return words[i]
+		})
+	}
+
+	return word.SelectByIDs(db, common.Map(words, func(w word.WordEmbedding) uint {
+		return w.ID
+	}))
+}
+
+// QueryWordsWithTemplate 将查询词与簇的代表词、簇内单词套入模板后由 embedder 嵌入化再查询。
+// 每个簇取前 TemplateAnchors 个代表词，没有代表词时使用锚点词
 func QueryWordsWithTemplate(
 	db *gorm.DB,
+	embedder embedding.Embedder,
 	query string,
 	template string,
 	clusters []cluster.Cluster,
@@ -133,53 +293,54 @@ func QueryWordsWithTemplate(
 		Score        float64
 	}
 
-	type templatedCluster struct {
-		cluster.Cluster
-		TemplatedEmbedding base.Float64Slice
-	}
+	// 层次聚类时只使用叶子簇
+	clusters = Leaves(clusters)
 
-	clusterInputs := make([]string, len(clusters)+1)
-	clusterInputs[0] = strings.ReplaceAll(template, "{{placeholder}}", query)
+	// 查询词与各簇的代表词一起嵌入化，offsets[i] 为第 i 个簇的第一个代表词的位置
+	clusterInputs := []string{strings.ReplaceAll(template, "{{placeholder}}", query)}
+	offsets := make([]int, len(clusters)+1)
 	for i, c := range clusters {
-		clusterInputs[i+1] = strings.ReplaceAll(template, "{{placeholder}}", c.AnchorWord)
+		offsets[i] = len(clusterInputs)
+		anchors := []string(c.Anchors)
+		if len(anchors) == 0 {
+			anchors = []string{c.AnchorWord}
+		}
+		for _, anchor := range anchors[:min(max(TemplateAnchors, 1), len(anchors))] {
+			clusterInputs = append(clusterInputs, strings.ReplaceAll(template, "{{placeholder}}", anchor))
+		}
 	}
-	clusterEmbeddings, err := embedding.Embedding(clusterInputs)
+	offsets[len(clusters)] = len(clusterInputs)
+	clusterEmbeddings, err := embedder.Embed(clusterInputs)
 	if err != nil {
 		return nil, err
 	}
 
-	queryEmbedding := clusterEmbeddings.Embeddings[0]
-	templatedClusters := make([]templatedCluster, len(clusters))
-	for i, c := range clusters {
-		templatedClusters[i] = templatedCluster{
-			Cluster:            c,
-			TemplatedEmbedding: clusterEmbeddings.Embeddings[i+1],
-		}
-	}
-
-	// 计算 query 与簇中心相似度
+	// 簇的分数为各代表词与 query 相似度的平均值
+	queryEmbedding := clusterEmbeddings[0]
 	scores := make([]clusterScore, len(clusters))
-	for i, c := range templatedClusters {
+	for i := range clusters {
+		var sum float64
+		for _, embd := range clusterEmbeddings[offsets[i]:offsets[i+1]] {
+			sum += CosineSimilarity(queryEmbedding, embd)
+		}
 		scores[i] = clusterScore{
 			ClusterIndex: i,
-			Score:        CosineSimilarity(queryEmbedding, c.TemplatedEmbedding),
+			Score:        sum / float64(offsets[i+1]-offsets[i]),
 		}
 	}
 
-	//排序找 top-K（最相似）和 bottom-K（最远）
+	// 排序找 top-K（最相似）和 bottom-K（最远），叶子簇不足 2*topK 个时探查全部
 	sort.Slice(scores, func(i, j int) bool {
 		return scores[i].Score > scores[j].Score
 	})
-	topClusters := scores[:topK]
-	bottomClusters := scores[len(scores)-topK:] // 同样取 topK 个最远
+	probed := probeEnds(scores, topK)
 
-	// 从 topClusters 中选相似度最高的 L 个单词
+	// 从探查的每个簇中选相似度最高的 L 个单词
 	var results []SearchResult
-	const epsilon = 1e-6
 	selectTopL := func(clist []clusterScore) error {
 		for i, cs := range clist {
-			c := templatedClusters[cs.ClusterIndex]
-			log.Printf("cluster #%d anchor %s", i, c.AnchorWord)
+			c := clusters[cs.ClusterIndex]
+			log.Printf("cluster #%d anchor %s score %.4f", i, c.AnchorWord, cs.Score)
 			// 在簇内所有单词计算相似度
 			words, err := word.SelectByClusterID(db, c.ID)
 			if err != nil {
@@ -190,40 +351,23 @@ func QueryWordsWithTemplate(
 				return strings.ReplaceAll(template, "{{placeholder}}", w.Word)
 			})
 
-			wordEmbeddings, err := embedding.Embedding(inputs)
+			wordEmbeddings, err := embedder.Embed(inputs)
 			if err != nil {
 				return err
 			}
 
-			count := 0
-			for i := 0; count < L && i < len(words); i++ {
-				sim := CosineSimilarity(queryEmbedding, wordEmbeddings.Embeddings[i])
-				if !includeSelf {
-					// 不允许包含自己，则判断是不是自己
-					if math.Abs(sim-1.0) < epsilon {
-						// 当差值很小时，视作自己
-						continue
-					}
-				}
-
-				results = append(results, SearchResult{
-					Word:       words[i].Word,
-					Similarity: sim,
-					Frequency:  words[i].Frequency,
-				})
-				count++
+			// 按套入模板后的相似度选出 L 个，而不是簇内的前 L 个
+			for i := range words {
+				words[i].NormalizedEmbedding = wordEmbeddings[i]
 			}
+			results = append(results, topL(queryEmbedding, words, L, includeSelf)...)
 		}
 		return nil
 	}
 
-	err = selectTopL(topClusters)
-	if err != nil {
-		return nil, fmt.Errorf("unable to load from top clusters: %s", err)
-	}
-	err = selectTopL(bottomClusters)
+	err = selectTopL(probed)
 	if err != nil {
-		return nil, fmt.Errorf("unable to load from bottom clusters: %s", err)
+		return nil, fmt.Errorf("unable to load from clusters: %s", err)
 	}
 
 	sort.Slice(results, func(i, j int) bool {
@@ -0,0 +1,327 @@
+package search
+
+import (
+	"math"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"yggdrasil/sim-words/internal/base"
+	"yggdrasil/sim-words/internal/cluster"
+	"yggdrasil/sim-words/internal/common"
+	"yggdrasil/sim-words/internal/pq"
+	"yggdrasil/sim-words/internal/quant"
+	"yggdrasil/sim-words/internal/word"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// stubEmbedder 按模板中替换进去的单词查表返回向量，并记录收到的文本
+type stubEmbedder struct {
+	vectors map[string][]float64
+	calls   [][]string
+}
+
+func (e *stubEmbedder) Embed(texts []string) ([][]float64, error) {
+	e.calls = append(e.calls, texts)
+	result := make([][]float64, len(texts))
+	for i, text := range texts {
+		fields := strings.Fields(text)
+		result[i] = e.vectors[fields[len(fields)-1]]
+	}
+	return result, nil
+}
+
+func (e *stubEmbedder) Dimension() int { return 2 }
+
+func (e *stubEmbedder) Model() string { return "stub" }
+
+// openTestDB 在临时目录中创建两个簇：水果簇与动物簇
+func openTestDB(t *testing.T) (*gorm.DB, []cluster.Cluster) {
+	t.Helper()
+
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "test.sqlite")), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("unable to open db: %s", err)
+	}
+
+	clusters := []cluster.Cluster{
+		{Embedding: base.Embedding{NormalizedEmbedding: base.Float64Slice{1, 0}}, AnchorWord: "apple"},
+		{Embedding: base.Embedding{NormalizedEmbedding: base.Float64Slice{0, 1}}, AnchorWord: "cat"},
+	}
+	if err := cluster.SaveClusters(db, clusters); err != nil {
+		t.Fatalf("unable to save clusters: %s", err)
+	}
+
+	words := []word.WordEmbedding{
+		{Word: "apple", Frequency: 10, ClusterID: clusters[0].ID},
+		{Word: "pear", Frequency: 8, ClusterID: clusters[0].ID},
+		{Word: "cat", Frequency: 5, ClusterID: clusters[1].ID},
+		{Word: "dog", Frequency: 3, ClusterID: clusters[1].ID},
+	}
+	vectors := map[string]base.Float64Slice{
+		"apple": {1, 0},
+		"pear":  {0.9, 0.1},
+		"cat":   {0, 1},
+		"dog":   {0.2, 0.9},
+	}
+	for i := range words {
+		words[i].NormalizedEmbedding = word.L2Normalize(vectors[words[i].Word])
+	}
+	if err := word.SaveWords(db, words); err != nil {
+		t.Fatalf("unable to save words: %s", err)
+	}
+
+	return db, clusters
+}
+
+func TestQueryWordsWithTemplate(t *testing.T) {
+	db, clusters := openTestDB(t)
+	embedder := &stubEmbedder{vectors: map[string][]float64{
+		"apple": {1, 0},
+		"pear":  {0.8, 0.2},
+		"cat":   {0, 1},
+		"dog":   {0.1, 1},
+	}}
+
+	results, err := QueryWordsWithTemplate(db, embedder, "apple", "I like {{placeholder}}", clusters, 1, 5, false)
+	if err != nil {
+		t.Fatalf("query failed: %s", err)
+	}
+
+	if len(embedder.calls) == 0 || embedder.calls[0][0] != "I like apple" {
+		t.Fatalf("query should be embedded with template first, got %v", embedder.calls)
+	}
+	for _, call := range embedder.calls {
+		for _, text := range call {
+			if !strings.HasPrefix(text, "I like ") {
+				t.Errorf("text %q is not templated", text)
+			}
+		}
+	}
+
+	// 自身被排除，结果按相似度降序
+	if len(results) == 0 || results[0].Word != "pear" {
+		t.Fatalf("expected pear first, got %+v", results)
+	}
+	for i, r := range results {
+		if r.Word == "apple" {
+			t.Errorf("query word should be excluded, got %+v", results)
+		}
+		if i > 0 && results[i-1].Similarity < r.Similarity {
+			t.Errorf("results not sorted: %+v", results)
+		}
+	}
+}
+
+func TestQueryWordsWithTemplateAnchors(t *testing.T) {
+	db, clusters := openTestDB(t)
+	clusters[0].Anchors = base.StringSlice{"apple", "pear"}
+	clusters[1].Anchors = base.StringSlice{"cat", "dog"}
+	defer func(n int) { TemplateAnchors = n }(TemplateAnchors)
+
+	// 只看第一个代表词时 cat 比 apple 更接近 kiwi，平均两个代表词时水果簇更接近
+	for _, tc := range []struct {
+		anchors int
+		inputs  int
+		top     string
+	}{{1, 3, "cat"}, {2, 5, "apple"}} {
+		TemplateAnchors = tc.anchors
+		embedder := &stubEmbedder{vectors: map[string][]float64{
+			"kiwi":  {1, 0.05},
+			"apple": {0.6, 0.8},
+			"pear":  {1, 0},
+			"cat":   {0.7, 0.7},
+			"dog":   {0, 1},
+		}}
+		results, err := QueryWordsWithTemplate(db, embedder, "kiwi", "I like {{placeholder}}", clusters, 1, 1, false)
+		if err != nil {
+			t.Fatalf("query failed: %s", err)
+		}
+		if len(embedder.calls) != 3 || len(embedder.calls[0]) != tc.inputs {
+			t.Fatalf("%d anchors: expected %d texts embedded first, got %v", tc.anchors, tc.inputs, embedder.calls)
+		}
+		// 先查询分数最高的簇
+		if embedder.calls[1][0] != "I like "+tc.top {
+			t.Errorf("%d anchors: expected the cluster of %s first, got %v", tc.anchors, tc.top, embedder.calls[1])
+		}
+		// 每个簇按相似度取 L 个，而不是簇内的前 L 个
+		if len(results) != 2 || results[0].Word != "pear" || results[1].Word != "cat" {
+			t.Errorf("%d anchors: expected pear and cat, got %+v", tc.anchors, results)
+		}
+	}
+}
+
+func TestQueryWordsWithTemplateClampsTopK(t *testing.T) {
+	db, clusters := openTestDB(t)
+	embedder := &stubEmbedder{vectors: map[string][]float64{
+		"kiwi":  {1, 0.05},
+		"apple": {0.6, 0.8},
+		"pear":  {1, 0},
+		"cat":   {0.7, 0.7},
+		"dog":   {0, 1},
+	}}
+
+	// topK 超过叶子簇数时每个簇只探查一次
+	for _, topK := range []int{2, 5} {
+		results, err := QueryWordsWithTemplate(db, embedder, "kiwi", "I like {{placeholder}}", clusters, topK, 5, false)
+		if err != nil {
+			t.Fatalf("topK %d: query failed: %s", topK, err)
+		}
+		seen := map[string]bool{}
+		for _, r := range results {
+			if seen[r.Word] {
+				t.Fatalf("topK %d: duplicate word %s in %+v", topK, r.Word, results)
+			}
+			seen[r.Word] = true
+		}
+		if len(results) != 4 {
+			t.Errorf("topK %d: expected all 4 words, got %+v", topK, results)
+		}
+	}
+}
+
+func TestProbeEnds(t *testing.T) {
+	for _, tc := range []struct {
+		topK int
+		want []int
+	}{{0, []int{}}, {1, []int{0, 4}}, {2, []int{0, 1, 3, 4}}, {3, []int{0, 1, 2, 3, 4}}, {10, []int{0, 1, 2, 3, 4}}, {-1, []int{}}} {
+		if got := probeEnds([]int{0, 1, 2, 3, 4}, tc.topK); !slices.Equal(got, tc.want) {
+			t.Errorf("topK %d: expected %v, got %v", tc.topK, tc.want, got)
+		}
+	}
+}
+
+func TestQueryWords(t *testing.T) {
+	db, clusters := openTestDB(t)
+
+	results, err := QueryWords(db, word.L2Normalize(base.Float64Slice{1, 0.05}), clusters, 1, 5, false)
+	if err != nil {
+		t.Fatalf("query failed: %s", err)
+	}
+
+	// top-1 簇为水果簇，bottom-1 簇为动物簇
+	got := make([]string, len(results))
+	for i, r := range results {
+		got[i] = r.Word
+	}
+	want := []string{"apple", "pear", "dog", "cat"}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+	if results[0].Frequency != 10 {
+		t.Errorf("expected frequency 10, got %d", results[0].Frequency)
+	}
+}
+
+func TestQueryWordsExcludesSelf(t *testing.T) {
+	db, clusters := openTestDB(t)
+
+	results, err := QueryWords(db, base.Float64Slice{1, 0}, clusters, 1, 5, false)
+	if err != nil {
+		t.Fatalf("query failed: %s", err)
+	}
+	for _, r := range results {
+		if r.Word == "apple" {
+			t.Errorf("apple should be excluded, got %+v", results)
+		}
+	}
+
+	results, err = QueryWords(db, base.Float64Slice{1, 0}, clusters, 1, 5, true)
+	if err != nil {
+		t.Fatalf("query failed: %s", err)
+	}
+	if results[0].Word != "apple" {
+		t.Errorf("apple should be included, got %+v", results)
+	}
+}
+
+func TestQueryWordsQuantized(t *testing.T) {
+	db, clusters := openTestDB(t)
+	// 水果簇内多一个单词，初筛才会淘汰候选
+	plum := []word.WordEmbedding{{Word: "plum", Frequency: 1, ClusterID: clusters[0].ID}}
+	plum[0].NormalizedEmbedding = word.L2Normalize(base.Float64Slice{0.7, 0.3})
+	word.SaveWords(db, plum)
+
+	words, _ := word.SelectByIDs(db, []uint{1, 2, 3, 4, 5})
+	params, err := quant.Train(quant.Int8, common.Map(words, func(w word.WordEmbedding) []float64 {
+		return w.NormalizedEmbedding
+	}))
+	if err != nil {
+		t.Fatalf("unable to train quantization params: %s", err)
+	}
+	for i := range words {
+		words[i].Quantized = params.Encode(words[i].NormalizedEmbedding)
+	}
+	if err := word.UpdateQuantized(db, words); err != nil {
+		t.Fatalf("unable to save quantized vectors: %s", err)
+	}
+	if err := quant.SaveParams(db, params); err != nil {
+		t.Fatalf("unable to save params: %s", err)
+	}
+
+	query := word.L2Normalize(base.Float64Slice{1, 0.05})
+	expected, _ := QueryWords(db, query, clusters, 1, 5, false)
+
+	// 每个簇的候选只剩 1*1+1 个，结果仍为全精度相似度
+	defer func(factor int) { RescoreFactor = factor }(RescoreFactor)
+	RescoreFactor = 1
+	results, err := QueryWords(db, query, clusters, 1, 1, false)
+	if err != nil {
+		t.Fatalf("query failed: %s", err)
+	}
+	if len(results) != 2 || results[0].Word != expected[0].Word || results[0].Similarity != expected[0].Similarity {
+		t.Fatalf("expected %+v first, got %+v", expected[0], results)
+	}
+}
+
+func TestQueryWordsPQ(t *testing.T) {
+	db, clusters := openTestDB(t)
+	plum := []word.WordEmbedding{{Word: "plum", Frequency: 1, ClusterID: clusters[0].ID}}
+	plum[0].NormalizedEmbedding = word.L2Normalize(base.Float64Slice{0.7, 0.3})
+	word.SaveWords(db, plum)
+
+	// 以簇中心的残差训练码本，每个单词各占一个中心，编码无损
+	words, _ := word.SelectByIDs(db, []uint{1, 2, 3, 4, 5})
+	centers := map[uint]base.Float64Slice{}
+	for _, c := range clusters {
+		centers[c.ID] = c.NormalizedEmbedding
+	}
+	residuals := common.Map(words, func(w word.WordEmbedding) []float64 {
+		return []float64{
+			w.NormalizedEmbedding[0] - centers[w.ClusterID][0],
+			w.NormalizedEmbedding[1] - centers[w.ClusterID][1],
+		}
+	})
+	codebook, err := pq.Train(residuals, 1, 256, 10, 1)
+	if err != nil {
+		t.Fatalf("unable to train codebook: %s", err)
+	}
+	for i := range words {
+		words[i].PQCode = codebook.Encode(residuals[i])
+	}
+	if err := word.UpdatePQCodes(db, words); err != nil {
+		t.Fatalf("unable to save codes: %s", err)
+	}
+	if err := pq.SaveCodebook(db, codebook); err != nil {
+		t.Fatalf("unable to save codebook: %s", err)
+	}
+
+	defer func(rerank int) { PQRerank = rerank }(PQRerank)
+	query := word.L2Normalize(base.Float64Slice{1, 0.05})
+	for _, rerank := range []int{0, 1, 4} {
+		PQRerank = rerank
+		results, err := QueryWords(db, query, clusters, 1, 1, false)
+		if err != nil {
+			t.Fatalf("rerank %d: query failed: %s", rerank, err)
+		}
+		if len(results) != 2 || results[0].Word != "apple" {
+			t.Fatalf("rerank %d: expected apple first, got %+v", rerank, results)
+		}
+		expected := CosineSimilarity(query, base.Float64Slice{1, 0})
+		if math.Abs(results[0].Similarity-expected) > 1e-9 {
+			t.Fatalf("rerank %d: expected similarity %f, got %f", rerank, expected, results[0].Similarity)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package search
+
+import (
+	"sort"
+	"yggdrasil/sim-words/internal/base"
+	"yggdrasil/sim-words/internal/cluster"
+
+	"gorm.io/gorm"
+)
+
+// LeafIndexes 返回没有子簇的簇的下标，未做层次聚类时即全部簇
+func LeafIndexes(clusters []cluster.Cluster) []int {
+	parents := map[uint]bool{}
+	for _, c := range clusters {
+		if c.ParentID != nil {
+			parents[*c.ParentID] = true
+		}
+	}
+	leaves := make([]int, 0, len(clusters))
+	for i, c := range clusters {
+		if !parents[c.ID] {
+			leaves = append(leaves, i)
+		}
+	}
+	return leaves
+}
+
+// Leaves 返回没有子簇的簇，单词只属于这些簇
+func Leaves(clusters []cluster.Cluster) []cluster.Cluster {
+	indexes := LeafIndexes(clusters)
+	if len(indexes) == len(clusters) {
+		return clusters
+	}
+	leaves := make([]cluster.Cluster, len(indexes))
+	for i, index := range indexes {
+		leaves[i] = clusters[index]
+	}
+	return leaves
+}
+
+// probeTree 从顶层簇开始逐层向下，每层只保留与查询向量最相似的 beam 个簇，返回途经的叶子簇的下标。
+// 只计算途经的簇的相似度，而不是每个簇的
+func probeTree(query base.Float64Slice, clusters []cluster.Cluster, beam int) []int {
+	children := map[uint][]int{}
+	var frontier []int
+	for i, c := range clusters {
+		if c.ParentID == nil {
+			frontier = append(frontier, i)
+		} else {
+			children[*c.ParentID] = append(children[*c.ParentID], i)
+		}
+	}
+
+	var leaves []int
+	for len(frontier) > 0 {
+		scores := make(map[int]float64, len(frontier))
+		for _, i := range frontier {
+			scores[i] = CosineSimilarity(query, clusters[i].NormalizedEmbedding)
+		}
+		sort.Slice(frontier, func(a, b int) bool {
+			return scores[frontier[a]] > scores[frontier[b]]
+		})
+
+		var next []int
+		for _, i := range frontier[:min(beam, len(frontier))] {
+			if kids := children[clusters[i].ID]; len(kids) > 0 {
+				next = append(next, kids...)
+			} else {
+				leaves = append(leaves, i)
+			}
+		}
+		frontier = next
+	}
+	return leaves
+}
+
+// QueryTree 沿簇树以宽度 beam 向下搜索，从途经的叶子簇中各选相似度最高的 L 个单词
+func QueryTree(
+	db *gorm.DB,
+	query base.Float64Slice,
+	clusters []cluster.Cluster,
+	beam int,
+	L int,
+	includeSelf bool,
+) ([]SearchResult, error) {
+	return queryClusters(db, query, clusters, probeTree(query, clusters, beam), L, includeSelf)
+}
+
+// QueryTree 与 QueryTree 相同，但在内存中的矩阵上计算
+func (m *Matrix) QueryTree(
+	query base.Float64Slice,
+	clusters []cluster.Cluster,
+	beam int,
+	L int,
+	includeSelf bool,
+) ([]SearchResult, error) {
+	if err := m.checkDim(query); err != nil {
+		return nil, err
+	}
+	return m.queryClusters(query, clusters, probeTree(query, clusters, beam), L, includeSelf)
+}
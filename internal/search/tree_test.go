@@ -0,0 +1,149 @@
+package search
+
+import (
+	"math"
+	"path/filepath"
+	"slices"
+	"testing"
+	"yggdrasil/sim-words/internal/base"
+	"yggdrasil/sim-words/internal/cluster"
+	"yggdrasil/sim-words/internal/word"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// openTreeDB 两个顶层簇：水果与动物，各有两个叶子簇
+func openTreeDB(t *testing.T) (*gorm.DB, []cluster.Cluster) {
+	t.Helper()
+
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "tree.sqlite")), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("unable to open db: %s", err)
+	}
+
+	newCluster := func(anchor string, vector base.Float64Slice, parent *cluster.Cluster) cluster.Cluster {
+		c := cluster.Cluster{Embedding: base.Embedding{NormalizedEmbedding: word.L2Normalize(vector)}, AnchorWord: anchor}
+		if parent != nil {
+			c.ParentID = &parent.ID
+			c.Level = parent.Level + 1
+		}
+		if err := cluster.SaveClusters(db, []cluster.Cluster{c}); err != nil {
+			t.Fatalf("unable to save cluster: %s", err)
+		}
+		clusters, _ := cluster.GetClusters(db, nil)
+		return clusters[len(clusters)-1]
+	}
+	fruit := newCluster("apple", base.Float64Slice{1, 0.2}, nil)
+	animal := newCluster("cat", base.Float64Slice{0.2, 1}, nil)
+	apples := newCluster("apple", base.Float64Slice{1, 0}, &fruit)
+	pears := newCluster("pear", base.Float64Slice{1, 0.5}, &fruit)
+	cats := newCluster("cat", base.Float64Slice{0.5, 1}, &animal)
+	dogs := newCluster("dog", base.Float64Slice{0, 1}, &animal)
+
+	vectors := []struct {
+		word    string
+		vector  base.Float64Slice
+		cluster cluster.Cluster
+	}{
+		{"apple", base.Float64Slice{1, 0}, apples},
+		{"apples", base.Float64Slice{1, 0.05}, apples},
+		{"pear", base.Float64Slice{1, 0.5}, pears},
+		{"cat", base.Float64Slice{0.5, 1}, cats},
+		{"dog", base.Float64Slice{0, 1}, dogs},
+	}
+	words := make([]word.WordEmbedding, len(vectors))
+	for i, v := range vectors {
+		words[i] = word.WordEmbedding{Word: v.word, Frequency: i + 1, ClusterID: v.cluster.ID}
+		words[i].NormalizedEmbedding = word.L2Normalize(v.vector)
+	}
+	if err := word.SaveWords(db, words); err != nil {
+		t.Fatalf("unable to save words: %s", err)
+	}
+
+	clusters, _ := cluster.GetClusters(db, nil)
+	return db, clusters
+}
+
+func TestLeaves(t *testing.T) {
+	_, clusters := openTreeDB(t)
+
+	leaves := Leaves(clusters)
+	anchors := make([]string, len(leaves))
+	for i, c := range leaves {
+		anchors[i] = c.AnchorWord
+	}
+	if !slices.Equal(anchors, []string{"apple", "pear", "cat", "dog"}) {
+		t.Fatalf("unexpected leaves %v", anchors)
+	}
+
+	flat := clusters[2:]
+	for i := range flat {
+		flat[i].ParentID = nil
+	}
+	if len(Leaves(flat)) != len(flat) {
+		t.Fatalf("every cluster of a flat list is a leaf")
+	}
+}
+
+func TestProbeTree(t *testing.T) {
+	_, clusters := openTreeDB(t)
+	query := base.Float64Slice{1, 0.1}
+
+	anchors := func(indexes []int) []string {
+		var result []string
+		for _, i := range indexes {
+			result = append(result, clusters[i].AnchorWord)
+		}
+		return result
+	}
+	if got := anchors(probeTree(query, clusters, 1)); !slices.Equal(got, []string{"apple"}) {
+		t.Fatalf("beam 1: expected the apple leaf, got %v", got)
+	}
+	if got := anchors(probeTree(query, clusters, 2)); !slices.Equal(got, []string{"apple", "pear"}) {
+		t.Fatalf("beam 2: expected both fruit leaves, got %v", got)
+	}
+	if got := probeTree(query, clusters, 10); len(got) != 4 {
+		t.Fatalf("wide beam: expected all 4 leaves, got %v", anchors(got))
+	}
+}
+
+func TestQueryTree(t *testing.T) {
+	db, clusters := openTreeDB(t)
+	m, err := LoadMatrix(db, 0)
+	if err != nil {
+		t.Fatalf("unable to load matrix: %s", err)
+	}
+
+	query := base.Float64Slice{1, 0}
+	expected, err := QueryTree(db, query, clusters, 1, 5, false)
+	if err != nil {
+		t.Fatalf("query failed: %s", err)
+	}
+	if len(expected) != 1 || expected[0].Word != "apples" {
+		t.Fatalf("expected only apples, got %+v", expected)
+	}
+
+	results, err := m.QueryTree(query, clusters, 1, 5, false)
+	if err != nil {
+		t.Fatalf("matrix query failed: %s", err)
+	}
+	if len(results) != 1 || results[0].Word != "apples" || math.Abs(results[0].Similarity-expected[0].Similarity) > 1e-6 {
+		t.Fatalf("expected %+v, got %+v", expected, results)
+	}
+
+	if _, err := m.QueryTree(base.Float64Slice{1, 0, 0}, clusters, 1, 5, false); err == nil {
+		t.Fatal("expected an error for a query of wrong dimension")
+	}
+
+	// 平铺的簇探查跳过内部节点
+	flat, err := QueryWords(db, query, clusters, 1, 5, false)
+	if err != nil {
+		t.Fatalf("query failed: %s", err)
+	}
+	for _, r := range flat {
+		if r.Word == "pear" || r.Word == "cat" {
+			t.Fatalf("unexpected word from a cluster that was not probed: %+v", flat)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package vectors
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Read 逐条读取单词和向量交给 fn。文本格式遇到 "count dim" 形式的首行时视为表头跳过，
+// 因此 GloVe 与 word2vec 文本可以互换使用
+func Read(r io.Reader, format Format, fn func(word string, vector []float64) error) error {
+	switch format {
+	case FormatGloVe, FormatWord2Vec, "":
+		return readText(r, fn)
+	case FormatWord2VecBinary:
+		return readBinary(r, fn)
+	default:
+		return fmt.Errorf("unknown vector format %s", format)
+	}
+}
+
+// parseHeader 解析 "count dim" 表头
+func parseHeader(line string) (count int, dim int, ok bool) {
+	fields := strings.Fields(line)
+	if len(fields) != 2 {
+		return 0, 0, false
+	}
+	count, err := strconv.Atoi(fields[0])
+	if err != nil {
+		return 0, 0, false
+	}
+	dim, err = strconv.Atoi(fields[1])
+	if err != nil {
+		return 0, 0, false
+	}
+	return count, dim, true
+}
+
+func readText(r io.Reader, fn func(string, []float64) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 1024*1024), 64*1024*1024)
+
+	dim := 0
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimRight(scanner.Text(), " \r")
+		if text == "" {
+			continue
+		}
+		if line == 1 {
+			if _, headerDim, ok := parseHeader(text); ok {
+				dim = headerDim
+				continue
+			}
+		}
+
+		fields := strings.Split(text, " ")
+		if len(fields) < 2 {
+			return fmt.Errorf("invalid line %d: no vector", line)
+		}
+		if dim == 0 {
+			dim = len(fields) - 1
+		}
+		// 部分 GloVe 文件的单词本身含空格，按末尾 dim 个字段切分
+		if len(fields) < dim+1 {
+			return fmt.Errorf("invalid line %d: expected %d values, got %d", line, dim, len(fields)-1)
+		}
+		split := len(fields) - dim
+		w := strings.Join(fields[:split], " ")
+
+		vector := make([]float64, dim)
+		for i, field := range fields[split:] {
+			value, err := strconv.ParseFloat(field, 64)
+			if err != nil {
+				return fmt.Errorf("invalid value on line %d: %w", line, err)
+			}
+			vector[i] = value
+		}
+
+		if err := fn(w, vector); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+func readBinary(r io.Reader, fn func(string, []float64) error) error {
+	reader := bufio.NewReaderSize(r, 1024*1024)
+
+	headerLine, err := reader.ReadString('\n')
+	if err != nil {
+		return fmt.Errorf("unable to read header: %w", err)
+	}
+	count, dim, ok := parseHeader(headerLine)
+	if !ok {
+		return fmt.Errorf("invalid header %q", strings.TrimSpace(headerLine))
+	}
+
+	raw := make([]byte, 4*dim)
+	for i := range count {
+		w, err := reader.ReadString(' ')
+		if err != nil {
+			return fmt.Errorf("unable to read word #%d: %w", i, err)
+		}
+		// 上一条向量后可能有换行
+		w = strings.TrimLeft(strings.TrimSuffix(w, " "), "\n")
+
+		if _, err := io.ReadFull(reader, raw); err != nil {
+			return fmt.Errorf("unable to read vector of %s: %w", w, err)
+		}
+		vector := make([]float64, dim)
+		for d := range dim {
+			vector[d] = float64(math.Float32frombits(binary.LittleEndian.Uint32(raw[4*d:])))
+		}
+
+		if err := fn(w, vector); err != nil {
+			return err
+		}
+	}
+	return nil
+}
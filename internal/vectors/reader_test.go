@@ -0,0 +1,116 @@
+package vectors
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"slices"
+	"strings"
+	"testing"
+)
+
+type entry struct {
+	word   string
+	vector []float64
+}
+
+func readEntries(t *testing.T, data []byte, format Format) []entry {
+	t.Helper()
+
+	var entries []entry
+	err := Read(bytes.NewReader(data), format, func(w string, vector []float64) error {
+		entries = append(entries, entry{w, vector})
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("read failed: %s", err)
+	}
+	return entries
+}
+
+func assertEntries(t *testing.T, got []entry, want []entry) {
+	t.Helper()
+
+	if len(got) != len(want) {
+		t.Fatalf("expected %d entries, got %d: %v", len(want), len(got), got)
+	}
+	for i := range want {
+		if got[i].word != want[i].word || !slices.Equal(got[i].vector, want[i].vector) {
+			t.Errorf("entry #%d: expected %v, got %v", i, want[i], got[i])
+		}
+	}
+}
+
+var testEntries = []entry{
+	{"apple", []float64{0.5, -1, 2}},
+	{"pear", []float64{0.25, 0, -0.5}},
+}
+
+func TestReadGloVe(t *testing.T) {
+	data := "apple 0.5 -1 2\npear 0.25 0 -0.5\n"
+	assertEntries(t, readEntries(t, []byte(data), FormatGloVe), testEntries)
+}
+
+func TestReadWord2VecText(t *testing.T) {
+	// fastText .vec 的行尾有空格
+	data := "2 3\napple 0.5 -1 2 \npear 0.25 0 -0.5 \n"
+	assertEntries(t, readEntries(t, []byte(data), FormatWord2Vec), testEntries)
+}
+
+func TestReadGloVeWordWithSpaces(t *testing.T) {
+	data := "apple 0.5 -1 2\nnew york 1 2 3\n"
+	entries := readEntries(t, []byte(data), FormatGloVe)
+	if len(entries) != 2 || entries[1].word != "new york" || !slices.Equal(entries[1].vector, []float64{1, 2, 3}) {
+		t.Errorf("unexpected entries %v", entries)
+	}
+}
+
+func TestReadWord2VecBinary(t *testing.T) {
+	var buf bytes.Buffer
+	buf.WriteString("2 3\n")
+	for _, e := range testEntries {
+		buf.WriteString(e.word + " ")
+		for _, v := range e.vector {
+			binary.Write(&buf, binary.LittleEndian, math.Float32bits(float32(v)))
+		}
+		buf.WriteString("\n")
+	}
+
+	assertEntries(t, readEntries(t, buf.Bytes(), FormatWord2VecBinary), testEntries)
+}
+
+func TestReadErrors(t *testing.T) {
+	cases := []struct {
+		name   string
+		data   string
+		format Format
+	}{
+		{"no vector", "apple\n", FormatGloVe},
+		{"short vector", "apple 1 2 3\npear 1 2\n", FormatGloVe},
+		{"bad value", "apple 1 x 3\n", FormatGloVe},
+		{"bad binary header", "apple 1 2\n", FormatWord2VecBinary},
+		{"truncated binary", "1 3\napple \x00\x00", FormatWord2VecBinary},
+		{"unknown format", "apple 1\n", "npy"},
+	}
+
+	for _, c := range cases {
+		err := Read(strings.NewReader(c.data), c.format, func(string, []float64) error { return nil })
+		if err == nil {
+			t.Errorf("%s: expected an error", c.name)
+		}
+	}
+}
+
+func TestDetectFormat(t *testing.T) {
+	cases := map[string]Format{
+		"glove.6B.50d.txt": FormatGloVe,
+		"cc.en.300.vec":    FormatWord2Vec,
+		"cc.en.300.vec.gz": FormatWord2Vec,
+		"GoogleNews.bin":   FormatWord2VecBinary,
+	}
+	for path, want := range cases {
+		if got := DetectFormat(path); got != want {
+			t.Errorf("%s: expected %s, got %s", path, want, got)
+		}
+	}
+}
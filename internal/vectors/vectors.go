@@ -0,0 +1,34 @@
+package vectors
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+type Format string
+
+const (
+	// FormatGloVe 每行 "word v1 v2 ..."，没有表头
+	FormatGloVe Format = "glove"
+	// FormatWord2Vec word2vec 文本格式，首行为 "count dim"，fastText 的 .vec 与之相同
+	FormatWord2Vec Format = "word2vec"
+	// FormatWord2VecBinary word2vec 二进制格式，首行为 "count dim"，之后每条为单词、空格和 dim 个小端 float32
+	FormatWord2VecBinary Format = "word2vec-bin"
+	// FormatNpy NumPy 的 .npy 矩阵，只用于导出，单词表另行保存
+	FormatNpy Format = "npy"
+)
+
+// DetectFormat 按扩展名推断格式，忽略 .gz 后缀，无法识别时返回 FormatGloVe
+func DetectFormat(path string) Format {
+	name := strings.TrimSuffix(strings.ToLower(path), ".gz")
+	switch filepath.Ext(name) {
+	case ".bin":
+		return FormatWord2VecBinary
+	case ".vec", ".w2v":
+		return FormatWord2Vec
+	case ".npy":
+		return FormatNpy
+	default:
+		return FormatGloVe
+	}
+}
@@ -0,0 +1,135 @@
+package vectors
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Writer 按指定格式逐条写出单词和向量。word2vec 与 .npy 的表头需要总数，
+// 因此创建时必须给出条数和维度，Close 时检查实际写出的条数
+type Writer struct {
+	w       *bufio.Writer
+	format  Format
+	count   int
+	dim     int
+	written int
+}
+
+// NewWriter 创建 Writer 并写出表头。FormatNpy 只写向量，单词需另行保存
+func NewWriter(w io.Writer, format Format, count int, dim int) (*Writer, error) {
+	writer := &Writer{w: bufio.NewWriterSize(w, 1024*1024), format: format, count: count, dim: dim}
+
+	switch format {
+	case FormatGloVe:
+	case FormatWord2Vec, FormatWord2VecBinary:
+		fmt.Fprintf(writer.w, "%d %d\n", count, dim)
+	case FormatNpy:
+		writer.writeNpyHeader()
+	default:
+		return nil, fmt.Errorf("unknown vector format %s", format)
+	}
+	return writer, nil
+}
+
+// writeNpyHeader 写出 NPY 1.0 表头，数据为 C 顺序的小端 float32 矩阵
+func (w *Writer) writeNpyHeader() {
+	header := fmt.Sprintf("{'descr': '<f4', 'fortran_order': False, 'shape': (%d, %d), }", w.count, w.dim)
+	// 魔数、版本和长度共 10 字节，表头以换行结尾并用空格补齐到 64 字节对齐
+	padding := 64 - (10+len(header)+1)%64
+	header += strings.Repeat(" ", padding%64) + "\n"
+
+	w.w.WriteString("\x93NUMPY\x01\x00")
+	binary.Write(w.w, binary.LittleEndian, uint16(len(header)))
+	w.w.WriteString(header)
+}
+
+// Write 写出一条单词和向量
+func (w *Writer) Write(word string, vector []float64) error {
+	if len(vector) != w.dim {
+		return fmt.Errorf("vector of %s has dimension %d, expected %d", word, len(vector), w.dim)
+	}
+	if w.written >= w.count && w.format != FormatGloVe {
+		return fmt.Errorf("more than %d vectors written", w.count)
+	}
+	w.written++
+
+	switch w.format {
+	case FormatGloVe, FormatWord2Vec:
+		w.w.WriteString(word)
+		for _, v := range vector {
+			w.w.WriteByte(' ')
+			w.w.WriteString(strconv.FormatFloat(v, 'g', -1, 32))
+		}
+		w.w.WriteByte('\n')
+	case FormatWord2VecBinary:
+		// 二进制格式以空格结束单词
+		if strings.ContainsAny(word, " \n") {
+			return fmt.Errorf("word %q contains whitespace", word)
+		}
+		w.w.WriteString(word)
+		w.w.WriteByte(' ')
+		w.writeFloat32s(vector)
+		w.w.WriteByte('\n')
+	case FormatNpy:
+		w.writeFloat32s(vector)
+	}
+	return nil
+}
+
+func (w *Writer) writeFloat32s(vector []float64) {
+	var raw [4]byte
+	for _, v := range vector {
+		binary.LittleEndian.PutUint32(raw[:], math.Float32bits(float32(v)))
+		w.w.Write(raw[:])
+	}
+}
+
+// Close 刷新缓冲区，写出条数与表头不符时返回错误
+func (w *Writer) Close() error {
+	if err := w.w.Flush(); err != nil {
+		return err
+	}
+	if w.format != FormatGloVe && w.written != w.count {
+		return fmt.Errorf("%d vectors written, header says %d", w.written, w.count)
+	}
+	return nil
+}
+
+type writeCloser struct {
+	io.Writer
+	closers []io.Closer
+}
+
+func (w *writeCloser) Close() error {
+	var err error
+	for _, closer := range w.closers {
+		if closeErr := closer.Close(); closeErr != nil && err == nil {
+			err = closeErr
+		}
+	}
+	return err
+}
+
+// Create 创建输出文件，path 为 - 时写到标准输出；以 .gz 结尾时 gzip 压缩
+func Create(path string) (io.WriteCloser, error) {
+	if path == "-" {
+		return &writeCloser{Writer: os.Stdout}, nil
+	}
+
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasSuffix(strings.ToLower(path), ".gz") {
+		return file, nil
+	}
+	gz := gzip.NewWriter(file)
+	return &writeCloser{Writer: gz, closers: []io.Closer{gz, file}}, nil
+}
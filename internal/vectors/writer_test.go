@@ -0,0 +1,90 @@
+package vectors
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"strings"
+	"testing"
+)
+
+func writeEntries(t *testing.T, format Format, entries []entry) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	writer, err := NewWriter(&buf, format, len(entries), len(entries[0].vector))
+	if err != nil {
+		t.Fatalf("unable to create writer: %s", err)
+	}
+	for _, e := range entries {
+		if err := writer.Write(e.word, e.vector); err != nil {
+			t.Fatalf("write failed: %s", err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf("close failed: %s", err)
+	}
+	return buf.Bytes()
+}
+
+func TestWriteRoundTrip(t *testing.T) {
+	for _, format := range []Format{FormatGloVe, FormatWord2Vec, FormatWord2VecBinary} {
+		data := writeEntries(t, format, testEntries)
+		assertEntries(t, readEntries(t, data, format), testEntries)
+	}
+
+	data := writeEntries(t, FormatWord2Vec, testEntries)
+	if !strings.HasPrefix(string(data), "2 3\n") {
+		t.Errorf("missing word2vec header in %q", data)
+	}
+}
+
+func TestWriteNpy(t *testing.T) {
+	data := writeEntries(t, FormatNpy, testEntries)
+
+	if !bytes.HasPrefix(data, []byte("\x93NUMPY\x01\x00")) {
+		t.Fatalf("missing npy magic in %q", data[:10])
+	}
+	headerLen := int(binary.LittleEndian.Uint16(data[8:10]))
+	if (10+headerLen)%64 != 0 {
+		t.Errorf("header not aligned: %d", 10+headerLen)
+	}
+	header := string(data[10 : 10+headerLen])
+	if !strings.Contains(header, "'shape': (2, 3)") || !strings.HasSuffix(header, "\n") {
+		t.Errorf("unexpected header %q", header)
+	}
+
+	body := data[10+headerLen:]
+	if len(body) != 2*3*4 {
+		t.Fatalf("expected 24 bytes of data, got %d", len(body))
+	}
+	for i, e := range testEntries {
+		for d, v := range e.vector {
+			got := math.Float32frombits(binary.LittleEndian.Uint32(body[4*(3*i+d):]))
+			if float64(got) != v {
+				t.Errorf("value [%d][%d]: expected %g, got %g", i, d, v, got)
+			}
+		}
+	}
+}
+
+func TestWriteErrors(t *testing.T) {
+	var buf bytes.Buffer
+	if _, err := NewWriter(&buf, "csv", 1, 3); err == nil {
+		t.Error("expected an error for unknown format")
+	}
+
+	writer, _ := NewWriter(&buf, FormatWord2Vec, 2, 3)
+	if err := writer.Write("apple", []float64{1, 2}); err == nil {
+		t.Error("expected an error for wrong dimension")
+	}
+	writer.Write("apple", []float64{1, 2, 3})
+	if err := writer.Close(); err == nil {
+		t.Error("expected an error for too few vectors")
+	}
+
+	writer, _ = NewWriter(&buf, FormatWord2VecBinary, 1, 1)
+	if err := writer.Write("new york", []float64{1}); err == nil {
+		t.Error("expected an error for word with spaces")
+	}
+}
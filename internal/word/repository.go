@@ -19,28 +19,191 @@ func SaveWords(db *gorm.DB, words []WordEmbedding) error {
 	return nil
 }
 
+// BatchUpdateClusterIDs 只更新 cluster_id 列，按簇分组批量更新，不重写向量列
 func BatchUpdateClusterIDs(db *gorm.DB, words []WordEmbedding, clusterIDs []uint) error {
-	batchSize := 100
+	idsByCluster := map[uint][]uint{}
+	for i := range words {
+		words[i].ClusterID = clusterIDs[i]
+		idsByCluster[clusterIDs[i]] = append(idsByCluster[clusterIDs[i]], words[i].ID)
+	}
+
+	batchSize := 500
+	return db.Transaction(func(tx *gorm.DB) error {
+		for clusterID, ids := range idsByCluster {
+			for i := 0; i < len(ids); i += batchSize {
+				end := min(i+batchSize, len(ids))
+				err := tx.Model(&WordEmbedding{}).
+					Where("id IN ?", ids[i:end]).
+					Update("cluster_id", clusterID).Error
+				if err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+}
+
+// SelectByClusterID 返回指定簇内的所有单词
+func SelectByClusterID(db *gorm.DB, clusterID uint) ([]WordEmbedding, error) {
+	var words []WordEmbedding
+	err := db.
+		Where("cluster_id = ?", clusterID).
+		Find(&words).Error
+	return words, err
+}
+
+// SelectByModel 返回由指定模型嵌入的所有单词
+func SelectByModel(db *gorm.DB, model string) ([]WordEmbedding, error) {
+	var words []WordEmbedding
+	err := db.
+		Where("model = ?", model).
+		Find(&words).Error
+	return words, err
+}
+
+// SelectByWords 返回由指定模型嵌入的指定单词
+func SelectByWords(db *gorm.DB, model string, words []string) ([]WordEmbedding, error) {
+	var result []WordEmbedding
+	batchSize := 500
 	for i := 0; i < len(words); i += batchSize {
 		end := min(i+batchSize, len(words))
 
-		batch := words[i:end]
-		for j := range batch {
-			batch[j].ClusterID = clusterIDs[i+j]
+		var batch []WordEmbedding
+		if err := scopeModel(db, model).Where("word IN ?", words[i:end]).Find(&batch).Error; err != nil {
+			return nil, err
 		}
+		result = append(result, batch...)
+	}
+	return result, nil
+}
 
-		if err := db.Save(&batch).Error; err != nil {
-			return err
+// SelectWordsByModel 只返回由指定模型嵌入的单词文本
+func SelectWordsByModel(db *gorm.DB, model string) ([]string, error) {
+	var words []string
+	err := db.Model(&WordEmbedding{}).
+		Where("model = ?", model).
+		Pluck("word", &words).Error
+	return words, err
+}
+
+// DeleteByOtherModels 删除不是由指定模型嵌入的单词
+func DeleteByOtherModels(db *gorm.DB, model string) (int64, error) {
+	result := db.Unscoped().Where("model <> ?", model).Delete(&WordEmbedding{})
+	return result.RowsAffected, result.Error
+}
+
+// DeleteByIDs 删除指定 ID 的单词
+func DeleteByIDs(db *gorm.DB, ids []uint) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	return db.Unscoped().Where("id IN ?", ids).Delete(&WordEmbedding{}).Error
+}
+
+// DeleteAll 清空单词表
+func DeleteAll(db *gorm.DB) error {
+	return db.Unscoped().Where("1 = 1").Delete(&WordEmbedding{}).Error
+}
+
+// Count 返回指定模型的单词数，model 为空时统计全部单词
+func Count(db *gorm.DB, model string) (int64, error) {
+	var count int64
+	err := scopeModel(db.Model(&WordEmbedding{}), model).Count(&count).Error
+	return count, err
+}
+
+// FindInBatches 按 ID 顺序分批读取指定模型的单词，model 为空时读取全部单词
+func FindInBatches(db *gorm.DB, model string, batchSize int, fn func(words []WordEmbedding) error) error {
+	var words []WordEmbedding
+	return scopeModel(db, model).FindInBatches(&words, batchSize, func(tx *gorm.DB, batch int) error {
+		return fn(words)
+	}).Error
+}
+
+func scopeModel(db *gorm.DB, model string) *gorm.DB {
+	if model == "" {
+		return db
+	}
+	return db.Where("model = ?", model)
+}
+
+// SelectQuantizedByClusterID 返回指定簇内的单词，只读取量化向量而不读取全精度向量
+func SelectQuantizedByClusterID(db *gorm.DB, clusterID uint) ([]WordEmbedding, error) {
+	var words []WordEmbedding
+	err := db.
+		Select("id", "word", "frequency", "cluster_id", "quantized").
+		Where("cluster_id = ?", clusterID).
+		Find(&words).Error
+	return words, err
+}
+
+// SelectByIDs 返回指定 ID 的单词
+func SelectByIDs(db *gorm.DB, ids []uint) ([]WordEmbedding, error) {
+	var words []WordEmbedding
+	batchSize := 500
+	for i := 0; i < len(ids); i += batchSize {
+		end := min(i+batchSize, len(ids))
+
+		var batch []WordEmbedding
+		if err := db.Where("id IN ?", ids[i:end]).Find(&batch).Error; err != nil {
+			return nil, err
 		}
+		words = append(words, batch...)
 	}
-	return nil
+	return words, nil
 }
 
-// SelectByClusterID 返回指定簇内的所有单词
-func SelectByClusterID(db *gorm.DB, clusterID uint) ([]WordEmbedding, error) {
+// UpdateQuantized 在一个事务中更新单词的量化向量
+func UpdateQuantized(db *gorm.DB, words []WordEmbedding) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		for _, w := range words {
+			err := tx.Model(&WordEmbedding{}).
+				Where("id = ?", w.ID).
+				UpdateColumn("quantized", w.Quantized).Error
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// ClearQuantized 清空全部量化向量
+func ClearQuantized(db *gorm.DB) error {
+	return db.Model(&WordEmbedding{}).
+		Where("quantized IS NOT NULL").
+		UpdateColumn("quantized", nil).Error
+}
+
+// SelectPQByClusterID 返回指定簇内的单词，只读取乘积量化编码而不读取向量
+func SelectPQByClusterID(db *gorm.DB, clusterID uint) ([]WordEmbedding, error) {
 	var words []WordEmbedding
 	err := db.
+		Select("id", "word", "frequency", "cluster_id", "pq_code").
 		Where("cluster_id = ?", clusterID).
 		Find(&words).Error
 	return words, err
 }
+
+// UpdatePQCodes 在一个事务中更新单词的乘积量化编码
+func UpdatePQCodes(db *gorm.DB, words []WordEmbedding) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		for _, w := range words {
+			err := tx.Model(&WordEmbedding{}).
+				Where("id = ?", w.ID).
+				UpdateColumn("pq_code", w.PQCode).Error
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// ClearPQCodes 清空全部乘积量化编码
+func ClearPQCodes(db *gorm.DB) error {
+	return db.Model(&WordEmbedding{}).
+		Where("pq_code IS NOT NULL").
+		UpdateColumn("pq_code", nil).Error
+}
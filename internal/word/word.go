@@ -13,5 +13,11 @@ type WordEmbedding struct {
 	ClusterID uint
 	Word      string
 	Frequency int
+	// Model 生成嵌入的模型标识
+	Model string `gorm:"index"`
 	base.Embedding
+	// Quantized 量化后的 NormalizedEmbedding，格式由 quant.Params 决定，未量化时为空
+	Quantized []byte
+	// PQCode 与所属簇中心的残差的乘积量化编码，码本见 pq.Codebook，未训练时为空
+	PQCode []byte
 }
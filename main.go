@@ -26,6 +26,26 @@ func main() {
 		cmd.RunQuery(flags)
 	case "serve":
 		cmd.RunServe(flags)
+	case "import":
+		cmd.RunImport(flags)
+	case "export":
+		cmd.RunExport(flags)
+	case "migrate":
+		cmd.RunMigrate(flags)
+	case "build-index":
+		cmd.RunBuildIndex(flags)
+	case "bench":
+		cmd.RunBench(flags)
+	case "add":
+		cmd.RunAdd(flags)
+	case "remove":
+		cmd.RunRemove(flags)
+	case "recluster":
+		cmd.RunRecluster(flags)
+	case "tune-k":
+		cmd.RunTuneK(flags)
+	case "cache":
+		cmd.RunCache(flags)
 	default:
 		log.Fatalf("unknown command %s", subcommand)
 	}